@@ -7,19 +7,36 @@ import (
 	"os/signal"
 	"runtime"
 	"slices"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 
 	flag "github.com/spf13/pflag"
+	"golang.org/x/oauth2"
 
+	"github.com/devusSs/twitchspeak/internal/access"
+	"github.com/devusSs/twitchspeak/internal/auth/linktoken"
 	"github.com/devusSs/twitchspeak/internal/auth/twitch"
+	"github.com/devusSs/twitchspeak/internal/bans"
+	"github.com/devusSs/twitchspeak/internal/chat"
 	"github.com/devusSs/twitchspeak/internal/config"
+	"github.com/devusSs/twitchspeak/internal/database"
 	"github.com/devusSs/twitchspeak/internal/database/psql"
 	"github.com/devusSs/twitchspeak/internal/database/redis"
+	"github.com/devusSs/twitchspeak/internal/eventsub"
+	"github.com/devusSs/twitchspeak/internal/grants"
+	"github.com/devusSs/twitchspeak/internal/helix"
+	"github.com/devusSs/twitchspeak/internal/links"
+	"github.com/devusSs/twitchspeak/internal/revoke"
+	"github.com/devusSs/twitchspeak/internal/rewards"
+	"github.com/devusSs/twitchspeak/internal/roles"
 	"github.com/devusSs/twitchspeak/internal/server"
+	"github.com/devusSs/twitchspeak/internal/streams"
 	"github.com/devusSs/twitchspeak/internal/teamspeak"
+	"github.com/devusSs/twitchspeak/internal/tempchannels"
 	"github.com/devusSs/twitchspeak/internal/updater"
+	"github.com/devusSs/twitchspeak/internal/welcome"
 	"github.com/devusSs/twitchspeak/pkg/log"
 	"github.com/devusSs/twitchspeak/pkg/system"
 )
@@ -81,13 +98,14 @@ func main() {
 	logger.Info("Config loaded successfully")
 
 	svc, err := psql.NewService(psql.Config{
-		Host:     cfg.PostgresHost,
-		Port:     cfg.PostgresPort,
-		User:     cfg.PostgresUser,
-		Password: cfg.PostgresPassword,
-		Database: cfg.PostgresDB,
-		Console:  *consoleFlag,
-		Debug:    *debugFlag,
+		Host:      cfg.PostgresHost,
+		Port:      cfg.PostgresPort,
+		User:      cfg.PostgresUser,
+		Password:  cfg.PostgresPassword,
+		Database:  cfg.PostgresDB,
+		SecretKey: cfg.SecretKey,
+		Console:   *consoleFlag,
+		Debug:     *debugFlag,
 	})
 	if err != nil {
 		logger.Error("Error initializing database service: %v", err)
@@ -115,13 +133,27 @@ func main() {
 		os.Exit(1)
 	}
 
+	linkTokens, err := linktoken.NewSigner(cfg.SecretKey, cfg.LinkTokenTTL)
+	if err != nil {
+		logger.Error("Error initializing link tokens: %v", err)
+		os.Exit(1)
+	}
+
 	err = twitch.Init(twitch.Config{
 		ClientID:     cfg.TwitchClientID,
 		ClientSecret: cfg.TwitchClientSecret,
 		RedirectURI:  cfg.TwitchRedirectURI,
 		Port:         cfg.APIPort,
 		FrontendURL:  cfg.FrontendURL,
-		Svc:          svc,
+		IssuerURL:    cfg.TwitchIssuerURL,
+		JWKSURL:      cfg.TwitchJWKSURL,
+		PKCE:         cfg.TwitchPKCE,
+		LinkTokens:   linkTokens,
+		// The backend URL is the one users see, the redirect URI points to localhost
+		SecureCookies: strings.HasPrefix(cfg.BackendURL, "https://"),
+		Svc:           svc,
+		Console:       *consoleFlag,
+		Debug:         *debugFlag,
 	})
 	if err != nil {
 		logger.Error("Error initializing twitch oauth: %v", err)
@@ -129,16 +161,29 @@ func main() {
 	}
 
 	b := teamspeak.NewBot(teamspeak.BotConfig{
-		Host:         cfg.TeamspeakHost,
-		Queryport:    cfg.TeamspeakQueryPort,
-		Port:         cfg.TeamspeakPort,
-		Username:     cfg.TeamspeakUser,
-		Password:     cfg.TeamspeakPassword,
-		Nickname:     cfg.TeamspeakNickname,
-		LoginBaseURL: fmt.Sprintf("%s/auth/twitch/login", cfg.BackendURL),
-		DB:           svc,
-		Console:      *consoleFlag,
-		Debug:        *debugFlag,
+		Host:          cfg.TeamspeakHost,
+		Queryport:     cfg.TeamspeakQueryPort,
+		Port:          cfg.TeamspeakPort,
+		Username:      cfg.TeamspeakUser,
+		Password:      cfg.TeamspeakPassword,
+		Nickname:      cfg.TeamspeakNickname,
+		LoginBaseURL:  fmt.Sprintf("%s/auth/twitch/login", cfg.BackendURL),
+		LinkTokens:    linkTokens,
+		CommandPrefix: cfg.TeamspeakCommandPrefix,
+		KeepAlive:     cfg.TeamspeakKeepAliveInterval,
+		DB:            svc,
+		Console:       *consoleFlag,
+		Debug:         *debugFlag,
+
+		MaxReconnectAttempts: cfg.TeamspeakReconnectMaxAttempts,
+	})
+
+	b.OnStateChange(func(state teamspeak.ConnState) {
+		if state == teamspeak.StateFailed {
+			logger.Error("TeamSpeak connection failed, retrying in background")
+			return
+		}
+		logger.Info("TeamSpeak connection %s", state)
 	})
 
 	if err := b.EstablishConn(); err != nil {
@@ -151,15 +196,430 @@ func main() {
 		os.Exit(1)
 	}
 
+	revoker, err := revoke.NewRevoker(revoke.Config{
+		Bot:     b,
+		DB:      svc,
+		Groups:  []int{cfg.StreamsLiveGroup},
+		Console: *consoleFlag,
+		Debug:   *debugFlag,
+	})
+	if err != nil {
+		logger.Error("Error initializing revoker: %v", err)
+		os.Exit(1)
+	}
+
+	twitch.OnTokenRejected(revoker.HandleTokenRejected)
+
+	scheduler, err := grants.NewScheduler(grants.Config{
+		Bot:     b,
+		DB:      svc,
+		Console: *consoleFlag,
+		Debug:   *debugFlag,
+	})
+	if err != nil {
+		logger.Error("Error initializing grant scheduler: %v", err)
+		os.Exit(1)
+	}
+
+	if err := scheduler.RegisterCommands(); err != nil {
+		logger.Error("Error registering grant commands: %v", err)
+		os.Exit(1)
+	}
+
 	wg.Add(1)
+	go scheduler.Run(ctx, wg)
+
+	var (
+		receiver *eventsub.Receiver
+		manager  *eventsub.Manager
+	)
+
+	if cfg.EventSubEnabled {
+		callbackURL := cfg.EventSubCallbackURL
+		if callbackURL == "" {
+			callbackURL = cfg.BackendURL + server.EventSubPath
+		}
+
+		receiver, manager, err = eventsub.New(ctx, eventsub.Config{
+			ClientID:     cfg.TwitchClientID,
+			ClientSecret: cfg.TwitchClientSecret,
+			CallbackURL:  callbackURL,
+			Secret:       cfg.EventSubSecret,
+			Console:      *consoleFlag,
+			Debug:        *debugFlag,
+		})
+		if err != nil {
+			logger.Error("Error initializing eventsub: %v", err)
+			os.Exit(1)
+		}
+
+		manager.Add(eventsub.ClientSpecs(cfg.TwitchClientID)...)
+		receiver.OnEvent(revoker.HandleEvent)
+	}
+
+	var (
+		helixClient *helix.Client
+		syncer      *roles.Syncer
+	)
+
+	if cfg.TwitchBroadcasterID != "" {
+		if cfg.TwitchBroadcasterRefreshToken == "" {
+			logger.Error("Twitch broadcaster refresh token is required if broadcaster id is set")
+			os.Exit(1)
+		}
+
+		rules, err := roles.ParseRules(cfg.TwitchRoleRules)
+		if err != nil {
+			logger.Error("Error parsing role rules: %v", err)
+			os.Exit(1)
+		}
+
+		helixClient, err = helix.NewClient(helix.Config{
+			ClientID: cfg.TwitchClientID,
+			TokenSource: twitch.TokenSource(ctx, &oauth2.Token{
+				RefreshToken: cfg.TwitchBroadcasterRefreshToken,
+			}),
+		})
+		if err != nil {
+			logger.Error("Error initializing helix client: %v", err)
+			os.Exit(1)
+		}
+
+		syncer, err = roles.NewSyncer(roles.Config{
+			Helix:         helixClient,
+			BroadcasterID: cfg.TwitchBroadcasterID,
+			Rules:         rules,
+			Bot:           b,
+			DB:            svc,
+			DryRun:        cfg.TwitchRoleSyncDryRun,
+			Console:       *consoleFlag,
+			Debug:         *debugFlag,
+		})
+		if err != nil {
+			logger.Error("Error initializing role syncer: %v", err)
+			os.Exit(1)
+		}
+
+		revoker.AddGroups(syncer.ManagedGroups()...)
+
+		if err := syncer.RegisterCommands(); err != nil {
+			logger.Error("Error registering role commands: %v", err)
+			os.Exit(1)
+		}
+
+		links.OnLink(func(user *database.User) {
+			ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+			defer cancel()
+
+			if _, err := syncer.SyncUser(ctx, user); err != nil {
+				logger.Error("Error syncing roles for %s: %v", user.TeamSpeakUID, err)
+			}
+		})
+
+		if receiver != nil {
+			manager.Add(eventsub.BroadcasterSpecs(cfg.TwitchBroadcasterID)...)
+			receiver.OnEvent(syncer.HandleEvent)
+		}
+
+		wg.Add(1)
+		go syncer.PeriodicReconcile(ctx, cfg.TwitchRoleSyncInterval, wg)
+	}
+
+	if cfg.BansEnabled {
+		if helixClient == nil {
+			logger.Error("Ban sync requires the Twitch broadcaster id and refresh token")
+			os.Exit(1)
+		}
+
+		var allowlist []string
+		for _, entry := range strings.Split(cfg.BansAllowlist, ",") {
+			if entry = strings.TrimSpace(entry); entry != "" {
+				allowlist = append(allowlist, entry)
+			}
+		}
+
+		banSyncer, err := bans.NewSyncer(bans.Config{
+			Helix:         helixClient,
+			BroadcasterID: cfg.TwitchBroadcasterID,
+			Bot:           b,
+			DB:            svc,
+			Permanent:     bans.Action(cfg.BansPermanent),
+			Timeout:       bans.Action(cfg.BansTimeout),
+			MuteGroup:     cfg.BansMuteGroup,
+			Allowlist:     allowlist,
+			Console:       *consoleFlag,
+			Debug:         *debugFlag,
+		})
+		if err != nil {
+			logger.Error("Error initializing ban syncer: %v", err)
+			os.Exit(1)
+		}
+
+		links.OnLink(func(user *database.User) {
+			ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+			defer cancel()
+
+			if err := banSyncer.SyncUser(ctx, user); err != nil {
+				logger.Error("Error syncing ban of %s: %v", user.TeamSpeakUID, err)
+			}
+		})
+
+		if receiver != nil {
+			manager.Add(eventsub.BanSpecs(cfg.TwitchBroadcasterID)...)
+			receiver.OnEvent(banSyncer.HandleEvent)
+		}
+
+		wg.Add(1)
+		go banSyncer.Run(ctx, cfg.BansSyncInterval, wg)
+	}
+
+	if cfg.WelcomeEnabled {
+		welcomer, err := welcome.NewWelcomer(welcome.Config{
+			Bot:          b,
+			DB:           svc,
+			Helix:        helixClient,
+			Mode:         welcome.Mode(cfg.WelcomeMode),
+			Linked:       cfg.WelcomeLinked,
+			TemplatesDir: cfg.WelcomeTemplatesDir,
+			Throttle:     cfg.WelcomeThrottle,
+			Console:      *consoleFlag,
+			Debug:        *debugFlag,
+		})
+		if err != nil {
+			logger.Error("Error initializing welcomer: %v", err)
+			os.Exit(1)
+		}
+
+		welcomer.Subscribe()
+	}
+
+	var tempChannels *tempchannels.Manager
+
+	if cfg.TempChannelsEnabled {
+		if helixClient == nil {
+			logger.Error("Streamer channels require the Twitch broadcaster id and refresh token")
+			os.Exit(1)
+		}
+
+		tempChannels, err = tempchannels.NewManager(tempchannels.Config{
+			Bot:          b,
+			DB:           svc,
+			Helix:        helixClient,
+			ParentID:     cfg.TempChannelsParent,
+			ChannelGroup: cfg.TempChannelsChannelGroup,
+			ServerGroup:  cfg.TempChannelsServerGroup,
+			OnLive:       cfg.TempChannelsOnLive,
+			EmptyTimeout: cfg.TempChannelsEmptyTimeout,
+			Console:      *consoleFlag,
+			Debug:        *debugFlag,
+		})
+		if err != nil {
+			logger.Error("Error initializing channel manager: %v", err)
+			os.Exit(1)
+		}
+
+		// Channels are only created on going live if the notifier reports it
+		if cfg.TempChannelsOnLive && !cfg.StreamsEnabled {
+			logger.Warn("Streamer channels are not created on going live, this requires stream notifications to be enabled")
+		}
+
+		if err := tempChannels.RegisterCommands(); err != nil {
+			logger.Error("Error registering channel commands: %v", err)
+			os.Exit(1)
+		}
+
+		wg.Add(1)
+		go tempChannels.Run(ctx, wg)
+	}
+
+	if cfg.StreamsEnabled {
+		if helixClient == nil {
+			logger.Error("Stream notifications require the Twitch broadcaster id and refresh token")
+			os.Exit(1)
+		}
+
+		var channels []string
+		for _, channel := range strings.Split(cfg.StreamsChannels, ",") {
+			if channel = strings.TrimSpace(channel); channel != "" {
+				channels = append(channels, strings.ToLower(channel))
+			}
+		}
+
+		streamsCfg := streams.Config{
+			Bot:          b,
+			DB:           svc,
+			Helix:        helixClient,
+			PollInterval: cfg.StreamsPollInterval,
+			Channels:     channels,
+			Linked:       cfg.StreamsLinked,
+			ChannelID:    cfg.StreamsTeamspeakChannel,
+			ServerChat:   cfg.StreamsServerChat,
+			LiveGroup:    cfg.StreamsLiveGroup,
+			Template:     cfg.StreamsTemplate,
+			Console:      *consoleFlag,
+			Debug:        *debugFlag,
+		}
+
+		switch cfg.StreamsSource {
+		case "polling":
+		case "eventsub":
+			if receiver == nil {
+				logger.Error("Stream notifications via eventsub require eventsub to be enabled")
+				os.Exit(1)
+			}
+			streamsCfg.Receiver = receiver
+			streamsCfg.Manager = manager
+		default:
+			logger.Error("Unknown stream source %q, expected polling or eventsub", cfg.StreamsSource)
+			os.Exit(1)
+		}
+
+		notifier, err := streams.NewNotifier(streamsCfg)
+		if err != nil {
+			logger.Error("Error initializing stream notifier: %v", err)
+			os.Exit(1)
+		}
+
+		if tempChannels != nil {
+			notifier.AddHandler(tempChannels)
+		}
+
+		wg.Add(1)
+		go notifier.Run(ctx, wg)
+	}
+
+	if cfg.RewardsEnabled {
+		if helixClient == nil || receiver == nil {
+			logger.Error("Channel points rewards require the Twitch broadcaster settings and eventsub")
+			os.Exit(1)
+		}
+
+		rewardList, err := rewards.ParseRewards(cfg.Rewards)
+		if err != nil {
+			logger.Error("Error parsing rewards: %v", err)
+			os.Exit(1)
+		}
+
+		redeemer, err := rewards.NewRedeemer(rewards.Config{
+			Helix:         helixClient,
+			BroadcasterID: cfg.TwitchBroadcasterID,
+			Bot:           b,
+			DB:            svc,
+			Grants:        scheduler,
+			Channels:      tempChannels,
+			Rewards:       rewardList,
+			Console:       *consoleFlag,
+			Debug:         *debugFlag,
+		})
+		if err != nil {
+			logger.Error("Error initializing redeemer: %v", err)
+			os.Exit(1)
+		}
+
+		revoker.AddGroups(redeemer.Groups()...)
+
+		manager.Add(eventsub.RedemptionSpecs(cfg.TwitchBroadcasterID)...)
+		receiver.OnEvent(redeemer.HandleEvent)
+	}
+
+	if cfg.ChatEnabled {
+		refreshToken := cfg.ChatRefreshToken
+		if refreshToken == "" {
+			refreshToken = cfg.TwitchBroadcasterRefreshToken
+		}
+		if refreshToken == "" {
+			logger.Error("Chat bridge requires a chat or broadcaster refresh token")
+			os.Exit(1)
+		}
+
+		bridge, err := chat.NewBridge(chat.Config{
+			Bot: b,
+			DB:  svc,
+			TokenSource: twitch.TokenSource(ctx, &oauth2.Token{
+				RefreshToken: refreshToken,
+			}),
+			Login:     cfg.ChatLogin,
+			Channel:   cfg.ChatChannel,
+			ChannelID: cfg.ChatTeamspeakChannel,
+			ToTwitch:  cfg.ChatToTwitch,
+			RateLimit: cfg.ChatRateLimit,
+			Console:   *consoleFlag,
+			Debug:     *debugFlag,
+		})
+		if err != nil {
+			logger.Error("Error initializing chat bridge: %v", err)
+			os.Exit(1)
+		}
+
+		bridge.Subscribe()
+
+		wg.Add(1)
+		go bridge.Run(ctx, wg)
+	}
+
+	wg.Add(2)
 	go b.HandleEvents(ctx, wg)
+	go b.Supervise(ctx, wg)
+
+	var admins, moderators []string
+	for _, id := range strings.Split(cfg.AdminTwitchIDs, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			admins = append(admins, id)
+		}
+	}
+	for _, id := range strings.Split(cfg.ModeratorTwitchIDs, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			moderators = append(moderators, id)
+		}
+	}
+
+	adminGroups, err := access.ParseGroups(cfg.AdminServerGroups)
+	if err != nil {
+		logger.Error("Error parsing admin server groups: %v", err)
+		os.Exit(1)
+	}
+
+	moderatorGroups, err := access.ParseGroups(cfg.ModeratorServerGroups)
+	if err != nil {
+		logger.Error("Error parsing moderator server groups: %v", err)
+		os.Exit(1)
+	}
+
+	accessCfg := access.Config{
+		Bot:             b,
+		DB:              svc,
+		Admins:          admins,
+		Moderators:      moderators,
+		AdminGroups:     adminGroups,
+		ModeratorGroups: moderatorGroups,
+		CacheTTL:        cfg.AccessCacheTTL,
+		Console:         *consoleFlag,
+		Debug:           *debugFlag,
+	}
+
+	if helixClient != nil && cfg.AccessTwitchModerators {
+		accessCfg.Helix = helixClient
+		accessCfg.BroadcasterID = cfg.TwitchBroadcasterID
+	}
+
+	resolver, err := access.NewResolver(accessCfg)
+	if err != nil {
+		logger.Error("Error initializing role resolver: %v", err)
+		os.Exit(1)
+	}
 
 	s := server.NewServer(server.Config{
 		Port:        cfg.APIPort,
 		BackendURL:  cfg.BackendURL,
 		FrontendURL: cfg.FrontendURL,
+		EventSub:    receiver,
+		Access:      resolver,
+		Revoker:     revoker,
+		Roles:       syncer,
 		Console:     *consoleFlag,
 		Debug:       *debugFlag,
+
+		APIKeyRateLimit: cfg.APIKeysRateLimit,
 	})
 
 	if err := s.ApplyMiddlewares(svc, cfg.SecretKey); err != nil {
@@ -180,6 +640,12 @@ func main() {
 	wg.Add(1)
 	go s.Start(ctx, errChan, wg)
 
+	// Twitch verifies new subscriptions via the webhook, so the server needs to run
+	if manager != nil {
+		wg.Add(1)
+		go manager.PeriodicReconcile(ctx, cfg.EventSubReconcileInterval, wg)
+	}
+
 	for {
 		select {
 		case sig := <-stop:
@@ -5,6 +5,7 @@ go 1.21.4
 require (
 	github.com/JGLTechnologies/gin-rate-limit v1.5.4
 	github.com/Masterminds/semver v1.5.0
+	github.com/alicebob/miniredis/v2 v2.37.0
 	github.com/caarlos0/env/v10 v10.0.0
 	github.com/fatih/color v1.16.0
 	github.com/gin-contrib/cors v1.7.1
@@ -63,6 +64,7 @@ require (
 	github.com/twitchyliquid64/golang-asm v0.15.1 // indirect
 	github.com/ugorji/go/codec v1.2.12 // indirect
 	github.com/ulikunitz/xz v0.5.9 // indirect
+	github.com/yuin/gopher-lua v1.1.1 // indirect
 	golang.org/x/arch v0.7.0 // indirect
 	golang.org/x/crypto v0.21.0 // indirect
 	golang.org/x/net v0.22.0 // indirect
@@ -0,0 +1,203 @@
+package access
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/devusSs/twitchspeak/internal/database"
+	"github.com/devusSs/twitchspeak/internal/helix"
+	"github.com/devusSs/twitchspeak/internal/teamspeak"
+	"github.com/devusSs/twitchspeak/pkg/log"
+)
+
+// Config for the role resolver
+type Config struct {
+	Bot *teamspeak.Bot
+	DB  database.Service
+	// Optional, Twitch moderators of the broadcaster become moderators
+	// and the broadcaster an admin
+	Helix         *helix.Client
+	BroadcasterID string
+	// Twitch IDs of admins and moderators
+	Admins     []string
+	Moderators []string
+	// Linked users in one of these server groups become admins or moderators
+	AdminGroups     []int
+	ModeratorGroups []int
+	// How long resolved roles are cached
+	CacheTTL time.Duration
+	Console  bool
+	Debug    bool
+}
+
+// Resolver resolves the role of Twitch users on the HTTP API,
+// every logged in user is at least a viewer
+type Resolver struct {
+	bot             *teamspeak.Bot
+	db              database.Service
+	helix           *helix.Client
+	broadcasterID   string
+	admins          []string
+	moderators      []string
+	adminGroups     []int
+	moderatorGroups []int
+	cacheTTL        time.Duration
+	logger          *log.Logger
+
+	mu    sync.Mutex
+	cache map[string]cachedRole
+}
+
+type cachedRole struct {
+	role    Role
+	expires time.Time
+}
+
+// Resolve returns the most privileged role the Twitch user gets
+// from the allowlists, the broadcaster's moderators or their server groups
+//
+// Sources which fail are logged and skipped, results are only cached
+// if all sources succeeded
+func (r *Resolver) Resolve(ctx context.Context, twitchID string) Role {
+	r.mu.Lock()
+	cached, ok := r.cache[twitchID]
+	r.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.role
+	}
+
+	role, err := r.resolve(ctx, twitchID)
+	if err != nil {
+		r.logger.Warn("Error resolving role of %s, using %s: %v", twitchID, role, err)
+		return role
+	}
+
+	r.mu.Lock()
+	r.cache[twitchID] = cachedRole{role: role, expires: time.Now().Add(r.cacheTTL)}
+	r.mu.Unlock()
+
+	r.logger.Debug("resolved role of %s: %s", twitchID, role)
+
+	return role
+}
+
+// Resolves the role without using the cache, returns the role
+// from the sources which succeeded along with the errors of the others
+func (r *Resolver) resolve(ctx context.Context, twitchID string) (Role, error) {
+	if twitchID == r.broadcasterID || slices.Contains(r.admins, twitchID) {
+		return Admin, nil
+	}
+
+	role := Viewer
+	if slices.Contains(r.moderators, twitchID) {
+		role = Moderator
+	}
+
+	var errs []error
+
+	if len(r.adminGroups) > 0 || len(r.moderatorGroups) > 0 {
+		groupRole, err := r.groupRole(twitchID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("server groups: %w", err))
+		}
+		if groupRole.Includes(role) {
+			role = groupRole
+		}
+	}
+
+	if r.helix != nil && !role.Includes(Moderator) {
+		mods, err := r.helix.GetModerators(ctx, r.broadcasterID, []string{twitchID})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("twitch moderators: %w", err))
+		}
+		if mods[twitchID] {
+			role = Moderator
+		}
+	}
+
+	return role, errors.Join(errs...)
+}
+
+// Returns the role granted by the server groups of the linked user
+func (r *Resolver) groupRole(twitchID string) (Role, error) {
+	user, err := r.db.GetUserByTwitchID(twitchID)
+	if errors.Is(err, database.ErrNotFound) {
+		return Viewer, nil
+	}
+	if err != nil {
+		return Viewer, err
+	}
+	if user.Revoked() {
+		return Viewer, nil
+	}
+
+	groups, err := r.bot.ServerGroupsByUID(user.TeamSpeakUID)
+	if err != nil {
+		return Viewer, err
+	}
+
+	for _, group := range groups {
+		if slices.Contains(r.adminGroups, group) {
+			return Admin, nil
+		}
+	}
+
+	for _, group := range groups {
+		if slices.Contains(r.moderatorGroups, group) {
+			return Moderator, nil
+		}
+	}
+
+	return Viewer, nil
+}
+
+// NewResolver creates a new role resolver
+func NewResolver(cfg Config) (*Resolver, error) {
+	if cfg.Bot == nil {
+		return nil, fmt.Errorf("access: bot is nil")
+	}
+
+	if cfg.DB == nil {
+		return nil, fmt.Errorf("access: database service is nil")
+	}
+
+	if cfg.Helix != nil && cfg.BroadcasterID == "" {
+		return nil, fmt.Errorf("access: broadcaster id is empty")
+	}
+
+	logger := log.NewLogger(
+		log.WithOwnLogFile("access.log"),
+		log.WithName("access"),
+		log.WithConsole(cfg.Console),
+		log.WithDebug(cfg.Debug),
+	)
+
+	r := &Resolver{
+		bot:             cfg.Bot,
+		db:              cfg.DB,
+		helix:           cfg.Helix,
+		broadcasterID:   cfg.BroadcasterID,
+		admins:          cfg.Admins,
+		moderators:      cfg.Moderators,
+		adminGroups:     cfg.AdminGroups,
+		moderatorGroups: cfg.ModeratorGroups,
+		cacheTTL:        cfg.CacheTTL,
+		logger:          logger,
+		cache:           make(map[string]cachedRole),
+	}
+
+	r.logger.Info(
+		"Role resolver initialized with %d admins, %d moderators, admin groups %v, moderator groups %v, twitch moderators: %v",
+		len(cfg.Admins),
+		len(cfg.Moderators),
+		cfg.AdminGroups,
+		cfg.ModeratorGroups,
+		cfg.Helix != nil,
+	)
+
+	return r, nil
+}
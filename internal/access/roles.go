@@ -0,0 +1,138 @@
+package access
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Role of a logged in Twitch user on the HTTP API,
+// every role includes the permissions of the roles below it
+type Role string
+
+// Supported roles, ordered from least to most privileged
+const (
+	Viewer    Role = "viewer"
+	Moderator Role = "moderator"
+	Admin     Role = "admin"
+)
+
+// Roles lists all supported roles from least to most privileged
+var Roles = []Role{
+	Viewer,
+	Moderator,
+	Admin,
+}
+
+// Includes returns whether the role is at least as privileged as other
+func (r Role) Includes(other Role) bool {
+	return slices.Index(Roles, r) >= slices.Index(Roles, other)
+}
+
+// Permission allows using a set of API routes
+type Permission string
+
+// Supported permissions
+const (
+	// Own user, link codes and grants
+	PermSelf        Permission = "self"
+	PermUsersRead   Permission = "users:read"
+	PermUsersSync   Permission = "users:sync"
+	PermUsersUnlink Permission = "users:unlink"
+	PermLinksWrite  Permission = "links:write"
+	PermRulesRead   Permission = "rules:read"
+	PermRulesWrite  Permission = "rules:write"
+)
+
+// Permissions lists all supported permissions
+var Permissions = []Permission{
+	PermSelf,
+	PermUsersRead,
+	PermUsersSync,
+	PermUsersUnlink,
+	PermLinksWrite,
+	PermRulesRead,
+	PermRulesWrite,
+}
+
+// Valid returns whether the permission is supported
+func (p Permission) Valid() bool {
+	return slices.Contains(Permissions, p)
+}
+
+// ParsePermissions parses a comma separated list of permissions
+func ParsePermissions(s string) ([]Permission, error) {
+	var perms []Permission
+
+	for _, part := range strings.Split(s, ",") {
+		perm := Permission(strings.TrimSpace(part))
+		if perm == "" {
+			continue
+		}
+
+		if !perm.Valid() {
+			return nil, fmt.Errorf("access: unknown permission %q", perm)
+		}
+
+		if !slices.Contains(perms, perm) {
+			perms = append(perms, perm)
+		}
+	}
+
+	return perms, nil
+}
+
+// Permissions granted to each role on top of those of the roles below it
+var grants = map[Role][]Permission{
+	Viewer: {
+		PermSelf,
+	},
+	Moderator: {
+		PermUsersRead,
+		PermUsersSync,
+		PermRulesRead,
+	},
+	Admin: {
+		PermUsersUnlink,
+		PermLinksWrite,
+		PermRulesWrite,
+	},
+}
+
+// Permissions returns the effective permissions of the role
+func (r Role) Permissions() []Permission {
+	var perms []Permission
+	for _, role := range Roles {
+		if r.Includes(role) {
+			perms = append(perms, grants[role]...)
+		}
+	}
+	return perms
+}
+
+// Can returns whether the role grants the permission
+func (r Role) Can(perm Permission) bool {
+	return slices.Contains(r.Permissions(), perm)
+}
+
+// ParseGroups parses a comma separated list of server group IDs
+func ParseGroups(s string) ([]int, error) {
+	var groups []int
+
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		id, err := strconv.Atoi(part)
+		if err != nil || id <= 0 {
+			return nil, fmt.Errorf("access: invalid server group %q", part)
+		}
+
+		groups = append(groups, id)
+	}
+
+	return groups, nil
+}
@@ -0,0 +1,49 @@
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+// Generate creates a new random API key, returns the key,
+// its prefix (safe to show) and its hash (safe to store)
+//
+// Keys are in the form of tsk_base64url(32 random bytes)
+func Generate() (key string, prefix string, hash string, err error) {
+	b := make([]byte, keyBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", "", fmt.Errorf("apikey: generating key: %w", err)
+	}
+
+	key = keyPrefix + base64.RawURLEncoding.EncodeToString(b)
+
+	return key, Prefix(key), Hash(key), nil
+}
+
+// Prefix returns the first characters of the key,
+// which identify it without allowing its use
+func Prefix(key string) string {
+	if len(key) <= prefixLength {
+		return key
+	}
+	return key[:prefixLength]
+}
+
+// Hash returns the hex encoded SHA-256 hash of the key
+//
+// Keys carry enough entropy that a plain hash can not be brute forced,
+// which allows looking them up by their hash
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+const (
+	keyPrefix = "tsk_"
+	keyBytes  = 32
+	// Key prefix and 8 random characters
+	prefixLength = len(keyPrefix) + 8
+)
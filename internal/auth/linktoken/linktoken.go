@@ -0,0 +1,158 @@
+package linktoken
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/devusSs/twitchspeak/internal/database/redis"
+)
+
+// Custom errors
+var (
+	ErrInvalid = errors.New("linktoken: invalid token")
+	ErrExpired = errors.New("linktoken: token expired")
+	ErrUsed    = errors.New("linktoken: token already used")
+)
+
+// Claims carried by a link token
+type Claims struct {
+	// TeamSpeak unique identifier the token was issued for
+	UID string `json:"uid"`
+	// Unix timestamp the token expires at
+	Exp int64 `json:"exp"`
+	// Random token ID used to detect reuse
+	JTI string `json:"jti"`
+}
+
+// Signer issues and verifies short-lived link tokens
+// which prove ownership of a TeamSpeak identity
+//
+// Tokens are in the form of base64url(claims).base64url(hmac-sha256(claims))
+type Signer struct {
+	key []byte
+	ttl time.Duration
+}
+
+// Issue creates a new token for the TeamSpeak unique identifier
+func (s *Signer) Issue(uid string) (string, error) {
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", fmt.Errorf("linktoken: generating token id: %w", err)
+	}
+
+	payload, err := json.Marshal(Claims{
+		UID: uid,
+		Exp: time.Now().Add(s.ttl).Unix(),
+		JTI: hex.EncodeToString(jti),
+	})
+	if err != nil {
+		return "", fmt.Errorf("linktoken: marshalling claims: %w", err)
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(s.sign(encoded)), nil
+}
+
+// Verify checks the signature and expiry of a token and returns its claims
+//
+// Does not check whether the token has been used before, see Consume
+func (s *Signer) Verify(token string) (*Claims, error) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvalid
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return nil, ErrInvalid
+	}
+
+	if !hmac.Equal(sig, s.sign(encoded)) {
+		return nil, ErrInvalid
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalid
+	}
+
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrInvalid
+	}
+
+	if claims.UID == "" || claims.JTI == "" {
+		return nil, ErrInvalid
+	}
+
+	if time.Now().After(time.Unix(claims.Exp, 0)) {
+		return nil, ErrExpired
+	}
+
+	return &claims, nil
+}
+
+// Consume verifies a token and marks it as used in redis,
+// returns ErrUsed if the token has been consumed before
+func (s *Signer) Consume(ctx context.Context, token string) (*Claims, error) {
+	claims, err := s.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the marker until the token expires anyway
+	ttl := time.Until(time.Unix(claims.Exp, 0)) + time.Minute
+
+	ok, err := redis.GetClient().SetNX(ctx, "twitchspeak:linktoken:used:"+claims.JTI, 1, ttl).Result()
+	if err != nil {
+		return nil, fmt.Errorf("linktoken: marking token as used: %w", err)
+	}
+	if !ok {
+		return nil, ErrUsed
+	}
+
+	return claims, nil
+}
+
+func (s *Signer) sign(encoded string) []byte {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
+
+// NewSigner creates a new signer with a key derived from secret
+//
+// Tokens are valid for ttl, defaults to 15 minutes if 0
+func NewSigner(secret string, ttl time.Duration) (*Signer, error) {
+	if secret == "" {
+		return nil, errors.New("linktoken: secret is empty")
+	}
+
+	if ttl <= 0 {
+		ttl = defaultTTL
+	}
+
+	// Derive a dedicated key so the secret itself is never used for signing
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(keyContext))
+
+	return &Signer{
+		key: mac.Sum(nil),
+		ttl: ttl,
+	}, nil
+}
+
+const (
+	defaultTTL = 15 * time.Minute
+	keyContext = "twitchspeak link tokens v1"
+)
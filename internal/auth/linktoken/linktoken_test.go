@@ -0,0 +1,226 @@
+package linktoken
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"github.com/devusSs/twitchspeak/internal/database/redis"
+)
+
+const testSecret = "s3cre7-link-token-secret"
+
+func newTestSigner(t *testing.T, ttl time.Duration) *Signer {
+	t.Helper()
+
+	s, err := NewSigner(testSecret, ttl)
+	if err != nil {
+		t.Fatalf("creating signer: %v", err)
+	}
+	return s
+}
+
+// Creates a token with arbitrary claims signed with the key of secret
+func forge(t *testing.T, secret string, claims any) string {
+	t.Helper()
+
+	s, err := NewSigner(secret, 0)
+	if err != nil {
+		t.Fatalf("creating signer: %v", err)
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("marshalling claims: %v", err)
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(s.sign(encoded))
+}
+
+func TestNewSigner(t *testing.T) {
+	if _, err := NewSigner("", time.Minute); err == nil {
+		t.Fatal("expected an error for an empty secret")
+	}
+
+	s := newTestSigner(t, 0)
+	if s.ttl != defaultTTL {
+		t.Fatalf("ttl = %s, want %s", s.ttl, defaultTTL)
+	}
+
+	// The secret itself must not be used as key
+	if hmac.Equal(s.key, []byte(testSecret)) {
+		t.Fatal("key equals the secret")
+	}
+}
+
+func TestIssueVerify(t *testing.T) {
+	s := newTestSigner(t, time.Minute)
+
+	token, err := s.Issue("uid=")
+	if err != nil {
+		t.Fatalf("issuing token: %v", err)
+	}
+
+	claims, err := s.Verify(token)
+	if err != nil {
+		t.Fatalf("verifying token: %v", err)
+	}
+
+	if claims.UID != "uid=" {
+		t.Fatalf("uid = %q, want %q", claims.UID, "uid=")
+	}
+	if len(claims.JTI) != 32 {
+		t.Fatalf("jti = %q, want 32 hex characters", claims.JTI)
+	}
+	if exp := time.Unix(claims.Exp, 0); exp.Before(time.Now()) || exp.After(time.Now().Add(time.Minute+time.Second)) {
+		t.Fatalf("exp = %s, want about a minute from now", exp)
+	}
+
+	other, err := s.Issue("uid=")
+	if err != nil {
+		t.Fatalf("issuing second token: %v", err)
+	}
+	if other == token {
+		t.Fatal("issued the same token twice")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	s := newTestSigner(t, time.Minute)
+
+	valid, err := s.Issue("uid=")
+	if err != nil {
+		t.Fatalf("issuing token: %v", err)
+	}
+	payload, signature, _ := strings.Cut(valid, ".")
+
+	future := time.Now().Add(time.Minute).Unix()
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{"valid", valid, nil},
+		{"expired", forge(t, testSecret, Claims{UID: "uid=", Exp: time.Now().Add(-time.Second).Unix(), JTI: "jti"}), ErrExpired},
+		{"signed with other secret", forge(t, "other-secret", Claims{UID: "uid=", Exp: future, JTI: "jti"}), ErrInvalid},
+		{
+			"tampered claims",
+			base64.RawURLEncoding.EncodeToString([]byte(`{"uid":"other=","exp":`+strconv.FormatInt(future, 10)+`,"jti":"jti"}`)) + "." + signature,
+			ErrInvalid,
+		},
+		{"tampered signature", payload + "." + base64.RawURLEncoding.EncodeToString([]byte("signature")), ErrInvalid},
+		{"missing signature", payload, ErrInvalid},
+		{"invalid signature encoding", payload + ".!!!", ErrInvalid},
+		{"empty", "", ErrInvalid},
+		{"missing uid", forge(t, testSecret, Claims{Exp: future, JTI: "jti"}), ErrInvalid},
+		{"missing jti", forge(t, testSecret, Claims{UID: "uid=", Exp: future}), ErrInvalid},
+		{"not json", forge(t, testSecret, "claims"), ErrInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := s.Verify(tt.token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && claims.UID != "uid=" {
+				t.Fatalf("uid = %q, want %q", claims.UID, "uid=")
+			}
+		})
+	}
+}
+
+func TestConsume(t *testing.T) {
+	mr := miniredis.RunT(t)
+
+	host, port, err := net.SplitHostPort(mr.Addr())
+	if err != nil {
+		t.Fatalf("splitting redis address: %v", err)
+	}
+	p, err := strconv.ParseUint(port, 10, 0)
+	if err != nil {
+		t.Fatalf("parsing redis port: %v", err)
+	}
+	if err := redis.Init(redis.Config{Host: host, Port: uint(p)}); err != nil {
+		t.Fatalf("connecting to redis: %v", err)
+	}
+
+	s := newTestSigner(t, time.Minute)
+	ctx := context.Background()
+
+	token, err := s.Issue("uid=")
+	if err != nil {
+		t.Fatalf("issuing token: %v", err)
+	}
+
+	claims, err := s.Consume(ctx, token)
+	if err != nil {
+		t.Fatalf("consuming token: %v", err)
+	}
+	if claims.UID != "uid=" {
+		t.Fatalf("uid = %q, want %q", claims.UID, "uid=")
+	}
+
+	if _, err := s.Consume(ctx, token); !errors.Is(err, ErrUsed) {
+		t.Fatalf("err = %v, want %v when reusing a token", err, ErrUsed)
+	}
+
+	// The marker outlives the token
+	if ttl := mr.TTL("twitchspeak:linktoken:used:" + claims.JTI); ttl < time.Minute {
+		t.Fatalf("marker ttl = %s, want at least a minute", ttl)
+	}
+
+	// Other tokens of the same identity are not affected
+	other, err := s.Issue("uid=")
+	if err != nil {
+		t.Fatalf("issuing second token: %v", err)
+	}
+	if _, err := s.Consume(ctx, other); err != nil {
+		t.Fatalf("consuming second token: %v", err)
+	}
+
+	// Invalid tokens are rejected before being marked
+	expired := forge(t, testSecret, Claims{UID: "uid=", Exp: time.Now().Add(-time.Second).Unix(), JTI: "expired"})
+	if _, err := s.Consume(ctx, expired); !errors.Is(err, ErrExpired) {
+		t.Fatalf("err = %v, want %v for an expired token", err, ErrExpired)
+	}
+	if mr.Exists("twitchspeak:linktoken:used:expired") {
+		t.Fatal("expired token has been marked as used")
+	}
+}
+
+// Guards against accidentally changing the token format,
+// tokens issued before a restart need to stay valid
+func TestSignatureFormat(t *testing.T) {
+	s := newTestSigner(t, time.Minute)
+
+	mac := hmac.New(sha256.New, []byte(testSecret))
+	mac.Write([]byte(keyContext))
+	key := mac.Sum(nil)
+
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(`{"uid":"uid=","exp":4102444800,"jti":"jti"}`))
+
+	sig := hmac.New(sha256.New, key)
+	sig.Write([]byte(encoded))
+	token := encoded + "." + base64.RawURLEncoding.EncodeToString(sig.Sum(nil))
+
+	claims, err := s.Verify(token)
+	if err != nil {
+		t.Fatalf("verifying token: %v", err)
+	}
+	if claims.UID != "uid=" || claims.JTI != "jti" || claims.Exp != 4102444800 {
+		t.Fatalf("claims = %+v", claims)
+	}
+}
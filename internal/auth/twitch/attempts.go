@@ -0,0 +1,100 @@
+package twitch
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	goredis "github.com/redis/go-redis/v9"
+
+	"github.com/devusSs/twitchspeak/internal/database/redis"
+)
+
+// Custom errors
+var (
+	errAttemptNotFound = errors.New("twitch: login attempt not found or expired")
+)
+
+// A login attempt started on the login route and
+// finished on the redirect route, keyed by its state
+type loginAttempt struct {
+	Nonce        string `json:"nonce"`
+	TeamSpeakUID string `json:"ts_uid"`
+	// PKCE code verifier, empty if PKCE is disabled
+	Verifier string `json:"verifier,omitempty"`
+}
+
+// Stores a login attempt in redis, it expires after loginAttemptTTL
+func saveLoginAttempt(ctx context.Context, state string, attempt loginAttempt) error {
+	data, err := json.Marshal(attempt)
+	if err != nil {
+		return fmt.Errorf("twitch: marshalling login attempt: %w", err)
+	}
+
+	err = redis.GetClient().Set(ctx, loginAttemptKey(state), data, loginAttemptTTL).Err()
+	if err != nil {
+		return fmt.Errorf("twitch: storing login attempt: %w", err)
+	}
+
+	return nil
+}
+
+// Gets and deletes the login attempt with the given state,
+// each attempt can only be used once
+func takeLoginAttempt(ctx context.Context, state string) (*loginAttempt, error) {
+	if state == "" {
+		return nil, errAttemptNotFound
+	}
+
+	data, err := redis.GetClient().GetDel(ctx, loginAttemptKey(state)).Bytes()
+	if errors.Is(err, goredis.Nil) {
+		return nil, errAttemptNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("twitch: getting login attempt: %w", err)
+	}
+
+	var attempt loginAttempt
+	if err := json.Unmarshal(data, &attempt); err != nil {
+		return nil, fmt.Errorf("twitch: unmarshalling login attempt: %w", err)
+	}
+
+	return &attempt, nil
+}
+
+// Binds the state to the browser which started the login,
+// so nobody can complete a login attempt by sending someone the callback url
+func setStateCookie(c *gin.Context, state string) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(stateCookieName, state, int(loginAttemptTTL.Seconds()), "/", "", secureCookies, true)
+}
+
+// Checks whether the state is bound to the browser,
+// the binding is cleared once it matched
+func checkStateCookie(c *gin.Context, state string) bool {
+	bound, err := c.Cookie(stateCookieName)
+	if err != nil || bound == "" || state == "" {
+		return false
+	}
+	if subtle.ConstantTimeCompare([]byte(bound), []byte(state)) != 1 {
+		return false
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(stateCookieName, "", -1, "/", "", secureCookies, true)
+	return true
+}
+
+func loginAttemptKey(state string) string {
+	return "twitchspeak:oauth:state:" + state
+}
+
+const (
+	loginAttemptTTL = 10 * time.Minute
+	stateCookieName = "twitchspeak_oauth_state"
+)
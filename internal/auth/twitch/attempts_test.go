@@ -0,0 +1,127 @@
+package twitch
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/oauth2"
+
+	"github.com/devusSs/twitchspeak/internal/database/redis"
+)
+
+func setupLogin(t *testing.T) (*miniredis.Miniredis, *gin.Engine) {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+
+	mr := miniredis.RunT(t)
+	host, port, err := net.SplitHostPort(mr.Addr())
+	if err != nil {
+		t.Fatalf("splitting redis address: %v", err)
+	}
+	p, err := strconv.ParseUint(port, 10, 0)
+	if err != nil {
+		t.Fatalf("parsing redis port: %v", err)
+	}
+	if err := redis.Init(redis.Config{Host: host, Port: uint(p)}); err != nil {
+		t.Fatalf("connecting to redis: %v", err)
+	}
+
+	oldConfig := oauthConfig
+	t.Cleanup(func() { oauthConfig = oldConfig })
+	oauthConfig = &oauth2.Config{
+		ClientID:    testClientID,
+		RedirectURL: "http://localhost:8080/auth/redirect",
+		Endpoint:    oauth2.Endpoint{AuthURL: "https://id.example.com/authorize"},
+	}
+
+	engine := gin.New()
+	engine.Use(sessions.Sessions("twitchspeak", cookie.NewStore([]byte("secret"))))
+	engine.GET("/login", HandleLoginRoute)
+	engine.GET("/redirect", HandleRedirectRoute)
+
+	return mr, engine
+}
+
+func TestLoginBindsState(t *testing.T) {
+	mr, engine := setupLogin(t)
+
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/login", nil))
+
+	if rec.Code != http.StatusTemporaryRedirect {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusTemporaryRedirect)
+	}
+
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("parsing location: %v", err)
+	}
+	state := location.Query().Get("state")
+	if !mr.Exists(loginAttemptKey(state)) {
+		t.Fatal("login attempt has not been stored")
+	}
+
+	var bound *http.Cookie
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == stateCookieName {
+			bound = c
+		}
+	}
+	if bound == nil {
+		t.Fatal("state cookie has not been set")
+	}
+	if bound.Value != state || !bound.HttpOnly || bound.SameSite != http.SameSiteLaxMode {
+		t.Fatalf("state cookie = %+v, want the state as HttpOnly SameSite=Lax cookie", bound)
+	}
+}
+
+func TestRedirectRequiresBoundState(t *testing.T) {
+	tests := []struct {
+		name   string
+		cookie string
+		// Whether the attempt got past the state check and was used
+		wantTaken bool
+	}{
+		{name: "missing cookie"},
+		{name: "other state", cookie: "other-state"},
+		{name: "matching state", cookie: "state", wantTaken: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mr, engine := setupLogin(t)
+
+			if err := saveLoginAttempt(context.Background(), "state", loginAttempt{Nonce: testNonce}); err != nil {
+				t.Fatalf("saving login attempt: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/redirect?state=state&code=code", nil)
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: stateCookieName, Value: tt.cookie})
+			}
+
+			rec := httptest.NewRecorder()
+			engine.ServeHTTP(rec, req)
+
+			if taken := !mr.Exists(loginAttemptKey("state")); taken != tt.wantTaken {
+				t.Fatalf("attempt taken = %v, want %v", taken, tt.wantTaken)
+			}
+			if !tt.wantTaken {
+				if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "invalid_state") {
+					t.Fatalf("response = %d %q, want 400 invalid_state", rec.Code, rec.Body.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package twitch
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/devusSs/twitchspeak/internal/httplib"
+	"github.com/devusSs/twitchspeak/pkg/log"
+)
+
+// Custom errors
+var (
+	ErrInvalidIDToken = errors.New("twitch: invalid id token")
+	ErrInvalidNonce   = errors.New("twitch: nonce does not match")
+)
+
+// Claims of a verified OpenID Connect id token
+type idTokenClaims struct {
+	Aud               audience `json:"aud"`
+	Azp               string   `json:"azp"`
+	Exp               int64    `json:"exp"`
+	Iat               int64    `json:"iat"`
+	Iss               string   `json:"iss"`
+	Sub               string   `json:"sub"`
+	Nonce             string   `json:"nonce"`
+	PreferredUsername string   `json:"preferred_username"`
+}
+
+// The aud claim may either be a single string or a list of strings
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+	*a = multiple
+	return nil
+}
+
+func (a audience) contains(aud string) bool {
+	for _, v := range a {
+		if v == aud {
+			return true
+		}
+	}
+	return false
+}
+
+// Verifies the signature and claims of a raw id token
+// and returns its claims
+func verifyIDToken(ctx context.Context, raw string, nonce string) (*idTokenClaims, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidIDToken)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: decoding header: %v", ErrInvalidIDToken, err)
+	}
+
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidIDToken, header.Alg)
+	}
+
+	key, err := keys.get(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: decoding signature: %v", ErrInvalidIDToken, err)
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, fmt.Errorf("%w: invalid signature", ErrInvalidIDToken)
+	}
+
+	var claims idTokenClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: decoding claims: %v", ErrInvalidIDToken, err)
+	}
+
+	now := time.Now()
+
+	switch {
+	case claims.Iss != issuerURL:
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidIDToken, claims.Iss)
+	case !claims.Aud.contains(oauthConfig.ClientID):
+		return nil, fmt.Errorf("%w: unexpected audience %v", ErrInvalidIDToken, claims.Aud)
+	case len(claims.Aud) > 1 && claims.Azp != oauthConfig.ClientID:
+		return nil, fmt.Errorf("%w: unexpected authorized party %q", ErrInvalidIDToken, claims.Azp)
+	case now.Add(-clockSkew).After(time.Unix(claims.Exp, 0)):
+		return nil, fmt.Errorf("%w: token expired", ErrInvalidIDToken)
+	case now.Add(clockSkew).Before(time.Unix(claims.Iat, 0)):
+		return nil, fmt.Errorf("%w: token issued in the future", ErrInvalidIDToken)
+	case claims.Sub == "":
+		return nil, fmt.Errorf("%w: subject is empty", ErrInvalidIDToken)
+	case claims.Nonce == "" || claims.Nonce != nonce:
+		return nil, ErrInvalidNonce
+	}
+
+	return &claims, nil
+}
+
+// Decodes a base64url encoded json segment of a token into v
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Caches the public keys of the JSON Web Key Set
+type keySet struct {
+	mu        sync.Mutex
+	url       string
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+	logger    *log.Logger
+}
+
+// Returns the key with the given ID, refetches the key set
+// if the key is unknown (keys may have been rotated) or the cache is stale,
+// stale keys are still used if refetching fails
+func (k *keySet) get(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	key, ok := k.keys[kid]
+	stale := time.Since(k.fetchedAt) > keySetMaxAge
+	if ok && !stale {
+		return key, nil
+	}
+
+	// Do not hammer the endpoint with tokens carrying unknown key IDs
+	if !ok && !stale && time.Since(k.fetchedAt) < keySetMinRefetch {
+		return nil, fmt.Errorf("%w: unknown key id %q", ErrInvalidIDToken, kid)
+	}
+
+	if err := k.fetch(ctx); err != nil {
+		if !ok {
+			return nil, err
+		}
+
+		// A cached key is better than failing every login while the
+		// endpoint is unavailable, retry once the refetch interval passed
+		k.logger.Warn("Error refreshing key set, using cached key %q: %v", kid, err)
+		k.fetchedAt = time.Now().Add(keySetMinRefetch - keySetMaxAge)
+		return key, nil
+	}
+
+	key, ok = k.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown key id %q", ErrInvalidIDToken, kid)
+	}
+
+	return key, nil
+}
+
+// Fetches and parses the key set, caller needs to hold the lock
+func (k *keySet) fetch(ctx context.Context) error {
+	var resp struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+
+	if err := httplib.Get(ctx, k.url, &resp); err != nil {
+		return fmt.Errorf("twitch: fetching key set: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(resp.Keys))
+	for _, jwk := range resp.Keys {
+		if jwk.Kty != "RSA" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return fmt.Errorf("twitch: decoding key modulus: %w", err)
+		}
+
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return fmt.Errorf("twitch: decoding key exponent: %w", err)
+		}
+
+		keys[jwk.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	k.keys = keys
+	k.fetchedAt = time.Now()
+
+	return nil
+}
+
+const (
+	defaultIssuerURL = "https://id.twitch.tv/oauth2"
+	defaultJWKSURL   = "https://id.twitch.tv/oauth2/keys"
+
+	// Allowed clock difference when checking exp and iat
+	clockSkew        = time.Minute
+	keySetMaxAge     = 24 * time.Hour
+	keySetMinRefetch = time.Minute
+)
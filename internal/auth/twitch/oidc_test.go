@@ -0,0 +1,435 @@
+package twitch
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/devusSs/twitchspeak/pkg/log"
+)
+
+const (
+	testClientID = "test-client-id"
+	testNonce    = "test-nonce"
+)
+
+// Serves a JSON Web Key Set and counts how often it was fetched
+type jwksServer struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	keys    map[string]*rsa.PublicKey
+	fetches int
+	// Answers with an error while set
+	failing bool
+}
+
+func newJWKSServer(t *testing.T) *jwksServer {
+	t.Helper()
+
+	s := &jwksServer{keys: make(map[string]*rsa.PublicKey)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.fetches++
+
+		if s.failing {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		type jwk struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			Alg string `json:"alg"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		}
+
+		var resp struct {
+			Keys []jwk `json:"keys"`
+		}
+		for kid, key := range s.keys {
+			resp.Keys = append(resp.Keys, jwk{
+				Kty: "RSA",
+				Kid: kid,
+				Use: "sig",
+				Alg: "RS256",
+				N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func (s *jwksServer) add(kid string, key *rsa.PrivateKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[kid] = &key.PublicKey
+}
+
+func (s *jwksServer) setFailing(failing bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failing = failing
+}
+
+func (s *jwksServer) fetchCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fetches
+}
+
+// Points the package configuration at the key set server,
+// restores the previous configuration once the test is done
+func setupOIDC(t *testing.T, server *jwksServer) {
+	t.Helper()
+
+	oldKeys, oldConfig, oldIssuer := keys, oauthConfig, issuerURL
+	t.Cleanup(func() {
+		keys, oauthConfig, issuerURL = oldKeys, oldConfig, oldIssuer
+	})
+
+	log.SetDefaultLogsDirectory(t.TempDir())
+	keys = &keySet{url: server.URL, logger: log.NewLogger(log.WithOwnLogFile("twitch.log"))}
+	oauthConfig = &oauth2.Config{ClientID: testClientID}
+	issuerURL = defaultIssuerURL
+}
+
+func generateKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	return key
+}
+
+// Creates a token with the header and claims signed by key using RS256
+func signToken(t *testing.T, key *rsa.PrivateKey, header map[string]any, claims map[string]any) string {
+	t.Helper()
+
+	encode := func(v any) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatalf("marshalling segment: %v", err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+
+	signed := encode(header) + "." + encode(claims)
+
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("signing token: %v", err)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func validClaims() map[string]any {
+	now := time.Now()
+	return map[string]any{
+		"iss":                defaultIssuerURL,
+		"aud":                testClientID,
+		"sub":                "1337",
+		"exp":                now.Add(time.Hour).Unix(),
+		"iat":                now.Unix(),
+		"nonce":              testNonce,
+		"preferred_username": "cool_user",
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	server := newJWKSServer(t)
+	key := generateKey(t)
+	other := generateKey(t)
+	server.add("key-1", key)
+
+	header := map[string]any{"alg": "RS256", "typ": "JWT", "kid": "key-1"}
+
+	with := func(changes map[string]any) map[string]any {
+		claims := validClaims()
+		for k, v := range changes {
+			if v == nil {
+				delete(claims, k)
+				continue
+			}
+			claims[k] = v
+		}
+		return claims
+	}
+
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		token   func() string
+		wantErr error
+	}{
+		{
+			name:  "valid",
+			token: func() string { return signToken(t, key, header, validClaims()) },
+		},
+		{
+			name: "audience list with matching authorized party",
+			token: func() string {
+				return signToken(t, key, header, with(map[string]any{"aud": []string{"other", testClientID}, "azp": testClientID}))
+			},
+		},
+		{
+			name: "audience list with single entry",
+			token: func() string {
+				return signToken(t, key, header, with(map[string]any{"aud": []string{testClientID}}))
+			},
+		},
+		{
+			name: "expired within clock skew",
+			token: func() string {
+				return signToken(t, key, header, with(map[string]any{"exp": now.Add(-clockSkew / 2).Unix()}))
+			},
+		},
+		{
+			name: "audience list with other authorized party",
+			token: func() string {
+				return signToken(t, key, header, with(map[string]any{"aud": []string{"other", testClientID}, "azp": "other"}))
+			},
+			wantErr: ErrInvalidIDToken,
+		},
+		{
+			name: "audience list without authorized party",
+			token: func() string {
+				return signToken(t, key, header, with(map[string]any{"aud": []string{"other", testClientID}}))
+			},
+			wantErr: ErrInvalidIDToken,
+		},
+		{
+			name:    "other audience",
+			token:   func() string { return signToken(t, key, header, with(map[string]any{"aud": "other"})) },
+			wantErr: ErrInvalidIDToken,
+		},
+		{
+			name: "other issuer",
+			token: func() string {
+				return signToken(t, key, header, with(map[string]any{"iss": "https://evil.example.com"}))
+			},
+			wantErr: ErrInvalidIDToken,
+		},
+		{
+			name: "expired",
+			token: func() string {
+				return signToken(t, key, header, with(map[string]any{"exp": now.Add(-2 * clockSkew).Unix()}))
+			},
+			wantErr: ErrInvalidIDToken,
+		},
+		{
+			name:    "missing expiry",
+			token:   func() string { return signToken(t, key, header, with(map[string]any{"exp": nil})) },
+			wantErr: ErrInvalidIDToken,
+		},
+		{
+			name: "issued in the future",
+			token: func() string {
+				return signToken(t, key, header, with(map[string]any{"iat": now.Add(2 * clockSkew).Unix()}))
+			},
+			wantErr: ErrInvalidIDToken,
+		},
+		{
+			name:    "empty subject",
+			token:   func() string { return signToken(t, key, header, with(map[string]any{"sub": ""})) },
+			wantErr: ErrInvalidIDToken,
+		},
+		{
+			name:    "other nonce",
+			token:   func() string { return signToken(t, key, header, with(map[string]any{"nonce": "other"})) },
+			wantErr: ErrInvalidNonce,
+		},
+		{
+			name:    "missing nonce",
+			token:   func() string { return signToken(t, key, header, with(map[string]any{"nonce": nil})) },
+			wantErr: ErrInvalidNonce,
+		},
+		{
+			name:    "signed with other key",
+			token:   func() string { return signToken(t, other, header, validClaims()) },
+			wantErr: ErrInvalidIDToken,
+		},
+		{
+			name: "tampered claims",
+			token: func() string {
+				parts := strings.Split(signToken(t, key, header, validClaims()), ".")
+				tampered := strings.Split(signToken(t, key, header, with(map[string]any{"sub": "42"})), ".")
+				return parts[0] + "." + tampered[1] + "." + parts[2]
+			},
+			wantErr: ErrInvalidIDToken,
+		},
+		{
+			name: "unsupported algorithm",
+			token: func() string {
+				return signToken(t, key, map[string]any{"alg": "HS256", "kid": "key-1"}, validClaims())
+			},
+			wantErr: ErrInvalidIDToken,
+		},
+		{
+			name: "no algorithm",
+			token: func() string {
+				parts := strings.Split(signToken(t, key, map[string]any{"alg": "none", "kid": "key-1"}, validClaims()), ".")
+				return parts[0] + "." + parts[1] + "."
+			},
+			wantErr: ErrInvalidIDToken,
+		},
+		{
+			name:    "malformed",
+			token:   func() string { return "not-a-token" },
+			wantErr: ErrInvalidIDToken,
+		},
+		{
+			name: "invalid signature encoding",
+			token: func() string {
+				parts := strings.Split(signToken(t, key, header, validClaims()), ".")
+				return parts[0] + "." + parts[1] + ".!!!"
+			},
+			wantErr: ErrInvalidIDToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupOIDC(t, server)
+
+			claims, err := verifyIDToken(context.Background(), tt.token(), testNonce)
+
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if claims.Sub != "1337" || claims.PreferredUsername != "cool_user" {
+				t.Fatalf("claims = %+v, want sub 1337 and preferred username cool_user", claims)
+			}
+		})
+	}
+}
+
+func TestKeySetLookup(t *testing.T) {
+	server := newJWKSServer(t)
+	setupOIDC(t, server)
+
+	first := generateKey(t)
+	second := generateKey(t)
+	server.add("key-1", first)
+
+	verify := func(key *rsa.PrivateKey, kid string) error {
+		token := signToken(t, key, map[string]any{"alg": "RS256", "kid": kid}, validClaims())
+		_, err := verifyIDToken(context.Background(), token, testNonce)
+		return err
+	}
+
+	if err := verify(first, "key-1"); err != nil {
+		t.Fatalf("verifying with the first key: %v", err)
+	}
+	if got := server.fetchCount(); got != 1 {
+		t.Fatalf("fetches = %d, want 1", got)
+	}
+
+	// Known keys are served from the cache
+	if err := verify(first, "key-1"); err != nil {
+		t.Fatalf("verifying with the cached key: %v", err)
+	}
+	if got := server.fetchCount(); got != 1 {
+		t.Fatalf("fetches = %d, want 1 after using the cached key", got)
+	}
+
+	// Unknown keys do not trigger a refetch right after fetching
+	server.add("key-2", second)
+	if err := verify(second, "key-2"); !errors.Is(err, ErrInvalidIDToken) {
+		t.Fatalf("err = %v, want %v for an unknown key", err, ErrInvalidIDToken)
+	}
+	if got := server.fetchCount(); got != 1 {
+		t.Fatalf("fetches = %d, want 1 after an unknown key", got)
+	}
+
+	// Rotated keys are picked up once the key set may be refetched
+	keys.mu.Lock()
+	keys.fetchedAt = time.Now().Add(-keySetMinRefetch - time.Second)
+	keys.mu.Unlock()
+
+	if err := verify(second, "key-2"); err != nil {
+		t.Fatalf("verifying with the rotated key: %v", err)
+	}
+	if got := server.fetchCount(); got != 2 {
+		t.Fatalf("fetches = %d, want 2 after rotation", got)
+	}
+
+	// Stale key sets are refetched even for known keys
+	keys.mu.Lock()
+	keys.fetchedAt = time.Now().Add(-keySetMaxAge - time.Second)
+	keys.mu.Unlock()
+
+	if err := verify(first, "key-1"); err != nil {
+		t.Fatalf("verifying with a stale key set: %v", err)
+	}
+	if got := server.fetchCount(); got != 3 {
+		t.Fatalf("fetches = %d, want 3 after the key set went stale", got)
+	}
+
+	// Cached keys are still used if refreshing a stale key set fails
+	server.setFailing(true)
+	keys.mu.Lock()
+	keys.fetchedAt = time.Now().Add(-keySetMaxAge - time.Second)
+	keys.mu.Unlock()
+
+	if err := verify(first, "key-1"); err != nil {
+		t.Fatalf("verifying with a cached key while the key set is unavailable: %v", err)
+	}
+	if got := server.fetchCount(); got != 4 {
+		t.Fatalf("fetches = %d, want 4 after the failed refresh", got)
+	}
+
+	// The failed refresh is not retried right away
+	if err := verify(first, "key-1"); err != nil {
+		t.Fatalf("verifying with a cached key after the failed refresh: %v", err)
+	}
+	if got := server.fetchCount(); got != 4 {
+		t.Fatalf("fetches = %d, want 4 right after the failed refresh", got)
+	}
+
+	// Unknown keys can not fall back to the cache
+	keys.mu.Lock()
+	keys.fetchedAt = time.Now().Add(-keySetMaxAge - time.Second)
+	keys.mu.Unlock()
+
+	third := generateKey(t)
+	if err := verify(third, "key-3"); err == nil {
+		t.Fatal("verified a token with an unknown key while the key set is unavailable")
+	}
+}
@@ -0,0 +1,42 @@
+package twitch
+
+import (
+	"context"
+	"errors"
+
+	"golang.org/x/oauth2"
+
+	"github.com/devusSs/twitchspeak/internal/database"
+	"github.com/devusSs/twitchspeak/internal/helix"
+)
+
+// Fetches the Twitch profile using the fresh token and stores it
+// on the linked user (if any), a fresh login also lifts a revocation
+func updateProfile(ctx context.Context, twitchID string, token *oauth2.Token) error {
+	// Only the changed columns are written, other fields may be
+	// updated concurrently (e.g. by the TeamSpeak bot)
+	err := svc.SetRevokedAt(twitchID, nil)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	client, err := helix.NewClient(helix.Config{
+		ClientID:    oauthConfig.ClientID,
+		TokenSource: oauth2.StaticTokenSource(token),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Not being able to fetch the profile should not prevent logins,
+	// the details get refreshed on the next login
+	users, err := client.GetUsers(ctx, []string{twitchID})
+	if err != nil || len(users) == 0 {
+		return nil
+	}
+
+	return svc.SetTwitchDetails(twitchID, users[0].Login, users[0].DisplayName, users[0].ProfileImageURL)
+}
@@ -0,0 +1,116 @@
+package twitch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// Custom errors
+var (
+	ErrNeedsReauth = errors.New("twitch: refresh token rejected, user needs to login again")
+)
+
+// OnTokenRejected registers a handler which is called (in its own goroutine)
+// every time Twitch rejects the refresh token of a user,
+// usually because the user revoked the authorization of our app
+func OnTokenRejected(fn func(twitchID string)) {
+	rejectedMu.Lock()
+	defer rejectedMu.Unlock()
+	rejectedHandlers = append(rejectedHandlers, fn)
+}
+
+// UserTokenSource returns a token source for a linked Twitch user
+//
+// The stored token is refreshed shortly before it expires and refreshed
+// tokens are persisted. If Twitch rejects the refresh token the user is
+// marked as needing to re-authenticate and ErrNeedsReauth is returned.
+func UserTokenSource(ctx context.Context, twitchID string) oauth2.TokenSource {
+	return &storedTokenSource{
+		ctx:      ctx,
+		twitchID: twitchID,
+	}
+}
+
+// Token source backed by the database service
+type storedTokenSource struct {
+	ctx      context.Context
+	twitchID string
+
+	mu    sync.Mutex
+	token *oauth2.Token
+}
+
+func (s *storedTokenSource) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token == nil {
+		token, err := svc.GetToken(s.twitchID)
+		if err != nil {
+			return nil, fmt.Errorf("twitch: loading token: %w", err)
+		}
+		s.token = token
+	}
+
+	if s.token.Expiry.IsZero() || time.Until(s.token.Expiry) > refreshBeforeExpiry {
+		return s.token, nil
+	}
+
+	// Only pass the refresh token to force a refresh
+	token, err := oauthConfig.TokenSource(s.ctx, &oauth2.Token{
+		RefreshToken: s.token.RefreshToken,
+	}).Token()
+	if err != nil {
+		if isRefreshRejected(err) {
+			if err := svc.SetNeedsReauth(s.twitchID, true); err != nil {
+				return nil, fmt.Errorf("twitch: marking user as needing reauth: %w", err)
+			}
+			tokenRejected(s.twitchID)
+			return nil, ErrNeedsReauth
+		}
+		return nil, fmt.Errorf("twitch: refreshing token: %w", err)
+	}
+
+	if err := svc.SaveToken(s.twitchID, token); err != nil {
+		return nil, fmt.Errorf("twitch: saving refreshed token: %w", err)
+	}
+
+	s.token = token
+
+	return s.token, nil
+}
+
+// Notifies the handlers about a rejected refresh token
+func tokenRejected(twitchID string) {
+	rejectedMu.RLock()
+	defer rejectedMu.RUnlock()
+	for _, fn := range rejectedHandlers {
+		go fn(twitchID)
+	}
+}
+
+// Whether Twitch rejected the refresh token (e.g. because it was revoked)
+func isRefreshRejected(err error) bool {
+	var rErr *oauth2.RetrieveError
+	if !errors.As(err, &rErr) || rErr.Response == nil {
+		return false
+	}
+	return rErr.Response.StatusCode == http.StatusBadRequest ||
+		rErr.Response.StatusCode == http.StatusUnauthorized
+}
+
+var (
+	rejectedMu       sync.RWMutex
+	rejectedHandlers []func(twitchID string)
+)
+
+const (
+	// Tokens are refreshed once they expire within this duration
+	refreshBeforeExpiry = 5 * time.Minute
+)
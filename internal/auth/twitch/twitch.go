@@ -1,23 +1,25 @@
 package twitch
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
 	"strings"
-	"sync"
-	"time"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/endpoints"
 
+	"github.com/devusSs/twitchspeak/internal/auth/linktoken"
 	"github.com/devusSs/twitchspeak/internal/database"
-	"github.com/devusSs/twitchspeak/internal/httplib"
+	"github.com/devusSs/twitchspeak/internal/links"
 	"github.com/devusSs/twitchspeak/internal/server/responses"
+	"github.com/devusSs/twitchspeak/pkg/log"
 )
 
 // Config for oauth2 authorization process
@@ -30,7 +32,25 @@ type Config struct {
 	Port        uint
 	FrontendURL string
 
+	// OpenID Connect issuer and JSON Web Key Set endpoint,
+	// default to Twitch if empty
+	IssuerURL string
+	JWKSURL   string
+
+	// Use PKCE for the authorization code flow,
+	// disable for providers which do not support it
+	PKCE bool
+
+	// Verifies link tokens issued by the TeamSpeak bot
+	LinkTokens *linktoken.Signer
+
+	// Only send the session cookie via https
+	SecureCookies bool
+
 	Svc database.Service
+
+	Console bool
+	Debug   bool
 }
 
 // Initializes our oauth2 config
@@ -71,8 +91,30 @@ func Init(cfg Config) error {
 		return fmt.Errorf("twitch: frontend url is empty")
 	}
 
+	if cfg.LinkTokens == nil {
+		return fmt.Errorf("twitch: link token signer is nil")
+	}
+
 	frontendURL = cfg.FrontendURL
 	svc = cfg.Svc
+	usePKCE = cfg.PKCE
+	linkTokens = cfg.LinkTokens
+	secureCookies = cfg.SecureCookies
+
+	if cfg.IssuerURL != "" {
+		issuerURL = cfg.IssuerURL
+	}
+
+	if cfg.JWKSURL != "" {
+		keys = &keySet{url: cfg.JWKSURL}
+	}
+
+	keys.logger = log.NewLogger(
+		log.WithOwnLogFile("twitch.log"),
+		log.WithName("twitch"),
+		log.WithConsole(cfg.Console),
+		log.WithDebug(cfg.Debug),
+	)
 
 	oauthConfig = &oauth2.Config{
 		ClientID:     cfg.ClientID,
@@ -90,7 +132,7 @@ func HandleLoginRoute(c *gin.Context) {
 	session := sessions.Default(c)
 	id := session.Get("twitch_id")
 
-	if id != nil {
+	if id != nil && c.Query("token") == "" {
 		c.Redirect(http.StatusTemporaryRedirect, frontendURL)
 		return
 	}
@@ -105,26 +147,88 @@ func HandleLoginRoute(c *gin.Context) {
 		return
 	}
 
-	tsID := c.Query("ts_id")
-	if tsID == "" {
+	// Without a link token the user only logs in and may link
+	// their TeamSpeak identity afterwards using a link code
+	teamSpeakUID := ""
+	if token := c.Query("token"); token != "" {
+		claims, err := linkTokens.Consume(c, token)
+		if err != nil {
+			resp := responses.Error{
+				Code:         http.StatusBadRequest,
+				ErrorCode:    "link_token_invalid",
+				ErrorMessage: "Link token is invalid, please request a new link in TeamSpeak",
+			}
+			switch {
+			case errors.Is(err, linktoken.ErrExpired):
+				resp.ErrorCode = "link_token_expired"
+				resp.ErrorMessage = "Link token expired, please request a new link in TeamSpeak"
+			case errors.Is(err, linktoken.ErrUsed):
+				resp.ErrorCode = "link_token_used"
+				resp.ErrorMessage = "Link token has already been used, please request a new link in TeamSpeak"
+			case !errors.Is(err, linktoken.ErrInvalid):
+				resp.Code = http.StatusInternalServerError
+				resp.ErrorCode = responses.CodeInternalError
+				resp.ErrorMessage = responses.MessageInternalError
+			}
+			c.JSON(resp.Code, resp)
+			return
+		}
+		teamSpeakUID = claims.UID
+	}
+
+	// Already logged in users do not need to login with Twitch again
+	if id != nil {
+		user, err := links.Link(svc, teamSpeakUID, id.(string))
+		if errors.Is(err, database.ErrAlreadyLinked) && !sameLink(user, teamSpeakUID, id.(string)) {
+			resp := responses.Error{
+				Code:         http.StatusConflict,
+				ErrorCode:    "already_linked",
+				ErrorMessage: "The TeamSpeak identity or Twitch account is already connected",
+			}
+			c.JSON(resp.Code, resp)
+			return
+		}
+		if err != nil && !errors.Is(err, database.ErrAlreadyLinked) {
+			resp := responses.Error{
+				Code:         http.StatusInternalServerError,
+				ErrorCode:    responses.CodeInternalError,
+				ErrorMessage: responses.MessageInternalError,
+			}
+			c.JSON(resp.Code, resp)
+			return
+		}
+		c.Redirect(http.StatusTemporaryRedirect, frontendURL)
+		return
+	}
+
+	state := generateRandomString(stateLength)
+	nonce := generateRandomString(nonceLength)
+	opts := []oauth2.AuthCodeOption{oauth2.SetAuthURLParam("nonce", nonce)}
+
+	verifier := ""
+	if usePKCE {
+		verifier = oauth2.GenerateVerifier()
+		opts = append(opts, oauth2.S256ChallengeOption(verifier))
+	}
+
+	err := saveLoginAttempt(c, state, loginAttempt{
+		Nonce:        nonce,
+		TeamSpeakUID: teamSpeakUID,
+		Verifier:     verifier,
+	})
+	if err != nil {
 		resp := responses.Error{
-			Code:         http.StatusBadRequest,
-			ErrorCode:    "invalid_ts_id",
-			ErrorMessage: "Teamspeak ID is empty",
+			Code:         http.StatusInternalServerError,
+			ErrorCode:    responses.CodeInternalError,
+			ErrorMessage: responses.MessageInternalError,
 		}
 		c.JSON(resp.Code, resp)
 		return
 	}
 
-	requests.set(c.ClientIP(), request{
-		nonce: generateRandomString(nonceLength),
-		state: generateRandomString(stateLength) + "&ts_id=" + tsID,
-	})
+	setStateCookie(c, state)
 
-	url := oauthConfig.AuthCodeURL(
-		requests.get(c.ClientIP()).state,
-		oauth2.SetAuthURLParam("nonce", requests.get(c.ClientIP()).nonce),
-	)
+	url := oauthConfig.AuthCodeURL(state, opts...)
 
 	c.Redirect(http.StatusTemporaryRedirect, url)
 }
@@ -152,7 +256,8 @@ func HandleRedirectRoute(c *gin.Context) {
 	qState := c.Query("state")
 	qCode := c.Query("code")
 
-	if qState != requests.get(c.ClientIP()).state {
+	// The attempt is left untouched, the browser which started it may still finish it
+	if !checkStateCookie(c, qState) {
 		resp := responses.Error{
 			Code:         http.StatusBadRequest,
 			ErrorCode:    "invalid_state",
@@ -162,7 +267,16 @@ func HandleRedirectRoute(c *gin.Context) {
 		return
 	}
 
-	token, err := oauthConfig.Exchange(c, qCode)
+	attempt, err := takeLoginAttempt(c, qState)
+	if errors.Is(err, errAttemptNotFound) {
+		resp := responses.Error{
+			Code:         http.StatusBadRequest,
+			ErrorCode:    "invalid_state",
+			ErrorMessage: "State does not match required",
+		}
+		c.JSON(resp.Code, resp)
+		return
+	}
 	if err != nil {
 		resp := responses.Error{
 			Code:         http.StatusInternalServerError,
@@ -173,36 +287,77 @@ func HandleRedirectRoute(c *gin.Context) {
 		return
 	}
 
-	nonce := token.Extra("nonce")
-	if nonce != requests.get(c.ClientIP()).nonce {
+	var opts []oauth2.AuthCodeOption
+	if attempt.Verifier != "" {
+		opts = append(opts, oauth2.VerifierOption(attempt.Verifier))
+	}
+
+	token, err := oauthConfig.Exchange(c, qCode, opts...)
+	if err != nil {
 		resp := responses.Error{
-			Code:         http.StatusBadRequest,
-			ErrorCode:    "invalid_nonce",
-			ErrorMessage: "Nonce does not match required",
+			Code:         http.StatusInternalServerError,
+			ErrorCode:    responses.CodeInternalError,
+			ErrorMessage: responses.MessageInternalError,
 		}
 		c.JSON(resp.Code, resp)
 		return
 	}
 
-	tsID := strings.Split(requests.get(c.ClientIP()).state, "&ts_id=")[1]
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		resp := responses.Error{
+			Code:         http.StatusBadRequest,
+			ErrorCode:    "invalid_id_token",
+			ErrorMessage: "ID token is missing",
+		}
+		c.JSON(resp.Code, resp)
+		return
+	}
 
-	var claims claimsResponse
-	err = httplib.AuthorizedGet(
-		http.MethodGet,
-		userInfoEndpoint,
-		fmt.Sprintf("%v", token.Extra("access_token")),
-		&claims,
-	)
+	claims, err := verifyIDToken(c, rawIDToken, attempt.Nonce)
 	if err != nil {
 		resp := responses.Error{
-			Code:         http.StatusInternalServerError,
-			ErrorCode:    responses.CodeInternalError,
-			ErrorMessage: responses.MessageInternalError,
+			Code:         http.StatusBadRequest,
+			ErrorCode:    "invalid_id_token",
+			ErrorMessage: "ID token could not be verified",
+		}
+		switch {
+		case errors.Is(err, ErrInvalidNonce):
+			resp.ErrorCode = "invalid_nonce"
+			resp.ErrorMessage = "Nonce does not match required"
+		case !errors.Is(err, ErrInvalidIDToken):
+			resp.Code = http.StatusInternalServerError
+			resp.ErrorCode = responses.CodeInternalError
+			resp.ErrorMessage = responses.MessageInternalError
 		}
 		c.JSON(resp.Code, resp)
 		return
 	}
 
+	if attempt.TeamSpeakUID != "" {
+		user, err := links.Link(svc, attempt.TeamSpeakUID, claims.Sub)
+		// Logging in again with an already linked account is fine,
+		// linking either side to someone else is not and must not log the browser in
+		if errors.Is(err, database.ErrAlreadyLinked) && !sameLink(user, attempt.TeamSpeakUID, claims.Sub) {
+			resp := responses.Error{
+				Code:         http.StatusConflict,
+				ErrorCode:    "already_linked",
+				ErrorMessage: "The TeamSpeak identity or Twitch account is already connected",
+			}
+			c.JSON(resp.Code, resp)
+			return
+		}
+		if err != nil && !errors.Is(err, database.ErrAlreadyLinked) {
+			resp := responses.Error{
+				Code:         http.StatusInternalServerError,
+				ErrorCode:    responses.CodeInternalError,
+				ErrorMessage: responses.MessageInternalError,
+			}
+			c.JSON(resp.Code, resp)
+			return
+		}
+	}
+
 	u, err := url.Parse(c.Request.RequestURI)
 	if err != nil {
 		resp := responses.Error{
@@ -224,7 +379,7 @@ func HandleRedirectRoute(c *gin.Context) {
 			1,
 		),
 		MaxAge:   86400 * 7,
-		Secure:   strings.Contains(u.String(), "https://"),
+		Secure:   secureCookies,
 		HttpOnly: true,
 		SameSite: http.SameSiteStrictMode,
 	})
@@ -240,67 +395,64 @@ func HandleRedirectRoute(c *gin.Context) {
 		return
 	}
 
-	_, err = svc.AddUser(&database.User{
-		TeamSpeakUID: tsID,
-		TwitchID:     claims.Sub,
-	})
-	if err != nil {
-		// Ignore duplicate key errors
-		if !strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
-			resp := responses.Error{
-				Code:         http.StatusInternalServerError,
-				ErrorCode:    responses.CodeInternalError,
-				ErrorMessage: responses.MessageInternalError,
-			}
-			c.JSON(resp.Code, resp)
-			return
+	if err := svc.SaveToken(claims.Sub, token); err != nil {
+		resp := responses.Error{
+			Code:         http.StatusInternalServerError,
+			ErrorCode:    responses.CodeInternalError,
+			ErrorMessage: responses.MessageInternalError,
+		}
+		c.JSON(resp.Code, resp)
+		return
+	}
+
+	// A fresh login makes stored tokens usable again
+	err = svc.SetNeedsReauth(claims.Sub, false)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		resp := responses.Error{
+			Code:         http.StatusInternalServerError,
+			ErrorCode:    responses.CodeInternalError,
+			ErrorMessage: responses.MessageInternalError,
+		}
+		c.JSON(resp.Code, resp)
+		return
+	}
+
+	if err := updateProfile(c, claims.Sub, token); err != nil {
+		resp := responses.Error{
+			Code:         http.StatusInternalServerError,
+			ErrorCode:    responses.CodeInternalError,
+			ErrorMessage: responses.MessageInternalError,
 		}
+		c.JSON(resp.Code, resp)
+		return
 	}
 
 	c.Redirect(http.StatusTemporaryRedirect, frontendURL)
 }
 
+// TokenSource returns a token source which refreshes the given
+// token using our oauth2 config, Init needs to be called first
+func TokenSource(ctx context.Context, token *oauth2.Token) oauth2.TokenSource {
+	return oauthConfig.TokenSource(ctx, token)
+}
+
 const (
-	stateLength = 16
+	stateLength = 32
 	nonceLength = 32
 )
 
 var (
-	frontendURL string           = ""
-	svc         database.Service = nil
-	oauthConfig *oauth2.Config   = nil
-	// Maps request ip to request (nonce and state)
-	requests *safeMap = &safeMap{mu: sync.Mutex{}, data: make(map[string]request)}
-
-	userInfoEndpoint = "https://id.twitch.tv/oauth2/userinfo"
+	frontendURL   string           = ""
+	svc           database.Service = nil
+	oauthConfig   *oauth2.Config   = nil
+	usePKCE       bool
+	linkTokens    *linktoken.Signer
+	secureCookies bool
+
+	issuerURL string  = defaultIssuerURL
+	keys      *keySet = &keySet{url: defaultJWKSURL}
 )
 
-type safeMap struct {
-	mu   sync.Mutex
-	data map[string]request
-}
-
-func (s *safeMap) get(key string) request {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	val, ok := s.data[key]
-	if !ok {
-		return request{}
-	}
-	return val
-}
-
-func (s *safeMap) set(key string, value request) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.data[key] = value
-}
-
-type request struct {
-	nonce string
-	state string
-}
-
 func generateRandomString(length int) string {
 	randomBytes := make([]byte, length)
 	_, _ = rand.Read(randomBytes)
@@ -308,14 +460,8 @@ func generateRandomString(length int) string {
 	return randomString[:length]
 }
 
-type claimsResponse struct {
-	Aud           string    `json:"aud"`
-	Exp           int       `json:"exp"`
-	Iat           int       `json:"iat"`
-	Iss           string    `json:"iss"`
-	Sub           string    `json:"sub"`
-	Email         string    `json:"email"`
-	EmailVerified bool      `json:"email_verified"`
-	Picture       string    `json:"picture"`
-	UpdatedAt     time.Time `json:"updated_at"`
+// Whether the existing user links exactly the TeamSpeak identity
+// and the Twitch account, not just one of them
+func sameLink(user *database.User, teamSpeakUID string, twitchID string) bool {
+	return user != nil && user.TeamSpeakUID == teamSpeakUID && user.TwitchID == twitchID
 }
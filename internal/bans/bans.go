@@ -0,0 +1,529 @@
+package bans
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/devusSs/twitchspeak/internal/database"
+	"github.com/devusSs/twitchspeak/internal/eventsub"
+	"github.com/devusSs/twitchspeak/internal/helix"
+	"github.com/devusSs/twitchspeak/internal/teamspeak"
+	"github.com/devusSs/twitchspeak/pkg/log"
+)
+
+// Action is applied in TeamSpeak for a Twitch ban or timeout
+type Action string
+
+// Supported actions
+const (
+	// Server ban, timeouts result in a ban for the remaining duration
+	ActionBan Action = database.BanActionBan
+	// Mute server group until the timeout ends or the user gets unbanned
+	ActionMute Action = database.BanActionMute
+	// Ignore
+	ActionNone Action = "none"
+)
+
+// Valid returns whether the action is supported
+func (a Action) Valid() bool {
+	return a == ActionBan || a == ActionMute || a == ActionNone
+}
+
+// Sources of bans and unbans
+const (
+	SourceEventSub = "eventsub"
+	SourceHelix    = "helix"
+	SourceExpiry   = "expiry"
+)
+
+// Config for the ban syncer
+type Config struct {
+	Helix *helix.Client
+	// Twitch user ID of the channel bans are synced from
+	BroadcasterID string
+	Bot           *teamspeak.Bot
+	DB            database.Service
+	// Action for permanent bans
+	Permanent Action
+	// Action for timeouts
+	Timeout Action
+	// Server group of muted users, required if any action is mute
+	MuteGroup int
+	// Twitch IDs, Twitch logins or TeamSpeak unique identifiers
+	// of users who are never banned in TeamSpeak
+	Allowlist []string
+	Console   bool
+	Debug     bool
+}
+
+// Syncer applies Twitch bans and timeouts of linked users in TeamSpeak
+type Syncer struct {
+	helix         *helix.Client
+	broadcasterID string
+	bot           *teamspeak.Bot
+	db            database.Service
+	permanent     Action
+	timeout       Action
+	muteGroup     int
+	allowlist     []string
+	logger        *log.Logger
+
+	// Serializes changes so bans are not applied twice
+	mu sync.Mutex
+}
+
+// Ban on Twitch as reported by EventSub or Helix
+type twitchBan struct {
+	Moderator string
+	Reason    string
+	// Nil for permanent bans
+	ExpiresAt *time.Time
+}
+
+// HandleEvent applies channel.ban and channel.unban notifications of linked users
+func (s *Syncer) HandleEvent(ctx context.Context, event eventsub.Event) {
+	var err error
+	switch event := event.(type) {
+	case *eventsub.ChannelBan:
+		ban := twitchBan{Moderator: event.ModeratorUserLogin, Reason: event.Reason}
+		if !event.IsPermanent {
+			ban.ExpiresAt = event.EndsAt
+		}
+		err = s.ban(event.UserID, ban, SourceEventSub)
+	case *eventsub.ChannelUnban:
+		err = s.unban(event.UserID, event.ModeratorUserLogin, SourceEventSub)
+	default:
+		return
+	}
+
+	if err != nil {
+		s.logger.Error("Error handling %s: %v", event.SubscriptionType(), err)
+	}
+}
+
+// SyncUser checks whether the linked user is banned on Twitch
+// and applies or lifts their ban in TeamSpeak
+func (s *Syncer) SyncUser(ctx context.Context, user *database.User) error {
+	bans, err := s.helix.GetBannedUsers(ctx, s.broadcasterID, []string{user.TwitchID})
+	if err != nil {
+		return err
+	}
+
+	if ban, ok := bans[user.TwitchID]; ok {
+		return s.applyBan(user, fromHelix(ban), SourceHelix)
+	}
+
+	return s.unban(user.TwitchID, "", SourceHelix)
+}
+
+// Reconcile compares the bans of all linked users on Twitch with the applied ones,
+// catches up on missed notifications and lifts expired timeouts
+func (s *Syncer) Reconcile(ctx context.Context) error {
+	if err := s.Expire(); err != nil {
+		return err
+	}
+
+	applied, err := s.db.ListBans()
+	if err != nil {
+		return fmt.Errorf("listing bans: %w", err)
+	}
+
+	banned := make(map[string]bool, len(applied))
+	for _, ban := range applied {
+		banned[ban.TwitchID] = true
+	}
+
+	var checked, failed int
+	for offset := 0; ; offset += helix.MaxBatchSize {
+		// Revoked users are included, revoking must not lift bans
+		users, _, err := s.db.ListUsers(database.ListOptions{
+			Offset: offset,
+			Limit:  helix.MaxBatchSize,
+		})
+		if err != nil {
+			return fmt.Errorf("listing users: %w", err)
+		}
+
+		if len(users) == 0 {
+			break
+		}
+
+		twitchIDs := make([]string, 0, len(users))
+		for _, user := range users {
+			twitchIDs = append(twitchIDs, user.TwitchID)
+		}
+
+		bans, err := s.helix.GetBannedUsers(ctx, s.broadcasterID, twitchIDs)
+		if err != nil {
+			return err
+		}
+
+		for _, user := range users {
+			checked++
+
+			ban, ok := bans[user.TwitchID]
+			switch {
+			case ok:
+				err = s.applyBan(user, fromHelix(ban), SourceHelix)
+			case banned[user.TwitchID]:
+				err = s.unban(user.TwitchID, "", SourceHelix)
+			default:
+				continue
+			}
+
+			if err != nil {
+				failed++
+				s.logger.Warn("Could not reconcile ban of %s (Twitch %s): %v", user.TeamSpeakUID, user.TwitchID, err)
+			}
+		}
+
+		if len(users) < helix.MaxBatchSize {
+			break
+		}
+	}
+
+	s.logger.Info("Reconciled bans: checked %d users, failed %d", checked, failed)
+
+	return nil
+}
+
+// Expire lifts bans whose timeout ended
+func (s *Syncer) Expire() error {
+	applied, err := s.db.ListBans()
+	if err != nil {
+		return fmt.Errorf("listing bans: %w", err)
+	}
+
+	now := time.Now()
+	for _, ban := range applied {
+		if ban.ExpiresAt == nil || ban.ExpiresAt.After(now) {
+			continue
+		}
+		if err := s.unban(ban.TwitchID, "", SourceExpiry); err != nil {
+			s.logger.Error("Error lifting expired ban of %s: %v", ban.TwitchID, err)
+		}
+	}
+
+	return nil
+}
+
+// Run lifts expired timeouts every minute and reconciles all bans right away
+// and every interval, interval defaults to 1 hour if not positive
+//
+// Blocking until context is canceled
+func (s *Syncer) Run(ctx context.Context, interval time.Duration, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	if interval <= 0 {
+		interval = defaultReconcileInterval
+	}
+
+	if err := s.Expire(); err != nil {
+		s.logger.Error("Error lifting expired bans: %v", err)
+	}
+
+	if err := s.Reconcile(ctx); err != nil {
+		s.logger.Error("Error reconciling bans: %v", err)
+	}
+
+	expiry := time.NewTicker(expiryInterval)
+	defer expiry.Stop()
+
+	reconcile := time.NewTicker(interval)
+	defer reconcile.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.logger.Debug("Exiting ban syncer")
+			return
+		case <-expiry.C:
+			if err := s.Expire(); err != nil {
+				s.logger.Error("Error lifting expired bans: %v", err)
+			}
+		case <-reconcile.C:
+			if err := s.Reconcile(ctx); err != nil {
+				s.logger.Error("Error reconciling bans: %v", err)
+			}
+		}
+	}
+}
+
+// Applies the ban if the Twitch user is linked
+func (s *Syncer) ban(twitchID string, ban twitchBan, source string) error {
+	user, err := s.db.GetUserByTwitchID(twitchID)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("getting user: %w", err)
+	}
+
+	return s.applyBan(user, ban, source)
+}
+
+// Applies the action configured for the ban in TeamSpeak,
+// replaces a different ban applied before
+func (s *Syncer) applyBan(user *database.User, ban twitchBan, source string) error {
+	if s.allowed(user) {
+		s.logger.Debug("not banning allowlisted %s (Twitch %s)", user.TeamSpeakUID, user.TwitchID)
+		return s.unban(user.TwitchID, "", source)
+	}
+
+	if ban.ExpiresAt != nil && !ban.ExpiresAt.After(time.Now()) {
+		return nil
+	}
+
+	action := s.permanent
+	if ban.ExpiresAt != nil {
+		action = s.timeout
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, err := s.db.GetBanByTwitchID(user.TwitchID)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		return fmt.Errorf("getting ban: %w", err)
+	}
+
+	if existing != nil {
+		if Action(existing.Action) == action && sameExpiry(existing.ExpiresAt, ban.ExpiresAt) {
+			return nil
+		}
+		if err := s.lift(existing); err != nil {
+			return err
+		}
+	}
+
+	if action == ActionNone {
+		return nil
+	}
+
+	record := &database.Ban{
+		TwitchID:     user.TwitchID,
+		TeamSpeakUID: user.TeamSpeakUID,
+		Action:       string(action),
+		ExpiresAt:    ban.ExpiresAt,
+		Reason:       ban.Reason,
+		Moderator:    ban.Moderator,
+	}
+
+	switch action {
+	case ActionBan:
+		var duration time.Duration
+		if ban.ExpiresAt != nil {
+			duration = time.Until(*ban.ExpiresAt).Round(time.Second) + time.Second
+		}
+
+		record.TeamSpeakBanID, err = s.bot.BanUID(user.TeamSpeakUID, duration, banReason(ban.Reason))
+		if err != nil {
+			return err
+		}
+
+		if err := s.bot.KickUID(user.TeamSpeakUID, "Banned on Twitch"); err != nil {
+			s.logger.Error("Error kicking %s: %v", user.TeamSpeakUID, err)
+		}
+	case ActionMute:
+		if err := s.bot.AddServerGroup(user.TeamSpeakUID, s.muteGroup); err != nil {
+			return err
+		}
+	}
+
+	if err := s.db.AddBan(record); err != nil {
+		return fmt.Errorf("adding ban: %w", err)
+	}
+
+	expires := "never"
+	if ban.ExpiresAt != nil {
+		expires = ban.ExpiresAt.Format(time.RFC3339)
+	}
+
+	err = s.db.AddAuditEvent(&database.AuditEvent{
+		Action:       database.AuditBanned,
+		TeamSpeakUID: user.TeamSpeakUID,
+		TwitchID:     user.TwitchID,
+		Source:       source,
+		Details: fmt.Sprintf(
+			"action: %s, expires: %s, moderator: %s, reason: %s",
+			action,
+			expires,
+			ban.Moderator,
+			ban.Reason,
+		),
+	})
+	if err != nil {
+		return fmt.Errorf("adding audit event: %w", err)
+	}
+
+	s.logger.Info(
+		"Applied %s to %s (Twitch %s) via %s, expires: %s, moderator: %s",
+		action,
+		user.TeamSpeakUID,
+		user.TwitchID,
+		source,
+		expires,
+		ban.Moderator,
+	)
+
+	return nil
+}
+
+// Lifts the ban applied for the Twitch user, if any
+func (s *Syncer) unban(twitchID string, moderator string, source string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ban, err := s.db.GetBanByTwitchID(twitchID)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("getting ban: %w", err)
+	}
+
+	if err := s.lift(ban); err != nil {
+		return err
+	}
+
+	err = s.db.AddAuditEvent(&database.AuditEvent{
+		Action:       database.AuditUnbanned,
+		TeamSpeakUID: ban.TeamSpeakUID,
+		TwitchID:     ban.TwitchID,
+		Source:       source,
+		Details:      fmt.Sprintf("action: %s, moderator: %s", ban.Action, moderator),
+	})
+	if err != nil {
+		return fmt.Errorf("adding audit event: %w", err)
+	}
+
+	s.logger.Info("Lifted %s of %s (Twitch %s) via %s", ban.Action, ban.TeamSpeakUID, ban.TwitchID, source)
+
+	return nil
+}
+
+// Removes the ban or mute group in TeamSpeak and deletes the record
+func (s *Syncer) lift(ban *database.Ban) error {
+	switch Action(ban.Action) {
+	case ActionBan:
+		if err := s.bot.RemoveBan(ban.TeamSpeakBanID); err != nil {
+			return err
+		}
+	case ActionMute:
+		if err := s.bot.RemoveServerGroup(ban.TeamSpeakUID, s.muteGroup); err != nil {
+			return err
+		}
+	}
+
+	err := s.db.DeleteBan(ban.TwitchID)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		return fmt.Errorf("deleting ban: %w", err)
+	}
+
+	return nil
+}
+
+// Whether the user is on the allowlist
+func (s *Syncer) allowed(user *database.User) bool {
+	return slices.ContainsFunc(s.allowlist, func(entry string) bool {
+		return entry == user.TwitchID ||
+			entry == user.TeamSpeakUID ||
+			(user.TwitchLogin != "" && strings.EqualFold(entry, user.TwitchLogin))
+	})
+}
+
+// Converts a ban returned by Helix
+func fromHelix(ban helix.BannedUser) twitchBan {
+	return twitchBan{
+		Moderator: ban.ModeratorLogin,
+		Reason:    ban.Reason,
+		ExpiresAt: ban.ExpiresAt,
+	}
+}
+
+// Whether both expiries are permanent or equal to the second,
+// EventSub and Helix report them with different precision
+func sameExpiry(a *time.Time, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.Truncate(time.Second).Equal(b.Truncate(time.Second))
+}
+
+// Builds the reason of TeamSpeak bans
+func banReason(reason string) string {
+	if reason == "" {
+		return "Banned on Twitch"
+	}
+	return "Banned on Twitch: " + reason
+}
+
+// NewSyncer creates a new ban syncer
+func NewSyncer(cfg Config) (*Syncer, error) {
+	if cfg.Helix == nil {
+		return nil, fmt.Errorf("bans: helix client is nil")
+	}
+
+	if cfg.BroadcasterID == "" {
+		return nil, fmt.Errorf("bans: broadcaster id is empty")
+	}
+
+	if cfg.Bot == nil {
+		return nil, fmt.Errorf("bans: bot is nil")
+	}
+
+	if cfg.DB == nil {
+		return nil, fmt.Errorf("bans: database service is nil")
+	}
+
+	if !cfg.Permanent.Valid() {
+		return nil, fmt.Errorf("bans: unknown action %q for permanent bans", cfg.Permanent)
+	}
+
+	if !cfg.Timeout.Valid() {
+		return nil, fmt.Errorf("bans: unknown action %q for timeouts", cfg.Timeout)
+	}
+
+	if (cfg.Permanent == ActionMute || cfg.Timeout == ActionMute) && cfg.MuteGroup <= 0 {
+		return nil, fmt.Errorf("bans: mute group is not set")
+	}
+
+	logger := log.NewLogger(
+		log.WithOwnLogFile("bans.log"),
+		log.WithName("bans"),
+		log.WithConsole(cfg.Console),
+		log.WithDebug(cfg.Debug),
+	)
+
+	s := &Syncer{
+		helix:         cfg.Helix,
+		broadcasterID: cfg.BroadcasterID,
+		bot:           cfg.Bot,
+		db:            cfg.DB,
+		permanent:     cfg.Permanent,
+		timeout:       cfg.Timeout,
+		muteGroup:     cfg.MuteGroup,
+		allowlist:     cfg.Allowlist,
+		logger:        logger,
+	}
+
+	s.logger.Info(
+		"Ban syncer initialized, permanent: %s, timeout: %s, mute group: %d, allowlist: %v",
+		s.permanent,
+		s.timeout,
+		s.muteGroup,
+		s.allowlist,
+	)
+
+	return s, nil
+}
+
+const (
+	expiryInterval           = time.Minute
+	defaultReconcileInterval = time.Hour
+)
@@ -0,0 +1,489 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/oauth2"
+
+	"github.com/devusSs/twitchspeak/internal/database"
+	"github.com/devusSs/twitchspeak/internal/teamspeak"
+	"github.com/devusSs/twitchspeak/pkg/log"
+)
+
+// Config for the chat bridge
+type Config struct {
+	Bot *teamspeak.Bot
+	DB  database.Service
+	// Token of the Twitch account used for chatting,
+	// needs the chat:read and (for relaying to Twitch) chat:edit scopes
+	TokenSource oauth2.TokenSource
+	// Login name of the Twitch account used for chatting
+	Login string
+	// Login name of the Twitch channel to bridge
+	Channel string
+	// TeamSpeak channel to bridge
+	ChannelID int
+	// Relay messages of linked users from TeamSpeak to Twitch
+	ToTwitch bool
+	// Messages sent to Twitch per 30 seconds,
+	// 20 for regular users and 100 for moderators
+	RateLimit int
+	Console   bool
+	Debug     bool
+}
+
+// Bridge mirrors Twitch chat into a TeamSpeak channel
+// and optionally messages of linked users back to Twitch
+type Bridge struct {
+	bot         *teamspeak.Bot
+	db          database.Service
+	tokenSource oauth2.TokenSource
+	login       string
+	channel     string
+	channelID   int
+	toTwitch    bool
+	limiter     *limiter
+	logger      *log.Logger
+
+	// Messages waiting to be sent to Twitch
+	outgoing chan string
+	// Messages waiting to be relayed to TeamSpeak
+	incoming chan string
+
+	mu sync.Mutex
+	// Current connection, nil while disconnected
+	conn *conn
+}
+
+// Run connects to Twitch chat and relays messages until context is canceled,
+// reconnects with backoff if the connection gets lost
+func (br *Bridge) Run(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	if br.toTwitch {
+		go br.sendLoop(ctx)
+	}
+	go br.relayLoop(ctx)
+
+	br.logger.Info("Bridging Twitch chat of %s with TeamSpeak channel %d", br.channel, br.channelID)
+
+	for attempt := 0; ; attempt++ {
+		start := time.Now()
+		err := br.session(ctx)
+		if ctx.Err() != nil {
+			br.logger.Debug("Exiting chat bridge")
+			return
+		}
+
+		if time.Since(start) > stableAfter {
+			attempt = 0
+		}
+
+		wait := backoff(attempt)
+		br.logger.Warn("Twitch chat disconnected: %v, reconnecting in %v", err, wait.Round(time.Second))
+
+		select {
+		case <-ctx.Done():
+			br.logger.Debug("Exiting chat bridge")
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Subscribe subscribes the bridge to the bot's channel messages
+// if relaying to Twitch is enabled
+func (br *Bridge) Subscribe() {
+	if !br.toTwitch {
+		return
+	}
+
+	teamspeak.On(br.bot.Events(), br.fromTeamSpeak)
+
+	// Keeps the bot in the bridged channel, stream announcements
+	// and reconnects would move it elsewhere otherwise
+	if err := br.bot.SetHomeChannel(br.channelID); err != nil {
+		br.logger.Error("Error entering TeamSpeak channel %d: %v", br.channelID, err)
+	}
+}
+
+// Connects, joins the channel and handles messages until the connection breaks
+func (br *Bridge) session(ctx context.Context) error {
+	token, err := br.tokenSource.Token()
+	if err != nil {
+		return fmt.Errorf("getting token: %w", err)
+	}
+
+	c, err := dial(ctx, serverAddr)
+	if err != nil {
+		return fmt.Errorf("connecting: %w", err)
+	}
+	defer c.close()
+
+	// Unblocks reading once context is canceled
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.close()
+		case <-done:
+		}
+	}()
+
+	for _, line := range []string{
+		"CAP REQ :twitch.tv/tags twitch.tv/commands",
+		"PASS oauth:" + token.AccessToken,
+		"NICK " + br.login,
+		"JOIN #" + br.channel,
+	} {
+		if err := c.send("%s", line); err != nil {
+			return fmt.Errorf("logging in: %w", err)
+		}
+	}
+
+	br.setConn(c)
+	defer br.setConn(nil)
+
+	if err := br.bot.EnterChannel(br.channelID); err != nil {
+		br.logger.Error("Error entering TeamSpeak channel %d: %v", br.channelID, err)
+	}
+
+	for {
+		msg, err := c.read()
+		if err != nil {
+			return err
+		}
+
+		switch msg.Command {
+		case "PING":
+			if err := c.send("PONG :%s", msg.trailing()); err != nil {
+				return err
+			}
+		case "RECONNECT":
+			return errors.New("server requested reconnect")
+		case "NOTICE":
+			if strings.Contains(msg.trailing(), "authentication failed") {
+				return fmt.Errorf("login failed: %s", msg.trailing())
+			}
+			br.logger.Debug("notice: %s", msg.trailing())
+		case "JOIN":
+			if strings.EqualFold(msg.nick(), br.login) {
+				br.logger.Info("Joined Twitch chat of %s", br.channel)
+			}
+		case "PRIVMSG":
+			br.toTeamSpeak(msg)
+		}
+	}
+}
+
+// Queues a Twitch chat message for the TeamSpeak channel
+func (br *Bridge) toTeamSpeak(msg *message) {
+	// Loop prevention, we relay TeamSpeak messages using this account
+	if strings.EqualFold(msg.nick(), br.login) {
+		return
+	}
+
+	name := msg.Tags["display-name"]
+	if name == "" {
+		name = msg.nick()
+	}
+	name = teamspeak.EscapeBBCode(name)
+
+	text := msg.trailing()
+	var line string
+	if action, ok := strings.CutPrefix(text, "\x01ACTION "); ok {
+		line = fmt.Sprintf("* %s[B]%s[/B] %s", badges(msg.Tags["badges"]), name, teamspeak.EscapeBBCode(strings.TrimSuffix(action, "\x01")))
+	} else {
+		line = fmt.Sprintf("%s[B]%s:[/B] %s", badges(msg.Tags["badges"]), name, teamspeak.EscapeBBCode(text))
+	}
+
+	for _, part := range split(line, teamSpeakMaxLength) {
+		select {
+		case br.incoming <- part:
+		default:
+			br.logger.Warn("Dropping message of %s, too many messages queued", name)
+			return
+		}
+	}
+}
+
+// Relays queued Twitch messages to TeamSpeak respecting the rate limit,
+// every message costs multiple queries which count towards the flood protection
+//
+// Messages queued while waiting are combined into as few messages as possible
+func (br *Bridge) relayLoop(ctx context.Context) {
+	limiter := newLimiter(teamSpeakRateLimit, teamSpeakRateWindow)
+
+	var pending []string
+	for {
+		if len(pending) == 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case line := <-br.incoming:
+				pending = append(pending, line)
+			}
+		}
+
+		if err := limiter.wait(ctx); err != nil {
+			return
+		}
+
+	drain:
+		for len(pending) < incomingBuffer {
+			select {
+			case line := <-br.incoming:
+				pending = append(pending, line)
+			default:
+				break drain
+			}
+		}
+
+		var msg string
+		msg, pending = batch(pending, teamSpeakMaxLength)
+
+		if err := br.bot.SendChannelMessage(br.channelID, msg); err != nil {
+			br.logger.Error("Error relaying messages to TeamSpeak: %v", err)
+		}
+	}
+}
+
+// Queues a TeamSpeak channel message of a linked user for Twitch
+func (br *Bridge) fromTeamSpeak(msg *teamspeak.TextMessage) {
+	if msg.TargetMode != teamspeak.TargetModeChannel || msg.Invoker.UID == "" {
+		return
+	}
+
+	// Loop prevention, the server echoes our own messages
+	invokerID := strconv.Itoa(msg.Invoker.ID)
+	if invokerID == br.bot.OwnID() {
+		return
+	}
+
+	if strings.HasPrefix(msg.Message, br.bot.Commands().Prefix()) {
+		return
+	}
+
+	// The bot only receives messages of the channel it is in,
+	// which may not be the bridged one if it moved elsewhere
+	cid, err := br.bot.ClientChannelID(invokerID)
+	if err != nil {
+		br.logger.Warn("Error getting channel of %s: %v", msg.Invoker.UID, err)
+		return
+	}
+	if cid != br.channelID {
+		return
+	}
+
+	user, err := br.db.GetUserByTeamSpeakUID(msg.Invoker.UID)
+	if errors.Is(err, database.ErrNotFound) {
+		return
+	}
+	if err != nil {
+		br.logger.Error("Error getting user %s: %v", msg.Invoker.UID, err)
+		return
+	}
+	if user.Revoked() {
+		return
+	}
+
+	name := user.TwitchDisplayName
+	if name == "" {
+		name = user.TwitchLogin
+	}
+	if name == "" {
+		name = msg.Invoker.Name
+	}
+
+	text := strings.TrimSpace(bbCode.ReplaceAllString(msg.Message, ""))
+	if text == "" {
+		return
+	}
+
+	for _, part := range split(fmt.Sprintf("[TS] %s: %s", name, text), twitchMaxLength) {
+		select {
+		case br.outgoing <- part:
+		default:
+			br.logger.Warn("Dropping message of %s, too many messages queued", msg.Invoker.UID)
+			return
+		}
+	}
+}
+
+// Sends queued messages to Twitch respecting the rate limit
+func (br *Bridge) sendLoop(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case text := <-br.outgoing:
+			if err := br.limiter.wait(ctx); err != nil {
+				return
+			}
+
+			c := br.currentConn()
+			if c == nil {
+				br.logger.Warn("Dropping message, not connected to Twitch chat")
+				continue
+			}
+
+			if err := c.send("PRIVMSG #%s :%s", br.channel, text); err != nil {
+				br.logger.Error("Error sending message to Twitch: %v", err)
+			}
+		}
+	}
+}
+
+func (br *Bridge) setConn(c *conn) {
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	br.conn = c
+}
+
+func (br *Bridge) currentConn() *conn {
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	return br.conn
+}
+
+// Renders the badges tag as text, e.g. "broadcaster/1,subscriber/12" as "[Broadcaster] [Sub] "
+func badges(tag string) string {
+	var sb strings.Builder
+	for _, badge := range strings.Split(tag, ",") {
+		name, _, _ := strings.Cut(badge, "/")
+		if label, ok := badgeLabels[name]; ok {
+			sb.WriteString("[" + label + "] ")
+		}
+	}
+	return sb.String()
+}
+
+var badgeLabels = map[string]string{
+	"broadcaster": "Broadcaster",
+	"moderator":   "Mod",
+	"vip":         "VIP",
+	"subscriber":  "Sub",
+	"founder":     "Founder",
+}
+
+// Joins lines into one message of at most limit characters,
+// returns the message and the remaining lines
+//
+// Lines must not exceed the limit
+func batch(lines []string, limit int) (string, []string) {
+	n := utf8.RuneCountInString(lines[0])
+	i := 1
+	for ; i < len(lines); i++ {
+		// Lines are separated by a newline
+		n += 1 + utf8.RuneCountInString(lines[i])
+		if n > limit {
+			break
+		}
+	}
+	return strings.Join(lines[:i], "\n"), lines[i:]
+}
+
+// Matches BBCode tags, TeamSpeak clients wrap links in [URL] tags
+var bbCode = regexp.MustCompile(`\[/?[a-zA-Z*]+(=[^\]]*)?\]`)
+
+// Splits text into parts of at most limit characters, preferably at spaces
+func split(text string, limit int) []string {
+	var parts []string
+	for utf8.RuneCountInString(text) > limit {
+		runes := []rune(text)
+		cut := limit
+		head := string(runes[:limit])
+		if i := strings.LastIndex(head, " "); i > 0 {
+			cut = utf8.RuneCountInString(head[:i])
+		}
+		parts = append(parts, strings.TrimSpace(string(runes[:cut])))
+		text = strings.TrimSpace(string(runes[cut:]))
+	}
+	if text != "" {
+		parts = append(parts, text)
+	}
+	return parts
+}
+
+// Returns the delay before the next connection attempt,
+// exponential with full jitter
+func backoff(attempt int) time.Duration {
+	d := minBackoff << min(attempt, 10)
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	return time.Duration(rand.Int63n(int64(d))) + minBackoff
+}
+
+// NewBridge creates a new chat bridge
+func NewBridge(cfg Config) (*Bridge, error) {
+	if cfg.Bot == nil {
+		return nil, fmt.Errorf("chat: bot is nil")
+	}
+
+	if cfg.DB == nil {
+		return nil, fmt.Errorf("chat: database service is nil")
+	}
+
+	if cfg.TokenSource == nil {
+		return nil, fmt.Errorf("chat: token source is nil")
+	}
+
+	if cfg.Login == "" || cfg.Channel == "" {
+		return nil, fmt.Errorf("chat: login or channel is empty")
+	}
+
+	if cfg.ChannelID <= 0 {
+		return nil, fmt.Errorf("chat: teamspeak channel is not set")
+	}
+
+	logger := log.NewLogger(
+		log.WithOwnLogFile("chat.log"),
+		log.WithName("chat"),
+		log.WithConsole(cfg.Console),
+		log.WithDebug(cfg.Debug),
+	)
+
+	return &Bridge{
+		bot:         cfg.Bot,
+		db:          cfg.DB,
+		tokenSource: cfg.TokenSource,
+		login:       strings.ToLower(cfg.Login),
+		channel:     strings.ToLower(strings.TrimPrefix(cfg.Channel, "#")),
+		channelID:   cfg.ChannelID,
+		toTwitch:    cfg.ToTwitch,
+		limiter:     newLimiter(cfg.RateLimit, rateLimitWindow),
+		logger:      logger,
+		outgoing:    make(chan string, outgoingBuffer),
+		incoming:    make(chan string, incomingBuffer),
+	}, nil
+}
+
+const (
+	serverAddr = "irc.chat.twitch.tv:6697"
+	// TeamSpeak limits text messages to 1024 characters,
+	// leaves room for escaping
+	teamSpeakMaxLength = 900
+	twitchMaxLength    = 500
+	rateLimitWindow    = 30 * time.Second
+	outgoingBuffer     = 32
+	// Relayed messages per window, stays well below the default
+	// ServerQuery flood protection of 10 commands per 3 seconds
+	teamSpeakRateLimit  = 2
+	teamSpeakRateWindow = 3 * time.Second
+	incomingBuffer      = 64
+	minBackoff          = time.Second
+	maxBackoff          = 2 * time.Minute
+	// Connections lasting longer reset the backoff
+	stableAfter = time.Minute
+)
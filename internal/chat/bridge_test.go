@@ -0,0 +1,179 @@
+package chat
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/devusSs/twitchspeak/pkg/log"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		limit int
+		want  []string
+	}{
+		{"empty", "", 10, nil},
+		{"short", "hello", 10, []string{"hello"}},
+		{"exactly limit", "hello", 5, []string{"hello"}},
+		{"at space", "hello world foo", 11, []string{"hello", "world foo"}},
+		{"trims spaces", "hello   world", 8, []string{"hello", "world"}},
+		{"without spaces", "abcdefghij", 4, []string{"abcd", "efgh", "ij"}},
+		{"multibyte", "äöüäöü", 4, []string{"äöüä", "öü"}},
+		{"multibyte at space", "grüße aus köln", 8, []string{"grüße", "aus köln"}},
+		{"emoji", "😀😀😀", 2, []string{"😀😀", "😀"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := split(tt.text, tt.limit); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("split(%q, %d) = %q, want %q", tt.text, tt.limit, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBadges(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want string
+	}{
+		{"", ""},
+		{"broadcaster/1,subscriber/12", "[Broadcaster] [Sub] "},
+		{"moderator/1,glhf-pledge/1,vip/1", "[Mod] [VIP] "},
+		{"subscriber/3012", "[Sub] "},
+		{"founder/0", "[Founder] "},
+		{"premium/1", ""},
+	}
+
+	for _, tt := range tests {
+		if got := badges(tt.tag); got != tt.want {
+			t.Errorf("badges(%q) = %q, want %q", tt.tag, got, tt.want)
+		}
+	}
+}
+
+func TestBatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		lines    []string
+		limit    int
+		want     string
+		wantRest []string
+	}{
+		{"single", []string{"abc"}, 5, "abc", []string{}},
+		{"all fit", []string{"ab", "cd"}, 5, "ab\ncd", []string{}},
+		{"rest", []string{"ab", "cd", "ef"}, 5, "ab\ncd", []string{"ef"}},
+		{"first fills limit", []string{"abcde", "f"}, 5, "abcde", []string{"f"}},
+		{"multibyte", []string{"äö", "üß"}, 5, "äö\nüß", []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, rest := batch(tt.lines, tt.limit)
+			if got != tt.want {
+				t.Fatalf("batch() message = %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(rest, tt.wantRest) {
+				t.Fatalf("batch() rest = %q, want %q", rest, tt.wantRest)
+			}
+		})
+	}
+}
+
+func TestToTeamSpeak(t *testing.T) {
+	log.SetDefaultLogsDirectory(t.TempDir())
+
+	tests := []struct {
+		name string
+		line string
+		want []string
+	}{
+		{
+			name: "message",
+			line: "@badges=moderator/1;display-name=Cool_User :cool_user!cool_user@cool_user.tmi.twitch.tv PRIVMSG #channel :hello",
+			want: []string{"[Mod] [B]Cool_User:[/B] hello"},
+		},
+		{
+			name: "action",
+			line: "@badges=;display-name=Cool_User :cool_user!cool_user@cool_user.tmi.twitch.tv PRIVMSG #channel :\x01ACTION waves\x01",
+			want: []string{"* [B]Cool_User[/B] waves"},
+		},
+		{
+			name: "nick without display name",
+			line: ":cool_user!cool_user@cool_user.tmi.twitch.tv PRIVMSG #channel :hello",
+			want: []string{"[B]cool_user:[/B] hello"},
+		},
+		{
+			name: "bbcode is escaped",
+			line: "@display-name=Cool_User :cool_user!cool_user@cool_user.tmi.twitch.tv PRIVMSG #channel :[URL]https://evil.example.com[/URL]",
+			want: []string{"[B]Cool_User:[/B] [\u200bURL\u200b]https://evil.example.com[\u200b/URL\u200b]"},
+		},
+		{
+			name: "own messages are ignored",
+			line: "@display-name=Bot :bot!bot@bot.tmi.twitch.tv PRIVMSG #channel :[TS] someone: hi",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			br := &Bridge{
+				login:    "bot",
+				incoming: make(chan string, incomingBuffer),
+				logger:   log.NewLogger(log.WithOwnLogFile("chat.log")),
+			}
+
+			msg, err := parseMessage(tt.line)
+			if err != nil {
+				t.Fatalf("parsing message: %v", err)
+			}
+
+			br.toTeamSpeak(msg)
+			close(br.incoming)
+
+			var got []string
+			for line := range br.incoming {
+				got = append(got, line)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("queued %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("long messages are split", func(t *testing.T) {
+		br := &Bridge{
+			login:    "bot",
+			incoming: make(chan string, incomingBuffer),
+			logger:   log.NewLogger(log.WithOwnLogFile("chat.log")),
+		}
+
+		text := strings.TrimSpace(strings.Repeat("wörd ", teamSpeakMaxLength))
+		msg, err := parseMessage(":cool_user!cool_user@cool_user.tmi.twitch.tv PRIVMSG #channel :" + text)
+		if err != nil {
+			t.Fatalf("parsing message: %v", err)
+		}
+
+		br.toTeamSpeak(msg)
+		close(br.incoming)
+
+		var parts []string
+		for line := range br.incoming {
+			if n := utf8.RuneCountInString(line); n > teamSpeakMaxLength {
+				t.Fatalf("part has %d characters, limit is %d", n, teamSpeakMaxLength)
+			}
+			parts = append(parts, line)
+		}
+
+		if len(parts) < 2 {
+			t.Fatalf("got %d parts, want at least 2", len(parts))
+		}
+		if got := strings.Join(parts, " "); got != "[B]cool_user:[/B] "+text {
+			t.Fatalf("parts do not add up to the message: %q", got)
+		}
+	})
+}
@@ -0,0 +1,157 @@
+package chat
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A single IRC message
+type message struct {
+	// IRCv3 tags, Twitch sends badges and display names as tags
+	Tags    map[string]string
+	Prefix  string
+	Command string
+	Params  []string
+}
+
+// Returns the nickname of the sender
+func (m *message) nick() string {
+	nick, _, _ := strings.Cut(m.Prefix, "!")
+	return nick
+}
+
+// Returns the last parameter, usually the text of the message
+func (m *message) trailing() string {
+	if len(m.Params) == 0 {
+		return ""
+	}
+	return m.Params[len(m.Params)-1]
+}
+
+// Parses a line received from the server
+func parseMessage(line string) (*message, error) {
+	line = strings.TrimRight(line, "\r\n")
+	raw := line
+	m := &message{}
+
+	if strings.HasPrefix(line, "@") {
+		tags, rest, ok := strings.Cut(line[1:], " ")
+		if !ok {
+			return nil, fmt.Errorf("invalid message %q", raw)
+		}
+		m.Tags = parseTags(tags)
+		line = rest
+	}
+
+	if strings.HasPrefix(line, ":") {
+		prefix, rest, ok := strings.Cut(line[1:], " ")
+		if !ok {
+			return nil, fmt.Errorf("invalid message %q", raw)
+		}
+		m.Prefix = prefix
+		line = rest
+	}
+
+	for line != "" {
+		if strings.HasPrefix(line, ":") {
+			m.Params = append(m.Params, line[1:])
+			break
+		}
+
+		param, rest, _ := strings.Cut(line, " ")
+		if m.Command == "" {
+			m.Command = param
+		} else {
+			m.Params = append(m.Params, param)
+		}
+		line = rest
+	}
+
+	if m.Command == "" {
+		return nil, fmt.Errorf("invalid message %q", raw)
+	}
+
+	return m, nil
+}
+
+// Parses IRCv3 message tags
+func parseTags(s string) map[string]string {
+	tags := make(map[string]string)
+	for _, tag := range strings.Split(s, ";") {
+		key, value, _ := strings.Cut(tag, "=")
+		tags[key] = tagUnescaper.Replace(value)
+	}
+	return tags
+}
+
+var tagUnescaper = strings.NewReplacer(
+	`\:`, ";",
+	`\s`, " ",
+	`\\`, `\`,
+	`\r`, "\r",
+	`\n`, "\n",
+)
+
+// Connection to an IRC server, send is safe for concurrent use
+type conn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+
+	mu sync.Mutex
+}
+
+// Connects to the IRC server via TLS
+func dial(ctx context.Context, addr string) (*conn, error) {
+	dialer := &tls.Dialer{NetDialer: &net.Dialer{Timeout: dialTimeout}}
+	c, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{conn: c, reader: bufio.NewReader(c)}, nil
+}
+
+// Sends a single line, line breaks are not allowed within messages
+func (c *conn) send(format string, args ...any) error {
+	line := fmt.Sprintf(format, args...)
+	line = strings.NewReplacer("\r", " ", "\n", " ").Replace(line)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.conn.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil {
+		return err
+	}
+	_, err := c.conn.Write([]byte(line + "\r\n"))
+	return err
+}
+
+// Reads the next message, fails if nothing is received for readTimeout
+func (c *conn) read() (*message, error) {
+	if err := c.conn.SetReadDeadline(time.Now().Add(readTimeout)); err != nil {
+		return nil, err
+	}
+
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	return parseMessage(line)
+}
+
+func (c *conn) close() error {
+	return c.conn.Close()
+}
+
+const (
+	dialTimeout  = 10 * time.Second
+	writeTimeout = 10 * time.Second
+	// Twitch sends a PING about every 5 minutes
+	readTimeout = 6 * time.Minute
+)
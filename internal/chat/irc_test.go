@@ -0,0 +1,156 @@
+package chat
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMessage(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    *message
+		wantErr bool
+	}{
+		{
+			name: "ping",
+			line: "PING :tmi.twitch.tv\r\n",
+			want: &message{Command: "PING", Params: []string{"tmi.twitch.tv"}},
+		},
+		{
+			name: "privmsg with tags",
+			line: `@badge-info=subscriber/8;badges=moderator/1,subscriber/6;color=#0D4200;display-name=Cool_User;emotes=;id=b34ccfc7;mod=1;user-id=1337 :cool_user!cool_user@cool_user.tmi.twitch.tv PRIVMSG #channel :Kappa Keepo Kappa` + "\r\n",
+			want: &message{
+				Tags: map[string]string{
+					"badge-info":   "subscriber/8",
+					"badges":       "moderator/1,subscriber/6",
+					"color":        "#0D4200",
+					"display-name": "Cool_User",
+					"emotes":       "",
+					"id":           "b34ccfc7",
+					"mod":          "1",
+					"user-id":      "1337",
+				},
+				Prefix:  "cool_user!cool_user@cool_user.tmi.twitch.tv",
+				Command: "PRIVMSG",
+				Params:  []string{"#channel", "Kappa Keepo Kappa"},
+			},
+		},
+		{
+			name: "escaped tag values",
+			line: `@system-msg=Cool_User\ssubscribed\:\sthanks\\;empty;flag= :tmi.twitch.tv USERNOTICE #channel`,
+			want: &message{
+				Tags: map[string]string{
+					"system-msg": `Cool_User subscribed; thanks\`,
+					"empty":      "",
+					"flag":       "",
+				},
+				Prefix:  "tmi.twitch.tv",
+				Command: "USERNOTICE",
+				Params:  []string{"#channel"},
+			},
+		},
+		{
+			name: "action",
+			line: ":cool_user!cool_user@cool_user.tmi.twitch.tv PRIVMSG #channel :\x01ACTION waves\x01",
+			want: &message{
+				Prefix:  "cool_user!cool_user@cool_user.tmi.twitch.tv",
+				Command: "PRIVMSG",
+				Params:  []string{"#channel", "\x01ACTION waves\x01"},
+			},
+		},
+		{
+			name: "trailing with colons",
+			line: ":nick PRIVMSG #channel :see https://example.com :)",
+			want: &message{
+				Prefix:  "nick",
+				Command: "PRIVMSG",
+				Params:  []string{"#channel", "see https://example.com :)"},
+			},
+		},
+		{
+			name: "empty trailing",
+			line: ":nick PRIVMSG #channel :",
+			want: &message{Prefix: "nick", Command: "PRIVMSG", Params: []string{"#channel", ""}},
+		},
+		{
+			name: "middle params without trailing",
+			line: ":tmi.twitch.tv CAP * ACK",
+			want: &message{Prefix: "tmi.twitch.tv", Command: "CAP", Params: []string{"*", "ACK"}},
+		},
+		{
+			name: "numeric",
+			line: ":tmi.twitch.tv 001 bot :Welcome, GLHF!",
+			want: &message{Prefix: "tmi.twitch.tv", Command: "001", Params: []string{"bot", "Welcome, GLHF!"}},
+		},
+		{
+			name: "command only",
+			line: "RECONNECT",
+			want: &message{Command: "RECONNECT"},
+		},
+		{
+			name:    "empty",
+			line:    "\r\n",
+			wantErr: true,
+		},
+		{
+			name:    "tags only",
+			line:    "@badges=",
+			wantErr: true,
+		},
+		{
+			name:    "prefix only",
+			line:    ":tmi.twitch.tv",
+			wantErr: true,
+		},
+		{
+			name:    "prefix without command",
+			line:    ":tmi.twitch.tv :text",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseMessage(tt.line)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseMessage() = %+v, want error", got)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("parseMessage() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMessageNickAndTrailing(t *testing.T) {
+	tests := []struct {
+		line         string
+		wantNick     string
+		wantTrailing string
+	}{
+		{":cool_user!cool_user@cool_user.tmi.twitch.tv PRIVMSG #channel :hi", "cool_user", "hi"},
+		{":tmi.twitch.tv PING", "tmi.twitch.tv", ""},
+		{"PING :tmi.twitch.tv", "", "tmi.twitch.tv"},
+	}
+
+	for _, tt := range tests {
+		m, err := parseMessage(tt.line)
+		if err != nil {
+			t.Fatalf("parsing %q: %v", tt.line, err)
+		}
+		if got := m.nick(); got != tt.wantNick {
+			t.Errorf("nick() of %q = %q, want %q", tt.line, got, tt.wantNick)
+		}
+		if got := m.trailing(); got != tt.wantTrailing {
+			t.Errorf("trailing() of %q = %q, want %q", tt.line, got, tt.wantTrailing)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package chat
+
+import (
+	"context"
+	"time"
+)
+
+// Limits the amount of messages sent within a sliding window,
+// not safe for concurrent use
+type limiter struct {
+	limit  int
+	window time.Duration
+	sent   []time.Time
+}
+
+// Blocks until another message may be sent or context is canceled
+func (l *limiter) wait(ctx context.Context) error {
+	for {
+		now := time.Now()
+
+		for len(l.sent) > 0 && now.Sub(l.sent[0]) >= l.window {
+			l.sent = l.sent[1:]
+		}
+
+		if len(l.sent) < l.limit {
+			l.sent = append(l.sent, now)
+			return nil
+		}
+
+		timer := time.NewTimer(l.window - now.Sub(l.sent[0]))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func newLimiter(limit int, window time.Duration) *limiter {
+	return &limiter{
+		limit:  max(limit, 1),
+		window: window,
+	}
+}
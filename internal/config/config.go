@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"path/filepath"
 	"reflect"
+	"time"
 
 	"github.com/caarlos0/env/v10"
 	"github.com/joho/godotenv"
@@ -12,14 +13,86 @@ import (
 
 // Config is the struct that holds the configuration for the application.
 type Config struct {
-	APIPort     uint   `env:"API_PORT"     envDefault:"8080"                  print:"true"`
-	FrontendURL string `env:"FRONTEND_URL" envDefault:"http://localhost:5173" print:"true"`
-	BackendURL  string `env:"BACKEND_URL"  envDefault:"http://localhost:8080" print:"true"`
-	SecretKey   string `env:"SECRET_KEY"                                      print:"false"`
+	APIPort          uint          `env:"API_PORT"            envDefault:"8080"                  print:"true"`
+	FrontendURL      string        `env:"FRONTEND_URL"        envDefault:"http://localhost:5173" print:"true"`
+	BackendURL       string        `env:"BACKEND_URL"         envDefault:"http://localhost:8080" print:"true"`
+	SecretKey        string        `env:"SECRET_KEY"                                             print:"false"`
+	LinkTokenTTL     time.Duration `env:"LINK_TOKEN_TTL"      envDefault:"15m"                   print:"true"`
+	APIKeysRateLimit int           `env:"API_KEYS_RATE_LIMIT" envDefault:"60"                    print:"true"`
 
-	TwitchClientID     string `env:"TWITCH_CLIENT_ID"     print:"false"`
-	TwitchClientSecret string `env:"TWITCH_CLIENT_SECRET" print:"false"`
-	TwitchRedirectURI  string `env:"TWITCH_REDIRECT_URI"  print:"true"`
+	// Optional, grants moderator and admin roles on the HTTP API
+	AdminTwitchIDs         string        `env:"ADMIN_TWITCH_IDS"         envDefault:""     print:"true"`
+	ModeratorTwitchIDs     string        `env:"MODERATOR_TWITCH_IDS"     envDefault:""     print:"true"`
+	AdminServerGroups      string        `env:"ADMIN_SERVER_GROUPS"      envDefault:""     print:"true"`
+	ModeratorServerGroups  string        `env:"MODERATOR_SERVER_GROUPS"  envDefault:""     print:"true"`
+	AccessTwitchModerators bool          `env:"ACCESS_TWITCH_MODERATORS" envDefault:"true" print:"true"`
+	AccessCacheTTL         time.Duration `env:"ACCESS_CACHE_TTL"         envDefault:"1m"   print:"true"`
+
+	TwitchClientID     string `env:"TWITCH_CLIENT_ID"                                                    print:"false"`
+	TwitchClientSecret string `env:"TWITCH_CLIENT_SECRET"                                                print:"false"`
+	TwitchRedirectURI  string `env:"TWITCH_REDIRECT_URI"                                                 print:"true"`
+	TwitchIssuerURL    string `env:"TWITCH_ISSUER_URL"    envDefault:"https://id.twitch.tv/oauth2"      print:"true"`
+	TwitchJWKSURL      string `env:"TWITCH_JWKS_URL"      envDefault:"https://id.twitch.tv/oauth2/keys" print:"true"`
+	TwitchPKCE         bool   `env:"TWITCH_PKCE"          envDefault:"true"                             print:"true"`
+
+	// Optional, enables mapping Twitch relationships to TeamSpeak server groups
+	TwitchBroadcasterID           string        `env:"TWITCH_BROADCASTER_ID"            envDefault:""      print:"true"`
+	TwitchBroadcasterRefreshToken string        `env:"TWITCH_BROADCASTER_REFRESH_TOKEN" envDefault:""      print:"false"`
+	TwitchRoleRules               string        `env:"TWITCH_ROLE_RULES"                envDefault:""      print:"true"`
+	TwitchRoleSyncInterval        time.Duration `env:"TWITCH_ROLE_SYNC_INTERVAL"        envDefault:"1h"    print:"true"`
+	TwitchRoleSyncDryRun          bool          `env:"TWITCH_ROLE_SYNC_DRY_RUN"         envDefault:"false" print:"true"`
+
+	WelcomeEnabled      bool          `env:"WELCOME_ENABLED"       envDefault:"true"    print:"true"`
+	WelcomeMode         string        `env:"WELCOME_MODE"          envDefault:"message" print:"true"`
+	WelcomeLinked       bool          `env:"WELCOME_LINKED"        envDefault:"false"   print:"true"`
+	WelcomeTemplatesDir string        `env:"WELCOME_TEMPLATES_DIR" envDefault:""        print:"true"`
+	WelcomeThrottle     time.Duration `env:"WELCOME_THROTTLE"      envDefault:"1h"      print:"true"`
+
+	// Optional, receives Twitch EventSub notifications via webhook
+	EventSubEnabled           bool          `env:"EVENTSUB_ENABLED"            envDefault:"false" print:"true"`
+	EventSubCallbackURL       string        `env:"EVENTSUB_CALLBACK_URL"       envDefault:""      print:"true"`
+	EventSubSecret            string        `env:"EVENTSUB_SECRET"             envDefault:""      print:"false"`
+	EventSubReconcileInterval time.Duration `env:"EVENTSUB_RECONCILE_INTERVAL" envDefault:"1h"    print:"true"`
+
+	// Optional, posts messages to TeamSpeak when channels go live
+	StreamsEnabled          bool          `env:"STREAMS_ENABLED"           envDefault:"false"   print:"true"`
+	StreamsSource           string        `env:"STREAMS_SOURCE"            envDefault:"polling" print:"true"`
+	StreamsChannels         string        `env:"STREAMS_CHANNELS"          envDefault:""        print:"true"`
+	StreamsLinked           bool          `env:"STREAMS_LINKED"            envDefault:"true"    print:"true"`
+	StreamsPollInterval     time.Duration `env:"STREAMS_POLL_INTERVAL"     envDefault:"1m"      print:"true"`
+	StreamsTeamspeakChannel int           `env:"STREAMS_TEAMSPEAK_CHANNEL" envDefault:"0"       print:"true"`
+	StreamsServerChat       bool          `env:"STREAMS_SERVER_CHAT"       envDefault:"false"   print:"true"`
+	StreamsLiveGroup        int           `env:"STREAMS_LIVE_GROUP"        envDefault:"0"       print:"true"`
+	StreamsTemplate         string        `env:"STREAMS_TEMPLATE"          envDefault:""        print:"true"`
+
+	// Optional, creates channels for linked streamers
+	TempChannelsEnabled      bool          `env:"TEMP_CHANNELS_ENABLED"       envDefault:"false" print:"true"`
+	TempChannelsParent       int           `env:"TEMP_CHANNELS_PARENT"        envDefault:"0"     print:"true"`
+	TempChannelsChannelGroup int           `env:"TEMP_CHANNELS_CHANNEL_GROUP" envDefault:"5"     print:"true"`
+	TempChannelsServerGroup  int           `env:"TEMP_CHANNELS_SERVER_GROUP"  envDefault:"0"     print:"true"`
+	TempChannelsOnLive       bool          `env:"TEMP_CHANNELS_ON_LIVE"       envDefault:"true"  print:"true"`
+	TempChannelsEmptyTimeout time.Duration `env:"TEMP_CHANNELS_EMPTY_TIMEOUT" envDefault:"15m"   print:"true"`
+
+	// Optional, applies Twitch bans and timeouts of linked users in TeamSpeak
+	BansEnabled      bool          `env:"BANS_ENABLED"       envDefault:"false" print:"true"`
+	BansPermanent    string        `env:"BANS_PERMANENT"     envDefault:"ban"   print:"true"`
+	BansTimeout      string        `env:"BANS_TIMEOUT"       envDefault:"mute"  print:"true"`
+	BansMuteGroup    int           `env:"BANS_MUTE_GROUP"    envDefault:"0"     print:"true"`
+	BansAllowlist    string        `env:"BANS_ALLOWLIST"     envDefault:""      print:"true"`
+	BansSyncInterval time.Duration `env:"BANS_SYNC_INTERVAL" envDefault:"1h"    print:"true"`
+
+	// Optional, mirrors Twitch chat into a TeamSpeak channel
+	ChatEnabled          bool   `env:"CHAT_ENABLED"           envDefault:"false" print:"true"`
+	ChatChannel          string `env:"CHAT_CHANNEL"           envDefault:""      print:"true"`
+	ChatLogin            string `env:"CHAT_LOGIN"             envDefault:""      print:"true"`
+	ChatRefreshToken     string `env:"CHAT_REFRESH_TOKEN"     envDefault:""      print:"false"`
+	ChatTeamspeakChannel int    `env:"CHAT_TEAMSPEAK_CHANNEL" envDefault:"0"     print:"true"`
+	ChatToTwitch         bool   `env:"CHAT_TO_TWITCH"         envDefault:"false" print:"true"`
+	ChatRateLimit        int    `env:"CHAT_RATE_LIMIT"        envDefault:"20"    print:"true"`
+
+	// Optional, triggers TeamSpeak actions for channel points redemptions
+	RewardsEnabled bool   `env:"REWARDS_ENABLED" envDefault:"false" print:"true"`
+	Rewards        string `env:"REWARDS"         envDefault:""      print:"true"`
 
 	PostgresHost     string `env:"POSTGRES_HOST"     envDefault:"localhost" print:"true"`
 	PostgresPort     uint   `env:"POSTGRES_PORT"     envDefault:"5432"      print:"true"`
@@ -32,12 +105,15 @@ type Config struct {
 	RedisPassword string `env:"REDIS_PASSWORD" envDefault:""          print:"false"`
 	RedisDB       uint   `env:"REDIS_DB"       envDefault:"0"         print:"true"`
 
-	TeamspeakHost      string `env:"TEAMSPEAK_HOST"       envDefault:"localhost" print:"true"`
-	TeamspeakQueryPort uint   `env:"TEAMSPEAK_QUERY_PORT" envDefault:"10011"     print:"true"`
-	TeamspeakPort      uint   `env:"TEAMSPEAK_PORT"       envDefault:"9987"      print:"true"`
-	TeamspeakUser      string `env:"TEAMSPEAK_USER"                              print:"false"`
-	TeamspeakPassword  string `env:"TEAMSPEAK_PASSWORD"                          print:"false"`
-	TeamspeakNickname  string `env:"TEAMSPEAK_NICKNAME"                          print:"true"`
+	TeamspeakHost                 string        `env:"TEAMSPEAK_HOST"                   envDefault:"localhost" print:"true"`
+	TeamspeakQueryPort            uint          `env:"TEAMSPEAK_QUERY_PORT"             envDefault:"10011"     print:"true"`
+	TeamspeakPort                 uint          `env:"TEAMSPEAK_PORT"                   envDefault:"9987"      print:"true"`
+	TeamspeakUser                 string        `env:"TEAMSPEAK_USER"                                          print:"false"`
+	TeamspeakPassword             string        `env:"TEAMSPEAK_PASSWORD"                                      print:"false"`
+	TeamspeakNickname             string        `env:"TEAMSPEAK_NICKNAME"                                      print:"true"`
+	TeamspeakCommandPrefix        string        `env:"TEAMSPEAK_COMMAND_PREFIX"         envDefault:"!"         print:"true"`
+	TeamspeakKeepAliveInterval    time.Duration `env:"TEAMSPEAK_KEEPALIVE_INTERVAL"     envDefault:"1m"        print:"true"`
+	TeamspeakReconnectMaxAttempts int           `env:"TEAMSPEAK_RECONNECT_MAX_ATTEMPTS" envDefault:"10"        print:"true"`
 }
 
 // String returns the string representation of the config struct.
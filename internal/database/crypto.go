@@ -0,0 +1,79 @@
+package database
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Cipher encrypts and decrypts values stored at rest using AES-GCM
+type Cipher struct {
+	aead cipher.AEAD
+}
+
+// Encrypt encrypts plain and returns the base64 encoded nonce and ciphertext
+func (c *Cipher) Encrypt(plain string) (string, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", fmt.Errorf("generating nonce: %w", err)
+	}
+
+	sealed := c.aead.Seal(nonce, nonce, []byte(plain), nil)
+
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt decrypts a value previously encrypted with Encrypt
+func (c *Cipher) Decrypt(encrypted string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return "", fmt.Errorf("decoding value: %w", err)
+	}
+
+	if len(sealed) < c.aead.NonceSize() {
+		return "", errors.New("encrypted value too short")
+	}
+
+	nonce, ciphertext := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+
+	plain, err := c.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("decrypting value: %w", err)
+	}
+
+	return string(plain), nil
+}
+
+// NewCipher creates a new cipher with a key derived from secret
+func NewCipher(secret string) (*Cipher, error) {
+	if secret == "" {
+		return nil, errors.New("secret is empty")
+	}
+
+	// Derive a dedicated key so the secret itself is never used for encryption
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(cipherKeyContext))
+	key := mac.Sum(nil)
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Cipher{aead: aead}, nil
+}
+
+const (
+	cipherKeyContext = "twitchspeak token encryption v1"
+)
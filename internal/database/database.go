@@ -2,7 +2,17 @@ package database
 
 import (
 	"database/sql"
+	"errors"
 	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// Custom errors
+var (
+	ErrNotFound      = errors.New("record not found")
+	ErrAlreadyLinked = errors.New("teamspeak identity or twitch account already linked")
+	ErrAlreadyExists = errors.New("record already exists")
 )
 
 type Service interface {
@@ -13,12 +23,90 @@ type Service interface {
 	Migrate() error
 
 	AddUser(user *User) (*User, error)
+	// Links a TeamSpeak identity to a Twitch account, returns the existing
+	// user and ErrAlreadyLinked if either of them is already linked
+	LinkUser(teamSpeakUID string, twitchID string) (*User, error)
 	GetUserByTwitchID(twichID string) (*User, error)
+	GetUserByTeamSpeakUID(teamSpeakUID string) (*User, error)
+	// Saves all fields of an existing user
+	UpdateUser(user *User) error
+	DeleteUserByTeamSpeakUID(teamSpeakUID string) error
+	// Returns a page of users ordered by ID and the total amount of users matching the filters
+	ListUsers(opts ListOptions) ([]*User, int64, error)
+	SetNeedsReauth(twitchID string, needsReauth bool) error
+	// Sets or clears (nil) the revocation of the user
+	SetRevokedAt(twitchID string, revokedAt *time.Time) error
+	// Only updates the TeamSpeak details, leaving concurrent writes to other fields intact
+	SetTeamSpeakDetails(teamSpeakUID string, dbID int, nickname string, country string, seenAt time.Time) error
+	// Only updates the Twitch details, leaving concurrent writes to other fields intact
+	SetTwitchDetails(twitchID string, login string, displayName string, profileImageURL string) error
+
+	// Tokens are encrypted before being stored
+	SaveToken(twitchID string, token *oauth2.Token) error
+	GetToken(twitchID string) (*oauth2.Token, error)
+	DeleteToken(twitchID string) error
+
+	AddAuditEvent(event *AuditEvent) error
+	// Returns a page of audit events ordered by newest first and the total amount of events
+	ListAuditEvents(opts ListOptions) ([]*AuditEvent, int64, error)
+
+	AddTempChannel(channel *TempChannel) error
+	GetTempChannelByTwitchID(twitchID string) (*TempChannel, error)
+	ListTempChannels() ([]*TempChannel, error)
+	DeleteTempChannel(channelID int) error
+
+	AddBan(ban *Ban) error
+	GetBanByTwitchID(twitchID string) (*Ban, error)
+	ListBans() ([]*Ban, error)
+	DeleteBan(twitchID string) error
 
-	// TODO: functions to integrate teamspeak details
+	// Creates the grant or saves all fields of an existing one
+	SaveGrant(grant *Grant) error
+	GetGrant(twitchID string, serverGroup int) (*Grant, error)
+	// Returns all grants expiring before the given time
+	ListExpiredGrants(before time.Time) ([]*Grant, error)
+	// Returns the grants of the user which have not expired yet
+	ListActiveGrants(twitchID string) ([]*Grant, error)
+	DeleteGrant(id uint) error
+	// Deletes all grants of the user, does not fail if there are none
+	DeleteGrantsByTwitchID(twitchID string) error
+
+	// Returns ErrAlreadyExists if the same rule exists already
+	AddRoleRule(rule *RoleRule) error
+	GetRoleRule(id uint) (*RoleRule, error)
+	ListRoleRules() ([]*RoleRule, error)
+	// Returns ErrAlreadyExists if the same rule exists already
+	UpdateRoleRule(rule *RoleRule) error
+	DeleteRoleRule(id uint) error
+	// Returns the server groups of deleted role rules
+	ListRetiredGroups() ([]int, error)
+	// Replaces the stored server groups of deleted role rules
+	SetRetiredGroups(groups []int) error
+
+	AddAPIKey(key *APIKey) error
+	GetAPIKey(id uint) (*APIKey, error)
+	GetAPIKeyByHash(hash string) (*APIKey, error)
+	// Returns the keys created by the user ordered by ID
+	ListAPIKeys(twitchID string) ([]*APIKey, error)
+	// Marks the key as revoked, returns ErrNotFound if it does not exist or is revoked already
+	RevokeAPIKey(id uint) error
+	SetAPIKeyLastUsed(id uint, at time.Time) error
+}
+
+// ListOptions for paginating and filtering list queries
+type ListOptions struct {
+	Offset int
+	// Maximum amount of results, 0 for no limit
+	Limit int
+
+	// Case insensitive search in TeamSpeak nickname, Twitch login and display name
+	Search string
+	// Only users who do (not) need to log in again, nil for all
+	NeedsReauth *bool
+	// Only users seen on TeamSpeak since, zero for all
+	SeenSince time.Time
 }
 
-// TODO: add more fields like the teamspeak details
 type User struct {
 	ID        uint      `gorm:"primarykey" json:"-"`
 	CreatedAt time.Time `                  json:"connected_since"`
@@ -26,4 +114,166 @@ type User struct {
 
 	TeamSpeakUID string `gorm:"uniqueIndex" json:"teamspeak_uid"`
 	TwitchID     string `gorm:"uniqueIndex" json:"twitch_id"`
+	// Set if Twitch rejected the stored refresh token
+	NeedsReauth bool `json:"needs_reauth"`
+	// Set if the user revoked the authorization of our app,
+	// revoked users are treated like unlinked ones until they login again
+	RevokedAt *time.Time `json:"revoked_at"`
+
+	// TeamSpeak details, updated every time the client enters the server
+	TeamSpeakDBID     int        `json:"teamspeak_dbid"`
+	TeamSpeakNickname string     `json:"teamspeak_nickname"`
+	TeamSpeakCountry  string     `json:"teamspeak_country"`
+	LastSeenAt        *time.Time `json:"last_seen_at"`
+
+	// Twitch details, updated every time the user logs in
+	TwitchLogin           string `json:"twitch_login"`
+	TwitchDisplayName     string `json:"twitch_display_name"`
+	TwitchProfileImageURL string `json:"twitch_profile_image_url"`
+}
+
+// Revoked returns whether the user revoked the authorization of our app
+func (u *User) Revoked() bool {
+	return u.RevokedAt != nil
+}
+
+// Token holds the encrypted oauth2 tokens of a Twitch account
+type Token struct {
+	ID        uint      `gorm:"primarykey" json:"-"`
+	CreatedAt time.Time `                  json:"-"`
+	UpdatedAt time.Time `                  json:"-"`
+
+	TwitchID     string    `gorm:"uniqueIndex" json:"-"`
+	AccessToken  string    `                   json:"-"`
+	RefreshToken string    `                   json:"-"`
+	TokenType    string    `                   json:"-"`
+	Expiry       time.Time `                   json:"-"`
+}
+
+// Audit actions
+const (
+	AuditAuthorizationRevoked = "authorization_revoked"
+	AuditBanned               = "banned"
+	AuditUnbanned             = "unbanned"
+	AuditRewardRedeemed       = "reward_redeemed"
+	AuditGrantAdded           = "grant_added"
+	AuditGrantExpired         = "grant_expired"
+	AuditLinked               = "linked"
+	AuditUnlinked             = "unlinked"
+	AuditRoleRuleAdded        = "role_rule_added"
+	AuditRoleRuleUpdated      = "role_rule_updated"
+	AuditRoleRuleDeleted      = "role_rule_deleted"
+	AuditAPIKeyCreated        = "api_key_created"
+	AuditAPIKeyRevoked        = "api_key_revoked"
+)
+
+// AuditEvent records a noteworthy change made by twitchspeak
+type AuditEvent struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `                  json:"created_at"`
+
+	Action       string `gorm:"index" json:"action"`
+	TeamSpeakUID string `gorm:"index" json:"teamspeak_uid"`
+	TwitchID     string `gorm:"index" json:"twitch_id"`
+	// What triggered the event, e.g. "eventsub"
+	Source  string `json:"source"`
+	Details string `json:"details"`
+}
+
+// TempChannel is a TeamSpeak channel created for a linked streamer,
+// it gets deleted once it has been empty for a while
+type TempChannel struct {
+	ID        uint      `gorm:"primarykey" json:"-"`
+	CreatedAt time.Time `                  json:"created_at"`
+
+	TwitchID     string `gorm:"uniqueIndex" json:"twitch_id"`
+	TeamSpeakUID string `                   json:"teamspeak_uid"`
+	ChannelID    int    `gorm:"uniqueIndex" json:"channel_id"`
+}
+
+// Ban actions
+const (
+	BanActionBan  = "ban"
+	BanActionMute = "mute"
+)
+
+// Ban is a Twitch ban or timeout of a linked user applied in TeamSpeak
+type Ban struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `                  json:"created_at"`
+
+	TwitchID     string `gorm:"uniqueIndex" json:"twitch_id"`
+	TeamSpeakUID string `                   json:"teamspeak_uid"`
+	// Either a server ban or the mute server group
+	Action string `json:"action"`
+	// ID of the TeamSpeak server ban, only set for bans
+	TeamSpeakBanID int `json:"teamspeak_ban_id"`
+	// Nil for permanent bans
+	ExpiresAt *time.Time `json:"expires_at"`
+	Reason    string     `json:"reason"`
+	Moderator string     `json:"moderator"`
+}
+
+// Grant sources
+const (
+	GrantSourceChannelPoints = "channel_points"
+)
+
+// Grant is a server group granted to a linked user until it expires
+type Grant struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `                  json:"created_at"`
+	UpdatedAt time.Time `                  json:"-"`
+
+	TwitchID     string    `gorm:"index" json:"twitch_id"`
+	TeamSpeakUID string    `             json:"teamspeak_uid"`
+	ServerGroup  int       `             json:"server_group"`
+	ExpiresAt    time.Time `gorm:"index" json:"expires_at"`
+	// What granted the group, e.g. "channel_points"
+	Source string `json:"source"`
+}
+
+// RoleRule maps a Twitch relationship with the broadcaster to a TeamSpeak server group
+type RoleRule struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `                  json:"created_at"`
+	UpdatedAt time.Time `                  json:"updated_at"`
+
+	// e.g. "follower" or "tier1", see roles.Relationships
+	Relationship string `gorm:"uniqueIndex:idx_role_rule" json:"relationship"`
+	ServerGroup  int    `gorm:"uniqueIndex:idx_role_rule" json:"server_group"`
+}
+
+// RetiredGroup is the server group of a deleted role rule,
+// it is removed from users until a rule references it again
+type RetiredGroup struct {
+	ServerGroup int       `gorm:"primarykey;autoIncrement:false" json:"server_group"`
+	CreatedAt   time.Time `                                      json:"created_at"`
+}
+
+// APIKey allows scripts to use the API on behalf of the user who created it,
+// only the hash of the key is stored
+type APIKey struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `                  json:"created_at"`
+	UpdatedAt time.Time `                  json:"-"`
+
+	Name string `json:"name"`
+	// First characters of the key for telling keys apart
+	Prefix string `                   json:"prefix"`
+	Hash   string `gorm:"uniqueIndex" json:"-"`
+	// Twitch ID of the user who created the key
+	TwitchID string `gorm:"index" json:"twitch_id"`
+	// Comma separated permissions of the key
+	Scopes string `json:"-"`
+	// Requests per minute, 0 for the default
+	RateLimit  int        `json:"rate_limit"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+// Active returns whether the key is neither revoked nor expired
+func (k *APIKey) Active() bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || k.ExpiresAt.After(time.Now()))
 }
@@ -2,18 +2,23 @@ package psql
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/devusSs/twitchspeak/internal/database"
 	"github.com/devusSs/twitchspeak/pkg/log"
+	"golang.org/x/oauth2"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"gorm.io/gorm/logger"
 )
 
 type psql struct {
-	db *gorm.DB
+	db     *gorm.DB
+	cipher *database.Cipher
 }
 
 func (p *psql) TestConnection() error {
@@ -41,7 +46,17 @@ func (p *psql) GetDB() (*sql.DB, error) {
 }
 
 func (p *psql) Migrate() error {
-	return p.db.AutoMigrate(&database.User{})
+	return p.db.AutoMigrate(
+		&database.User{},
+		&database.Token{},
+		&database.AuditEvent{},
+		&database.TempChannel{},
+		&database.Ban{},
+		&database.Grant{},
+		&database.RoleRule{},
+		&database.RetiredGroup{},
+		&database.APIKey{},
+	)
 }
 
 func (p *psql) AddUser(user *database.User) (*database.User, error) {
@@ -52,15 +67,517 @@ func (p *psql) AddUser(user *database.User) (*database.User, error) {
 	return user, nil
 }
 
+func (p *psql) LinkUser(teamSpeakUID string, twitchID string) (*database.User, error) {
+	var user database.User
+	err := p.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("team_speak_uid = ? OR twitch_id = ?", teamSpeakUID, twitchID).
+			First(&user).Error
+		if err == nil {
+			return database.ErrAlreadyLinked
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		user = database.User{
+			TeamSpeakUID: teamSpeakUID,
+			TwitchID:     twitchID,
+		}
+		return tx.Create(&user).Error
+	})
+	if errors.Is(err, database.ErrAlreadyLinked) {
+		return &user, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
 func (p *psql) GetUserByTwitchID(twitchID string) (*database.User, error) {
 	var user database.User
 	err := p.db.Where("twitch_id = ?", twitchID).First(&user).Error
 	if err != nil {
-		return nil, err
+		return nil, wrapErr(err)
 	}
 	return &user, nil
 }
 
+func (p *psql) GetUserByTeamSpeakUID(teamSpeakUID string) (*database.User, error) {
+	var user database.User
+	err := p.db.Where("team_speak_uid = ?", teamSpeakUID).First(&user).Error
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	return &user, nil
+}
+
+func (p *psql) UpdateUser(user *database.User) error {
+	if user.ID == 0 {
+		return database.ErrNotFound
+	}
+
+	res := p.db.Model(user).Select("*").Omit("id", "created_at").Updates(user)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return database.ErrNotFound
+	}
+	return nil
+}
+
+func (p *psql) DeleteUserByTeamSpeakUID(teamSpeakUID string) error {
+	res := p.db.Where("team_speak_uid = ?", teamSpeakUID).Delete(&database.User{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return database.ErrNotFound
+	}
+	return nil
+}
+
+// Escapes the wildcards of LIKE patterns so searches match them literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+func (p *psql) ListUsers(opts database.ListOptions) ([]*database.User, int64, error) {
+	query := p.db.Model(&database.User{})
+
+	if opts.Search != "" {
+		search := "%" + likeEscaper.Replace(opts.Search) + "%"
+		query = query.Where(
+			`team_speak_nickname ILIKE ? ESCAPE '\' OR twitch_login ILIKE ? ESCAPE '\' OR twitch_display_name ILIKE ? ESCAPE '\'`,
+			search, search, search,
+		)
+	}
+
+	if opts.NeedsReauth != nil {
+		query = query.Where("needs_reauth = ?", *opts.NeedsReauth)
+	}
+
+	if !opts.SeenSince.IsZero() {
+		query = query.Where("last_seen_at >= ?", opts.SeenSince)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	query = query.Order("id").Offset(opts.Offset)
+	if opts.Limit > 0 {
+		query = query.Limit(opts.Limit)
+	}
+
+	var users []*database.User
+	if err := query.Find(&users).Error; err != nil {
+		return nil, 0, err
+	}
+	return users, total, nil
+}
+
+func (p *psql) SetNeedsReauth(twitchID string, needsReauth bool) error {
+	res := p.db.Model(&database.User{}).
+		Where("twitch_id = ?", twitchID).
+		Update("needs_reauth", needsReauth)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return database.ErrNotFound
+	}
+	return nil
+}
+
+func (p *psql) SetRevokedAt(twitchID string, revokedAt *time.Time) error {
+	res := p.db.Model(&database.User{}).
+		Where("twitch_id = ?", twitchID).
+		Update("revoked_at", revokedAt)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return database.ErrNotFound
+	}
+	return nil
+}
+
+func (p *psql) SetTeamSpeakDetails(teamSpeakUID string, dbID int, nickname string, country string, seenAt time.Time) error {
+	res := p.db.Model(&database.User{}).
+		Where("team_speak_uid = ?", teamSpeakUID).
+		Select("TeamSpeakDBID", "TeamSpeakNickname", "TeamSpeakCountry", "LastSeenAt").
+		Updates(&database.User{
+			TeamSpeakDBID:     dbID,
+			TeamSpeakNickname: nickname,
+			TeamSpeakCountry:  country,
+			LastSeenAt:        &seenAt,
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return database.ErrNotFound
+	}
+	return nil
+}
+
+func (p *psql) SetTwitchDetails(twitchID string, login string, displayName string, profileImageURL string) error {
+	res := p.db.Model(&database.User{}).
+		Where("twitch_id = ?", twitchID).
+		Select("TwitchLogin", "TwitchDisplayName", "TwitchProfileImageURL").
+		Updates(&database.User{
+			TwitchLogin:           login,
+			TwitchDisplayName:     displayName,
+			TwitchProfileImageURL: profileImageURL,
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return database.ErrNotFound
+	}
+	return nil
+}
+
+func (p *psql) SaveToken(twitchID string, token *oauth2.Token) error {
+	accessToken, err := p.cipher.Encrypt(token.AccessToken)
+	if err != nil {
+		return fmt.Errorf("encrypting access token: %w", err)
+	}
+
+	refreshToken, err := p.cipher.Encrypt(token.RefreshToken)
+	if err != nil {
+		return fmt.Errorf("encrypting refresh token: %w", err)
+	}
+
+	return p.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "twitch_id"}},
+		DoUpdates: clause.AssignmentColumns(
+			[]string{"updated_at", "access_token", "refresh_token", "token_type", "expiry"},
+		),
+	}).Create(&database.Token{
+		TwitchID:     twitchID,
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    token.TokenType,
+		Expiry:       token.Expiry,
+	}).Error
+}
+
+func (p *psql) GetToken(twitchID string) (*oauth2.Token, error) {
+	var token database.Token
+	err := p.db.Where("twitch_id = ?", twitchID).First(&token).Error
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+
+	accessToken, err := p.cipher.Decrypt(token.AccessToken)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting access token: %w", err)
+	}
+
+	refreshToken, err := p.cipher.Decrypt(token.RefreshToken)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting refresh token: %w", err)
+	}
+
+	return &oauth2.Token{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    token.TokenType,
+		Expiry:       token.Expiry,
+	}, nil
+}
+
+func (p *psql) DeleteToken(twitchID string) error {
+	res := p.db.Where("twitch_id = ?", twitchID).Delete(&database.Token{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return database.ErrNotFound
+	}
+	return nil
+}
+
+func (p *psql) AddAuditEvent(event *database.AuditEvent) error {
+	return p.db.Create(event).Error
+}
+
+func (p *psql) ListAuditEvents(opts database.ListOptions) ([]*database.AuditEvent, int64, error) {
+	var total int64
+	if err := p.db.Model(&database.AuditEvent{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	query := p.db.Order("id DESC").Offset(opts.Offset)
+	if opts.Limit > 0 {
+		query = query.Limit(opts.Limit)
+	}
+
+	var events []*database.AuditEvent
+	if err := query.Find(&events).Error; err != nil {
+		return nil, 0, err
+	}
+	return events, total, nil
+}
+
+func (p *psql) AddTempChannel(channel *database.TempChannel) error {
+	return p.db.Create(channel).Error
+}
+
+func (p *psql) GetTempChannelByTwitchID(twitchID string) (*database.TempChannel, error) {
+	var channel database.TempChannel
+	err := p.db.Where("twitch_id = ?", twitchID).First(&channel).Error
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	return &channel, nil
+}
+
+func (p *psql) ListTempChannels() ([]*database.TempChannel, error) {
+	var channels []*database.TempChannel
+	if err := p.db.Order("id").Find(&channels).Error; err != nil {
+		return nil, err
+	}
+	return channels, nil
+}
+
+func (p *psql) DeleteTempChannel(channelID int) error {
+	res := p.db.Where("channel_id = ?", channelID).Delete(&database.TempChannel{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return database.ErrNotFound
+	}
+	return nil
+}
+
+func (p *psql) AddBan(ban *database.Ban) error {
+	return p.db.Create(ban).Error
+}
+
+func (p *psql) GetBanByTwitchID(twitchID string) (*database.Ban, error) {
+	var ban database.Ban
+	err := p.db.Where("twitch_id = ?", twitchID).First(&ban).Error
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	return &ban, nil
+}
+
+func (p *psql) ListBans() ([]*database.Ban, error) {
+	var bans []*database.Ban
+	if err := p.db.Order("id").Find(&bans).Error; err != nil {
+		return nil, err
+	}
+	return bans, nil
+}
+
+func (p *psql) DeleteBan(twitchID string) error {
+	res := p.db.Where("twitch_id = ?", twitchID).Delete(&database.Ban{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return database.ErrNotFound
+	}
+	return nil
+}
+
+func (p *psql) SaveGrant(grant *database.Grant) error {
+	return p.db.Save(grant).Error
+}
+
+func (p *psql) GetGrant(twitchID string, serverGroup int) (*database.Grant, error) {
+	var grant database.Grant
+	err := p.db.Where("twitch_id = ? AND server_group = ?", twitchID, serverGroup).First(&grant).Error
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	return &grant, nil
+}
+
+func (p *psql) ListExpiredGrants(before time.Time) ([]*database.Grant, error) {
+	var grants []*database.Grant
+	if err := p.db.Where("expires_at < ?", before).Order("expires_at").Find(&grants).Error; err != nil {
+		return nil, err
+	}
+	return grants, nil
+}
+
+func (p *psql) ListActiveGrants(twitchID string) ([]*database.Grant, error) {
+	var grants []*database.Grant
+	err := p.db.Where("twitch_id = ? AND expires_at >= ?", twitchID, time.Now()).
+		Order("expires_at").
+		Find(&grants).Error
+	if err != nil {
+		return nil, err
+	}
+	return grants, nil
+}
+
+func (p *psql) DeleteGrant(id uint) error {
+	res := p.db.Delete(&database.Grant{}, id)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return database.ErrNotFound
+	}
+	return nil
+}
+
+func (p *psql) DeleteGrantsByTwitchID(twitchID string) error {
+	return p.db.Where("twitch_id = ?", twitchID).Delete(&database.Grant{}).Error
+}
+
+func (p *psql) AddRoleRule(rule *database.RoleRule) error {
+	return p.db.Transaction(func(tx *gorm.DB) error {
+		if err := roleRuleExists(tx, rule); err != nil {
+			return err
+		}
+		return tx.Create(rule).Error
+	})
+}
+
+func (p *psql) GetRoleRule(id uint) (*database.RoleRule, error) {
+	var rule database.RoleRule
+	if err := p.db.First(&rule, id).Error; err != nil {
+		return nil, wrapErr(err)
+	}
+	return &rule, nil
+}
+
+func (p *psql) ListRoleRules() ([]*database.RoleRule, error) {
+	var rules []*database.RoleRule
+	if err := p.db.Order("id").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func (p *psql) UpdateRoleRule(rule *database.RoleRule) error {
+	return p.db.Transaction(func(tx *gorm.DB) error {
+		if err := roleRuleExists(tx, rule); err != nil {
+			return err
+		}
+
+		res := tx.Model(rule).Select("relationship", "server_group").Updates(rule)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return database.ErrNotFound
+		}
+		return nil
+	})
+}
+
+func (p *psql) DeleteRoleRule(id uint) error {
+	res := p.db.Delete(&database.RoleRule{}, id)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return database.ErrNotFound
+	}
+	return nil
+}
+
+func (p *psql) ListRetiredGroups() ([]int, error) {
+	var groups []int
+	err := p.db.Model(&database.RetiredGroup{}).Order("server_group").Pluck("server_group", &groups).Error
+	if err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+func (p *psql) SetRetiredGroups(groups []int) error {
+	return p.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("1 = 1").Delete(&database.RetiredGroup{}).Error; err != nil {
+			return err
+		}
+		for _, group := range groups {
+			if err := tx.Create(&database.RetiredGroup{ServerGroup: group}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (p *psql) AddAPIKey(key *database.APIKey) error {
+	return p.db.Create(key).Error
+}
+
+func (p *psql) GetAPIKey(id uint) (*database.APIKey, error) {
+	var key database.APIKey
+	if err := p.db.First(&key, id).Error; err != nil {
+		return nil, wrapErr(err)
+	}
+	return &key, nil
+}
+
+func (p *psql) GetAPIKeyByHash(hash string) (*database.APIKey, error) {
+	var key database.APIKey
+	if err := p.db.Where("hash = ?", hash).First(&key).Error; err != nil {
+		return nil, wrapErr(err)
+	}
+	return &key, nil
+}
+
+func (p *psql) ListAPIKeys(twitchID string) ([]*database.APIKey, error) {
+	var keys []*database.APIKey
+	if err := p.db.Where("twitch_id = ?", twitchID).Order("id").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (p *psql) RevokeAPIKey(id uint) error {
+	res := p.db.Model(&database.APIKey{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now())
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return database.ErrNotFound
+	}
+	return nil
+}
+
+func (p *psql) SetAPIKeyLastUsed(id uint, at time.Time) error {
+	return p.db.Model(&database.APIKey{}).Where("id = ?", id).Update("last_used_at", at).Error
+}
+
+// Returns ErrAlreadyExists if another rule maps the same relationship to the same group
+func roleRuleExists(tx *gorm.DB, rule *database.RoleRule) error {
+	var count int64
+	err := tx.Model(&database.RoleRule{}).
+		Where("relationship = ? AND server_group = ? AND id <> ?", rule.Relationship, rule.ServerGroup, rule.ID).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return database.ErrAlreadyExists
+	}
+	return nil
+}
+
+// Maps gorm specific errors to database errors
+func wrapErr(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return database.ErrNotFound
+	}
+	return err
+}
+
 // Config for the database service
 type Config struct {
 	Host     string
@@ -68,12 +585,19 @@ type Config struct {
 	User     string
 	Password string
 	Database string
-	Console  bool
-	Debug    bool
+	// Used to derive the key for encrypting tokens at rest
+	SecretKey string
+	Console   bool
+	Debug     bool
 }
 
 // NewService returns a new database service
 func NewService(cfg Config) (database.Service, error) {
+	cipher, err := database.NewCipher(cfg.SecretKey)
+	if err != nil {
+		return nil, fmt.Errorf("creating cipher: %w", err)
+	}
+
 	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d sslmode=disable",
 		cfg.Host, cfg.User, cfg.Password, cfg.Database, cfg.Port)
 	fLogger := log.NewLogger(
@@ -96,6 +620,7 @@ func NewService(cfg Config) (database.Service, error) {
 		return nil, err
 	}
 	return &psql{
-		db: db,
+		db:     db,
+		cipher: cipher,
 	}, nil
 }
@@ -0,0 +1,212 @@
+package eventsub
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Supported subscription types
+const (
+	TypeStreamOnline            = "stream.online"
+	TypeStreamOffline           = "stream.offline"
+	TypeChannelSubscribe        = "channel.subscribe"
+	TypeChannelSubscriptionEnd  = "channel.subscription.end"
+	TypeChannelFollow           = "channel.follow"
+	TypeChannelBan              = "channel.ban"
+	TypeChannelUnban            = "channel.unban"
+	TypeUserAuthorizationRevoke = "user.authorization.revoke"
+	TypeRedemptionAdd           = "channel.channel_points_custom_reward_redemption.add"
+)
+
+// Versions of the supported subscription types
+var versions = map[string]string{
+	TypeStreamOnline:            "1",
+	TypeStreamOffline:           "1",
+	TypeChannelSubscribe:        "1",
+	TypeChannelSubscriptionEnd:  "1",
+	TypeChannelFollow:           "2",
+	TypeChannelBan:              "1",
+	TypeChannelUnban:            "1",
+	TypeUserAuthorizationRevoke: "1",
+	TypeRedemptionAdd:           "1",
+}
+
+// Event is a typed EventSub notification
+type Event interface {
+	// SubscriptionType returns the subscription type the event was sent for
+	SubscriptionType() string
+}
+
+// StreamOnline is sent when a broadcaster starts streaming
+type StreamOnline struct {
+	ID                   string    `json:"id"`
+	BroadcasterUserID    string    `json:"broadcaster_user_id"`
+	BroadcasterUserLogin string    `json:"broadcaster_user_login"`
+	BroadcasterUserName  string    `json:"broadcaster_user_name"`
+	Type                 string    `json:"type"`
+	StartedAt            time.Time `json:"started_at"`
+}
+
+// SubscriptionType implements Event
+func (e *StreamOnline) SubscriptionType() string { return TypeStreamOnline }
+
+// StreamOffline is sent when a broadcaster stops streaming
+type StreamOffline struct {
+	BroadcasterUserID    string `json:"broadcaster_user_id"`
+	BroadcasterUserLogin string `json:"broadcaster_user_login"`
+	BroadcasterUserName  string `json:"broadcaster_user_name"`
+}
+
+// SubscriptionType implements Event
+func (e *StreamOffline) SubscriptionType() string { return TypeStreamOffline }
+
+// ChannelSubscribe is sent when a user subscribes to the broadcaster
+type ChannelSubscribe struct {
+	UserID               string `json:"user_id"`
+	UserLogin            string `json:"user_login"`
+	UserName             string `json:"user_name"`
+	BroadcasterUserID    string `json:"broadcaster_user_id"`
+	BroadcasterUserLogin string `json:"broadcaster_user_login"`
+	BroadcasterUserName  string `json:"broadcaster_user_name"`
+	Tier                 string `json:"tier"`
+	IsGift               bool   `json:"is_gift"`
+}
+
+// SubscriptionType implements Event
+func (e *ChannelSubscribe) SubscriptionType() string { return TypeChannelSubscribe }
+
+// ChannelSubscriptionEnd is sent when a subscription to the broadcaster expires
+type ChannelSubscriptionEnd struct {
+	UserID               string `json:"user_id"`
+	UserLogin            string `json:"user_login"`
+	UserName             string `json:"user_name"`
+	BroadcasterUserID    string `json:"broadcaster_user_id"`
+	BroadcasterUserLogin string `json:"broadcaster_user_login"`
+	BroadcasterUserName  string `json:"broadcaster_user_name"`
+	Tier                 string `json:"tier"`
+	IsGift               bool   `json:"is_gift"`
+}
+
+// SubscriptionType implements Event
+func (e *ChannelSubscriptionEnd) SubscriptionType() string { return TypeChannelSubscriptionEnd }
+
+// ChannelFollow is sent when a user follows the broadcaster
+type ChannelFollow struct {
+	UserID               string    `json:"user_id"`
+	UserLogin            string    `json:"user_login"`
+	UserName             string    `json:"user_name"`
+	BroadcasterUserID    string    `json:"broadcaster_user_id"`
+	BroadcasterUserLogin string    `json:"broadcaster_user_login"`
+	BroadcasterUserName  string    `json:"broadcaster_user_name"`
+	FollowedAt           time.Time `json:"followed_at"`
+}
+
+// SubscriptionType implements Event
+func (e *ChannelFollow) SubscriptionType() string { return TypeChannelFollow }
+
+// ChannelBan is sent when a user gets banned or timed out in the broadcaster's chat
+type ChannelBan struct {
+	UserID               string    `json:"user_id"`
+	UserLogin            string    `json:"user_login"`
+	UserName             string    `json:"user_name"`
+	BroadcasterUserID    string    `json:"broadcaster_user_id"`
+	BroadcasterUserLogin string    `json:"broadcaster_user_login"`
+	BroadcasterUserName  string    `json:"broadcaster_user_name"`
+	ModeratorUserID      string    `json:"moderator_user_id"`
+	ModeratorUserLogin   string    `json:"moderator_user_login"`
+	ModeratorUserName    string    `json:"moderator_user_name"`
+	Reason               string    `json:"reason"`
+	BannedAt             time.Time `json:"banned_at"`
+	// Only set for timeouts
+	EndsAt      *time.Time `json:"ends_at"`
+	IsPermanent bool       `json:"is_permanent"`
+}
+
+// SubscriptionType implements Event
+func (e *ChannelBan) SubscriptionType() string { return TypeChannelBan }
+
+// ChannelUnban is sent when a user gets unbanned in the broadcaster's chat
+type ChannelUnban struct {
+	UserID               string `json:"user_id"`
+	UserLogin            string `json:"user_login"`
+	UserName             string `json:"user_name"`
+	BroadcasterUserID    string `json:"broadcaster_user_id"`
+	BroadcasterUserLogin string `json:"broadcaster_user_login"`
+	BroadcasterUserName  string `json:"broadcaster_user_name"`
+	ModeratorUserID      string `json:"moderator_user_id"`
+	ModeratorUserLogin   string `json:"moderator_user_login"`
+	ModeratorUserName    string `json:"moderator_user_name"`
+}
+
+// SubscriptionType implements Event
+func (e *ChannelUnban) SubscriptionType() string { return TypeChannelUnban }
+
+// UserAuthorizationRevoke is sent when a user revokes the authorization of our client
+type UserAuthorizationRevoke struct {
+	ClientID string `json:"client_id"`
+	UserID   string `json:"user_id"`
+	// Login and name are empty if the user deleted their account
+	UserLogin string `json:"user_login"`
+	UserName  string `json:"user_name"`
+}
+
+// SubscriptionType implements Event
+func (e *UserAuthorizationRevoke) SubscriptionType() string { return TypeUserAuthorizationRevoke }
+
+// RedemptionAdd is sent when a viewer redeems a custom channel points reward
+type RedemptionAdd struct {
+	ID                   string `json:"id"`
+	BroadcasterUserID    string `json:"broadcaster_user_id"`
+	BroadcasterUserLogin string `json:"broadcaster_user_login"`
+	BroadcasterUserName  string `json:"broadcaster_user_name"`
+	UserID               string `json:"user_id"`
+	UserLogin            string `json:"user_login"`
+	UserName             string `json:"user_name"`
+	UserInput            string `json:"user_input"`
+	// unfulfilled, or fulfilled if the reward skips the request queue
+	Status string `json:"status"`
+	Reward struct {
+		ID     string `json:"id"`
+		Title  string `json:"title"`
+		Cost   int    `json:"cost"`
+		Prompt string `json:"prompt"`
+	} `json:"reward"`
+	RedeemedAt time.Time `json:"redeemed_at"`
+}
+
+// SubscriptionType implements Event
+func (e *RedemptionAdd) SubscriptionType() string { return TypeRedemptionAdd }
+
+// Decodes the event payload of a notification based on its subscription type
+func decodeEvent(subscriptionType string, data json.RawMessage) (Event, error) {
+	var event Event
+	switch subscriptionType {
+	case TypeStreamOnline:
+		event = &StreamOnline{}
+	case TypeStreamOffline:
+		event = &StreamOffline{}
+	case TypeChannelSubscribe:
+		event = &ChannelSubscribe{}
+	case TypeChannelSubscriptionEnd:
+		event = &ChannelSubscriptionEnd{}
+	case TypeChannelFollow:
+		event = &ChannelFollow{}
+	case TypeChannelBan:
+		event = &ChannelBan{}
+	case TypeChannelUnban:
+		event = &ChannelUnban{}
+	case TypeUserAuthorizationRevoke:
+		event = &UserAuthorizationRevoke{}
+	case TypeRedemptionAdd:
+		event = &RedemptionAdd{}
+	default:
+		return nil, fmt.Errorf("unsupported subscription type %q", subscriptionType)
+	}
+
+	if err := json.Unmarshal(data, event); err != nil {
+		return nil, fmt.Errorf("decoding %s event: %w", subscriptionType, err)
+	}
+
+	return event, nil
+}
@@ -0,0 +1,117 @@
+package eventsub
+
+import (
+	"context"
+	"fmt"
+
+	"golang.org/x/oauth2/clientcredentials"
+	"golang.org/x/oauth2/endpoints"
+
+	"github.com/devusSs/twitchspeak/internal/helix"
+	"github.com/devusSs/twitchspeak/pkg/log"
+)
+
+// Config for receiving EventSub notifications
+type Config struct {
+	ClientID     string
+	ClientSecret string
+	// Public URL of the webhook endpoint, needs to use https on port 443
+	CallbackURL string
+	// Used to sign notifications, between 10 and 100 characters
+	Secret  string
+	Console bool
+	Debug   bool
+}
+
+// New creates a webhook receiver and a subscription manager
+// using an app access token of the client
+func New(ctx context.Context, cfg Config) (*Receiver, *Manager, error) {
+	if cfg.ClientID == "" || cfg.ClientSecret == "" {
+		return nil, nil, fmt.Errorf("eventsub: client id or secret is empty")
+	}
+
+	if cfg.CallbackURL == "" {
+		return nil, nil, fmt.Errorf("eventsub: callback url is empty")
+	}
+
+	if len(cfg.Secret) < 10 || len(cfg.Secret) > 100 {
+		return nil, nil, fmt.Errorf("eventsub: secret needs to be between 10 and 100 characters")
+	}
+
+	appToken := &clientcredentials.Config{
+		ClientID:     cfg.ClientID,
+		ClientSecret: cfg.ClientSecret,
+		TokenURL:     endpoints.Twitch.TokenURL,
+	}
+
+	client, err := helix.NewClient(helix.Config{
+		ClientID:    cfg.ClientID,
+		TokenSource: appToken.TokenSource(ctx),
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("eventsub: %w", err)
+	}
+
+	logger := log.NewLogger(
+		log.WithOwnLogFile("eventsub.log"),
+		log.WithName("eventsub"),
+		log.WithConsole(cfg.Console),
+		log.WithDebug(cfg.Debug),
+	)
+
+	logger.Info("EventSub initialized, callback: %s", cfg.CallbackURL)
+
+	return NewReceiver(cfg.Secret, logger), NewManager(client, cfg.CallbackURL, cfg.Secret, logger), nil
+}
+
+// ClientSpecs returns the subscriptions needed for every client
+func ClientSpecs(clientID string) []Spec {
+	return []Spec{
+		{Type: TypeUserAuthorizationRevoke, Condition: map[string]string{"client_id": clientID}},
+	}
+}
+
+// BroadcasterSpecs returns the subscriptions needed for the relationships
+// of users with the broadcaster, the broadcaster needs to have authorized
+// our client with the scopes for the roles
+func BroadcasterSpecs(broadcasterID string) []Spec {
+	broadcaster := map[string]string{"broadcaster_user_id": broadcasterID}
+	return []Spec{
+		{Type: TypeChannelSubscribe, Condition: broadcaster},
+		{Type: TypeChannelSubscriptionEnd, Condition: broadcaster},
+		{
+			Type: TypeChannelFollow,
+			Condition: map[string]string{
+				"broadcaster_user_id": broadcasterID,
+				"moderator_user_id":   broadcasterID,
+			},
+		},
+	}
+}
+
+// BanSpecs returns the subscriptions needed to detect users getting banned
+// or unbanned in the broadcaster's chat, requires the channel:moderate scope
+func BanSpecs(broadcasterID string) []Spec {
+	broadcaster := map[string]string{"broadcaster_user_id": broadcasterID}
+	return []Spec{
+		{Type: TypeChannelBan, Condition: broadcaster},
+		{Type: TypeChannelUnban, Condition: broadcaster},
+	}
+}
+
+// RedemptionSpecs returns the subscriptions needed to detect redemptions
+// of custom channel points rewards, requires the channel:manage:redemptions scope
+func RedemptionSpecs(broadcasterID string) []Spec {
+	return []Spec{
+		{Type: TypeRedemptionAdd, Condition: map[string]string{"broadcaster_user_id": broadcasterID}},
+	}
+}
+
+// StreamSpecs returns the subscriptions needed to detect the user going live and offline
+func StreamSpecs(userID string) []Spec {
+	condition := map[string]string{"broadcaster_user_id": userID}
+	return []Spec{
+		{Type: TypeStreamOnline, Condition: condition},
+		{Type: TypeStreamOffline, Condition: condition},
+	}
+}
@@ -0,0 +1,202 @@
+package eventsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/devusSs/twitchspeak/internal/helix"
+	"github.com/devusSs/twitchspeak/pkg/log"
+)
+
+// Spec describes a desired subscription
+type Spec struct {
+	Type      string
+	Condition map[string]string
+}
+
+// Uniquely identifies the spec regardless of condition order
+func (s Spec) key() string {
+	keys := make([]string, 0, len(s.Condition))
+	for k := range s.Condition {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	sb.WriteString(s.Type)
+	for _, k := range keys {
+		sb.WriteString(fmt.Sprintf(";%s=%s", k, s.Condition[k]))
+	}
+	return sb.String()
+}
+
+func (s Spec) String() string {
+	return s.key()
+}
+
+// Manager creates and deletes webhook subscriptions
+// so they match the desired ones
+type Manager struct {
+	helix    *helix.Client
+	callback string
+	secret   string
+	logger   *log.Logger
+
+	mu      sync.Mutex
+	desired map[string]Spec
+}
+
+// Add adds subscriptions to the desired ones,
+// they get created on the next reconciliation
+func (m *Manager) Add(specs ...Spec) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, spec := range specs {
+		m.desired[spec.key()] = spec
+	}
+}
+
+// Remove removes subscriptions from the desired ones,
+// they get deleted on the next reconciliation
+func (m *Manager) Remove(specs ...Spec) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, spec := range specs {
+		delete(m.desired, spec.key())
+	}
+}
+
+// Reconcile creates missing and deletes unwanted or failed subscriptions
+// using our callback, subscriptions of other callbacks are left untouched
+//
+// A failing subscription does not keep the others from being reconciled,
+// all failures are returned joined
+func (m *Manager) Reconcile(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, err := m.helix.GetEventSubSubscriptions(ctx)
+	if err != nil {
+		return err
+	}
+
+	current := make(map[string]string)
+	var created, deleted int
+	var errs []error
+
+	for _, sub := range existing {
+		if sub.Transport.Method != "webhook" || sub.Transport.Callback != m.callback {
+			continue
+		}
+
+		key := Spec{Type: sub.Type, Condition: sub.Condition}.key()
+		_, wanted := m.desired[key]
+		_, duplicate := current[key]
+
+		if wanted && !duplicate && usable(sub.Status) {
+			current[key] = sub.ID
+			continue
+		}
+
+		if err := m.helix.DeleteEventSubSubscription(ctx, sub.ID); err != nil {
+			m.logger.Error("Error deleting %s subscription %s: %v", sub.Type, sub.ID, err)
+			errs = append(errs, err)
+			continue
+		}
+		deleted++
+		m.logger.Debug("deleted %s subscription %s (%s)", sub.Type, sub.ID, sub.Status)
+	}
+
+	for key, spec := range m.desired {
+		if _, ok := current[key]; ok {
+			continue
+		}
+
+		sub, err := m.helix.CreateEventSubSubscription(ctx, helix.EventSubSubscription{
+			Type:      spec.Type,
+			Version:   versions[spec.Type],
+			Condition: spec.Condition,
+			Transport: helix.EventSubTransport{
+				Method:   "webhook",
+				Callback: m.callback,
+				Secret:   m.secret,
+			},
+		})
+		if err != nil {
+			m.logger.Error("Error creating %s subscription %v: %v", spec.Type, spec.Condition, err)
+			errs = append(errs, err)
+			continue
+		}
+
+		current[key] = sub.ID
+		created++
+		m.logger.Debug("created %s subscription %s", spec.Type, sub.ID)
+	}
+
+	m.logger.Info(
+		"Reconciled subscriptions: %d desired, %d created, %d deleted, %d failed",
+		len(m.desired),
+		created,
+		deleted,
+		len(errs),
+	)
+
+	return errors.Join(errs...)
+}
+
+// PeriodicReconcile reconciles the subscriptions right away and every interval,
+// interval defaults to 1 hour if not positive
+//
+// Twitch verifies new subscriptions by calling the webhook,
+// so the server needs to be started already
+//
+// Blocks until context is canceled
+func (m *Manager) PeriodicReconcile(ctx context.Context, interval time.Duration, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	if interval <= 0 {
+		interval = defaultReconcileInterval
+	}
+
+	if err := m.Reconcile(ctx); err != nil {
+		m.logger.Error("Error reconciling subscriptions: %v", err)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			m.logger.Debug("Exiting subscription reconciler")
+			return
+		case <-ticker.C:
+			if err := m.Reconcile(ctx); err != nil {
+				m.logger.Error("Error reconciling subscriptions: %v", err)
+			}
+		}
+	}
+}
+
+// Whether a subscription with the status is (or will be) delivering notifications
+func usable(status string) bool {
+	return status == "enabled" || status == "webhook_callback_verification_pending"
+}
+
+// NewManager creates a new subscription manager, client needs to use an app access token
+func NewManager(client *helix.Client, callback string, secret string, logger *log.Logger) *Manager {
+	return &Manager{
+		helix:    client,
+		callback: callback,
+		secret:   secret,
+		logger:   logger,
+		desired:  make(map[string]Spec),
+	}
+}
+
+const defaultReconcileInterval = time.Hour
@@ -0,0 +1,130 @@
+package eventsub
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"golang.org/x/oauth2"
+
+	"github.com/devusSs/twitchspeak/internal/helix"
+	"github.com/devusSs/twitchspeak/pkg/log"
+)
+
+const testCallback = "https://example.com/eventsub"
+
+// Serves the EventSub subscription endpoints of Helix,
+// creating subscriptions of failingType and deleting failingID fails
+type fakeHelix struct {
+	existing    []helix.EventSubSubscription
+	failingType string
+	failingID   string
+
+	mu      sync.Mutex
+	created []string
+	deleted []string
+}
+
+func (f *fakeHelix) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case http.MethodGet:
+		_ = json.NewEncoder(w).Encode(map[string]any{"data": f.existing})
+	case http.MethodPost:
+		var sub helix.EventSubSubscription
+		if err := json.NewDecoder(r.Body).Decode(&sub); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if sub.Type == f.failingType {
+			http.Error(w, `{"error":"Forbidden","status":403,"message":"subscription missing proper authorization"}`, http.StatusForbidden)
+			return
+		}
+		f.created = append(f.created, sub.Type)
+		sub.ID = "new-" + sub.Type
+		_ = json.NewEncoder(w).Encode(map[string]any{"data": []helix.EventSubSubscription{sub}})
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+		if id == f.failingID {
+			http.Error(w, `{"error":"Internal Server Error","status":500}`, http.StatusInternalServerError)
+			return
+		}
+		f.deleted = append(f.deleted, id)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestReconcileContinuesAfterFailures(t *testing.T) {
+	log.SetDefaultLogsDirectory(t.TempDir())
+
+	fake := &fakeHelix{
+		existing: []helix.EventSubSubscription{
+			{
+				ID:        "unwanted",
+				Type:      TypeChannelFollow,
+				Status:    "enabled",
+				Condition: map[string]string{"broadcaster_user_id": "1"},
+				Transport: helix.EventSubTransport{Method: "webhook", Callback: testCallback},
+			},
+			{
+				ID:        "stuck",
+				Type:      TypeChannelSubscribe,
+				Status:    "enabled",
+				Condition: map[string]string{"broadcaster_user_id": "1"},
+				Transport: helix.EventSubTransport{Method: "webhook", Callback: testCallback},
+			},
+		},
+		failingType: TypeChannelBan,
+		failingID:   "stuck",
+	}
+
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	client, err := helix.NewClient(helix.Config{
+		ClientID:    "client-id",
+		TokenSource: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"}),
+		BaseURL:     server.URL,
+	})
+	if err != nil {
+		t.Fatalf("creating helix client: %v", err)
+	}
+
+	m := NewManager(client, testCallback, testSecret, log.NewLogger(log.WithOwnLogFile("eventsub.log")))
+	condition := map[string]string{"broadcaster_user_id": "1337"}
+	m.Add(
+		Spec{Type: TypeChannelBan, Condition: condition},
+		Spec{Type: TypeStreamOnline, Condition: condition},
+		Spec{Type: TypeStreamOffline, Condition: condition},
+		Spec{Type: TypeChannelUnban, Condition: condition},
+	)
+
+	// Map iteration order is random, make sure no order skips specs
+	for i := 0; i < 5; i++ {
+		fake.mu.Lock()
+		fake.created, fake.deleted = nil, nil
+		fake.mu.Unlock()
+
+		if err := m.Reconcile(context.Background()); err == nil {
+			t.Fatal("expected an error for the failing subscriptions")
+		}
+
+		fake.mu.Lock()
+		created, deleted := fake.created, fake.deleted
+		fake.mu.Unlock()
+
+		if len(created) != 3 {
+			t.Fatalf("created %v, want the 3 subscriptions besides %s", created, TypeChannelBan)
+		}
+		if len(deleted) != 1 || deleted[0] != "unwanted" {
+			t.Fatalf("deleted %v, want [unwanted]", deleted)
+		}
+	}
+}
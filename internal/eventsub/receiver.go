@@ -0,0 +1,248 @@
+package eventsub
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/devusSs/twitchspeak/internal/database/redis"
+	"github.com/devusSs/twitchspeak/internal/server/responses"
+	"github.com/devusSs/twitchspeak/pkg/log"
+)
+
+// Headers sent by Twitch with every webhook request
+const (
+	headerMessageID        = "Twitch-Eventsub-Message-Id"
+	headerMessageTimestamp = "Twitch-Eventsub-Message-Timestamp"
+	headerMessageSignature = "Twitch-Eventsub-Message-Signature"
+	headerMessageType      = "Twitch-Eventsub-Message-Type"
+)
+
+// Message types of webhook requests
+const (
+	messageTypeNotification = "notification"
+	messageTypeVerification = "webhook_callback_verification"
+	messageTypeRevocation   = "revocation"
+)
+
+// Handler handles a typed EventSub notification
+type Handler func(ctx context.Context, event Event)
+
+// RevocationHandler is called when Twitch revokes a subscription,
+// e.g. because the user revoked the authorization it requires
+type RevocationHandler func(subscriptionID string, subscriptionType string, reason string)
+
+// Receiver receives EventSub notifications via webhook
+type Receiver struct {
+	secret []byte
+	logger *log.Logger
+
+	mu          sync.RWMutex
+	handlers    []Handler
+	revocations []RevocationHandler
+}
+
+// OnEvent registers a handler which is called (in its own goroutine)
+// for every verified notification
+func (r *Receiver) OnEvent(fn Handler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers = append(r.handlers, fn)
+}
+
+// OnRevocation registers a handler which is called
+// every time Twitch revokes a subscription
+func (r *Receiver) OnRevocation(fn RevocationHandler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.revocations = append(r.revocations, fn)
+}
+
+// Body of webhook requests, event is only set for notifications
+// and challenge only for verifications
+type webhookRequest struct {
+	Subscription struct {
+		ID      string `json:"id"`
+		Type    string `json:"type"`
+		Version string `json:"version"`
+		Status  string `json:"status"`
+	} `json:"subscription"`
+	Event     json.RawMessage `json:"event"`
+	Challenge string          `json:"challenge"`
+}
+
+// HandleWebhook handles webhook requests sent by Twitch
+func (r *Receiver) HandleWebhook(c *gin.Context) {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxBodySize))
+	if err != nil {
+		resp := responses.Error{
+			Code:         http.StatusBadRequest,
+			ErrorCode:    "invalid_body",
+			ErrorMessage: "Body could not be read",
+		}
+		c.JSON(resp.Code, resp)
+		return
+	}
+
+	id := c.GetHeader(headerMessageID)
+	timestamp := c.GetHeader(headerMessageTimestamp)
+
+	if !r.verifySignature(id, timestamp, body, c.GetHeader(headerMessageSignature)) {
+		resp := responses.Error{
+			Code:         http.StatusForbidden,
+			ErrorCode:    "invalid_signature",
+			ErrorMessage: "Signature could not be verified",
+		}
+		c.JSON(resp.Code, resp)
+		return
+	}
+
+	sent, err := time.Parse(time.RFC3339Nano, timestamp)
+	if err != nil || time.Since(sent) > maxMessageAge {
+		resp := responses.Error{
+			Code:         http.StatusForbidden,
+			ErrorCode:    "stale_message",
+			ErrorMessage: "Message is too old",
+		}
+		c.JSON(resp.Code, resp)
+		return
+	}
+
+	var req webhookRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		resp := responses.Error{
+			Code:         http.StatusBadRequest,
+			ErrorCode:    "invalid_body",
+			ErrorMessage: "Body could not be decoded",
+		}
+		c.JSON(resp.Code, resp)
+		return
+	}
+
+	fresh, err := r.markSeen(c, id)
+	if err != nil {
+		r.logger.Error("Error deduplicating message %s: %v", id, err)
+		resp := responses.Error{
+			Code:         http.StatusInternalServerError,
+			ErrorCode:    responses.CodeInternalError,
+			ErrorMessage: responses.MessageInternalError,
+		}
+		c.JSON(resp.Code, resp)
+		return
+	}
+	if !fresh {
+		r.logger.Debug("ignoring duplicate message %s", id)
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	switch c.GetHeader(headerMessageType) {
+	case messageTypeVerification:
+		r.logger.Info("Verified %s subscription %s", req.Subscription.Type, req.Subscription.ID)
+		c.String(http.StatusOK, req.Challenge)
+	case messageTypeRevocation:
+		r.logger.Warn(
+			"Twitch revoked %s subscription %s: %s",
+			req.Subscription.Type,
+			req.Subscription.ID,
+			req.Subscription.Status,
+		)
+		r.revoked(req.Subscription.ID, req.Subscription.Type, req.Subscription.Status)
+		c.Status(http.StatusNoContent)
+	case messageTypeNotification:
+		event, err := decodeEvent(req.Subscription.Type, req.Event)
+		if err != nil {
+			// Answer anyway, otherwise Twitch keeps retrying
+			r.logger.Error("Error decoding message %s: %v", id, err)
+			c.Status(http.StatusNoContent)
+			return
+		}
+		r.logger.Debug("received %s event: %+v", req.Subscription.Type, event)
+		r.dispatch(event)
+		c.Status(http.StatusNoContent)
+	default:
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// Verifies the HMAC signature of the message,
+// Twitch signs the concatenation of message id, timestamp and body
+func (r *Receiver) verifySignature(id string, timestamp string, body []byte, signature string) bool {
+	expected, ok := strings.CutPrefix(signature, "sha256=")
+	if !ok || id == "" || timestamp == "" {
+		return false
+	}
+
+	decoded, err := hex.DecodeString(expected)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, r.secret)
+	mac.Write([]byte(id))
+	mac.Write([]byte(timestamp))
+	mac.Write(body)
+
+	return hmac.Equal(mac.Sum(nil), decoded)
+}
+
+// Returns whether the message has not been seen yet and marks it as seen,
+// Twitch may deliver messages more than once
+func (r *Receiver) markSeen(ctx context.Context, id string) (bool, error) {
+	client := redis.GetClient()
+	if client == nil {
+		return true, nil
+	}
+
+	return client.SetNX(ctx, "twitchspeak:eventsub:message:"+id, 1, maxMessageAge).Result()
+}
+
+// Calls the event handlers in their own goroutines
+func (r *Receiver) dispatch(event Event) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, fn := range r.handlers {
+		go func(fn Handler) {
+			ctx, cancel := context.WithTimeout(context.Background(), handlerTimeout)
+			defer cancel()
+			fn(ctx, event)
+		}(fn)
+	}
+}
+
+// Calls the revocation handlers
+func (r *Receiver) revoked(id string, subscriptionType string, reason string) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, fn := range r.revocations {
+		go fn(id, subscriptionType, reason)
+	}
+}
+
+// NewReceiver creates a new webhook receiver verifying messages with secret
+func NewReceiver(secret string, logger *log.Logger) *Receiver {
+	return &Receiver{
+		secret: []byte(secret),
+		logger: logger,
+	}
+}
+
+const (
+	// Messages older than this are rejected,
+	// message IDs are remembered as long for deduplication
+	maxMessageAge = 10 * time.Minute
+	// Notifications are small, Twitch caps them well below this
+	maxBodySize    = 1 << 20
+	handlerTimeout = 30 * time.Second
+)
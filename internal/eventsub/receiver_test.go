@@ -0,0 +1,285 @@
+package eventsub
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+
+	"github.com/devusSs/twitchspeak/internal/database/redis"
+	"github.com/devusSs/twitchspeak/pkg/log"
+)
+
+const (
+	testSecret    = "s3cre7-webhook-secret"
+	testMessageID = "e76c6bd4-55c9-4987-8304-da1588d8988b"
+	testTimestamp = "2019-11-16T10:11:12.634234626Z"
+	testBody      = `{"subscription":{"id":"f1c2a387-161a-49f9-a165-0f21d7a4e1c4","type":"stream.offline"},"event":{"broadcaster_user_id":"1337"}}`
+	// HMAC-SHA256 of testMessageID + testTimestamp + testBody using testSecret
+	testSignature = "sha256=c579057128d1d11e173454a3006e93e9d0d757e943e9b10a9a4932ad7a8de489"
+)
+
+func newTestReceiver(t *testing.T) *Receiver {
+	t.Helper()
+	log.SetDefaultLogsDirectory(t.TempDir())
+	return NewReceiver(testSecret, log.NewLogger(log.WithOwnLogFile("eventsub.log")))
+}
+
+func TestVerifySignature(t *testing.T) {
+	r := newTestReceiver(t)
+
+	tests := []struct {
+		name      string
+		id        string
+		timestamp string
+		body      string
+		signature string
+		want      bool
+	}{
+		{"valid", testMessageID, testTimestamp, testBody, testSignature, true},
+		{"uppercase hex", testMessageID, testTimestamp, testBody, "sha256=" + strings.ToUpper(strings.TrimPrefix(testSignature, "sha256=")), true},
+		{"tampered body", testMessageID, testTimestamp, strings.Replace(testBody, "1337", "1338", 1), testSignature, false},
+		{"tampered id", "a" + testMessageID[1:], testTimestamp, testBody, testSignature, false},
+		{"tampered timestamp", testMessageID, "2019-11-16T10:11:13.634234626Z", testBody, testSignature, false},
+		{"missing prefix", testMessageID, testTimestamp, testBody, strings.TrimPrefix(testSignature, "sha256="), false},
+		{"wrong algorithm", testMessageID, testTimestamp, testBody, "sha1=" + strings.TrimPrefix(testSignature, "sha256="), false},
+		{"not hex", testMessageID, testTimestamp, testBody, "sha256=zz", false},
+		{"truncated", testMessageID, testTimestamp, testBody, testSignature[:len(testSignature)-2], false},
+		{"empty signature", testMessageID, testTimestamp, testBody, "", false},
+		{"empty id", "", testTimestamp, testBody, testSignature, false},
+		{"empty timestamp", testMessageID, "", testBody, testSignature, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.verifySignature(tt.id, tt.timestamp, []byte(tt.body), tt.signature); got != tt.want {
+				t.Fatalf("verifySignature() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Starts an in-memory redis used for deduplicating messages
+func startRedis(t *testing.T) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+
+	host, port, err := net.SplitHostPort(mr.Addr())
+	if err != nil {
+		t.Fatalf("splitting redis address: %v", err)
+	}
+	p, err := strconv.ParseUint(port, 10, 0)
+	if err != nil {
+		t.Fatalf("parsing redis port: %v", err)
+	}
+
+	if err := redis.Init(redis.Config{Host: host, Port: uint(p)}); err != nil {
+		t.Fatalf("connecting to redis: %v", err)
+	}
+}
+
+type webhookMessage struct {
+	id          string
+	messageType string
+	timestamp   time.Time
+	body        string
+	// Overrides the computed signature if set
+	signature string
+}
+
+func (m webhookMessage) request() *http.Request {
+	timestamp := m.timestamp.UTC().Format(time.RFC3339Nano)
+
+	signature := m.signature
+	if signature == "" {
+		mac := hmac.New(sha256.New, []byte(testSecret))
+		mac.Write([]byte(m.id + timestamp + m.body))
+		signature = "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/eventsub", strings.NewReader(m.body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(headerMessageID, m.id)
+	req.Header.Set(headerMessageTimestamp, timestamp)
+	req.Header.Set(headerMessageSignature, signature)
+	req.Header.Set(headerMessageType, m.messageType)
+	return req
+}
+
+func TestHandleWebhook(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	const (
+		verificationBody = `{"challenge":"pogchamp-kappa-360noscope-vohiyo","subscription":{"id":"f1c2a387-161a-49f9-a165-0f21d7a4e1c4","type":"channel.follow","status":"webhook_callback_verification_pending"}}`
+		revocationBody   = `{"subscription":{"id":"f1c2a387-161a-49f9-a165-0f21d7a4e1c4","type":"channel.follow","status":"authorization_revoked"}}`
+		notificationBody = `{"subscription":{"id":"f1c2a387-161a-49f9-a165-0f21d7a4e1c4","type":"stream.offline"},"event":{"broadcaster_user_id":"1337","broadcaster_user_login":"cool_user","broadcaster_user_name":"Cool_User"}}`
+		unsupportedBody  = `{"subscription":{"id":"f1c2a387-161a-49f9-a165-0f21d7a4e1c4","type":"channel.raid"},"event":{}}`
+	)
+
+	now := time.Now()
+
+	tests := []struct {
+		name     string
+		messages []webhookMessage
+		// Status and body of the last response
+		wantStatus int
+		wantBody   string
+		// Dispatched events and revocations
+		wantEvents      int
+		wantRevocations int
+	}{
+		{
+			name:       "verification returns challenge",
+			messages:   []webhookMessage{{id: "1", messageType: messageTypeVerification, timestamp: now, body: verificationBody}},
+			wantStatus: http.StatusOK,
+			wantBody:   "pogchamp-kappa-360noscope-vohiyo",
+		},
+		{
+			name:            "revocation",
+			messages:        []webhookMessage{{id: "1", messageType: messageTypeRevocation, timestamp: now, body: revocationBody}},
+			wantStatus:      http.StatusNoContent,
+			wantRevocations: 1,
+		},
+		{
+			name:       "notification",
+			messages:   []webhookMessage{{id: "1", messageType: messageTypeNotification, timestamp: now, body: notificationBody}},
+			wantStatus: http.StatusNoContent,
+			wantEvents: 1,
+		},
+		{
+			name:       "unsupported notification is acknowledged",
+			messages:   []webhookMessage{{id: "1", messageType: messageTypeNotification, timestamp: now, body: unsupportedBody}},
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name: "duplicate notification",
+			messages: []webhookMessage{
+				{id: "1", messageType: messageTypeNotification, timestamp: now, body: notificationBody},
+				{id: "1", messageType: messageTypeNotification, timestamp: now, body: notificationBody},
+			},
+			wantStatus: http.StatusNoContent,
+			wantEvents: 1,
+		},
+		{
+			name: "duplicate verification",
+			messages: []webhookMessage{
+				{id: "1", messageType: messageTypeVerification, timestamp: now, body: verificationBody},
+				{id: "1", messageType: messageTypeVerification, timestamp: now, body: verificationBody},
+			},
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name: "different message ids",
+			messages: []webhookMessage{
+				{id: "1", messageType: messageTypeNotification, timestamp: now, body: notificationBody},
+				{id: "2", messageType: messageTypeNotification, timestamp: now, body: notificationBody},
+			},
+			wantStatus: http.StatusNoContent,
+			wantEvents: 2,
+		},
+		{
+			name:       "invalid signature",
+			messages:   []webhookMessage{{id: "1", messageType: messageTypeNotification, timestamp: now, body: notificationBody, signature: testSignature}},
+			wantStatus: http.StatusForbidden,
+			wantBody:   "invalid_signature",
+		},
+		{
+			name:       "recent timestamp",
+			messages:   []webhookMessage{{id: "1", messageType: messageTypeNotification, timestamp: now.Add(-maxMessageAge + time.Minute), body: notificationBody}},
+			wantStatus: http.StatusNoContent,
+			wantEvents: 1,
+		},
+		{
+			name:       "stale timestamp",
+			messages:   []webhookMessage{{id: "1", messageType: messageTypeNotification, timestamp: now.Add(-maxMessageAge - time.Minute), body: notificationBody}},
+			wantStatus: http.StatusForbidden,
+			wantBody:   "stale_message",
+		},
+		{
+			name:       "invalid body",
+			messages:   []webhookMessage{{id: "1", messageType: messageTypeNotification, timestamp: now, body: "{"}},
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "invalid_body",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			startRedis(t)
+
+			r := newTestReceiver(t)
+
+			events := make(chan Event, len(tt.messages))
+			r.OnEvent(func(_ context.Context, event Event) {
+				events <- event
+			})
+
+			revocations := make(chan string, len(tt.messages))
+			r.OnRevocation(func(_ string, _ string, reason string) {
+				revocations <- reason
+			})
+
+			engine := gin.New()
+			engine.POST("/eventsub", r.HandleWebhook)
+
+			var rec *httptest.ResponseRecorder
+			for _, msg := range tt.messages {
+				rec = httptest.NewRecorder()
+				engine.ServeHTTP(rec, msg.request())
+			}
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Fatalf("body = %q, want it to contain %q", rec.Body.String(), tt.wantBody)
+			}
+			if tt.wantBody == "" && tt.wantStatus == http.StatusNoContent && rec.Body.Len() != 0 {
+				t.Fatalf("body = %q, want empty", rec.Body.String())
+			}
+
+			for i := 0; i < tt.wantEvents; i++ {
+				select {
+				case event := <-events:
+					offline, ok := event.(*StreamOffline)
+					if !ok || offline.BroadcasterUserID != "1337" {
+						t.Fatalf("event = %+v, want stream.offline of 1337", event)
+					}
+				case <-time.After(time.Second):
+					t.Fatalf("got %d events, want %d", i, tt.wantEvents)
+				}
+			}
+
+			for i := 0; i < tt.wantRevocations; i++ {
+				select {
+				case reason := <-revocations:
+					if reason != "authorization_revoked" {
+						t.Fatalf("revocation reason = %q, want %q", reason, "authorization_revoked")
+					}
+				case <-time.After(time.Second):
+					t.Fatalf("got %d revocations, want %d", i, tt.wantRevocations)
+				}
+			}
+
+			// Handlers run in their own goroutines, give unexpected ones a chance to show up
+			select {
+			case event := <-events:
+				t.Fatalf("unexpected event %+v", event)
+			case reason := <-revocations:
+				t.Fatalf("unexpected revocation %q", reason)
+			case <-time.After(50 * time.Millisecond):
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package grants
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/devusSs/twitchspeak/internal/database"
+	"github.com/devusSs/twitchspeak/internal/teamspeak"
+	"github.com/devusSs/twitchspeak/pkg/log"
+)
+
+// Config for the grant scheduler
+type Config struct {
+	Bot     *teamspeak.Bot
+	DB      database.Service
+	Console bool
+	Debug   bool
+}
+
+// Scheduler adds server groups to linked users until a given time
+// and removes them once they expire, grants are stored in Postgres
+// so they expire even if the app was not running
+type Scheduler struct {
+	bot    *teamspeak.Bot
+	db     database.Service
+	logger *log.Logger
+
+	// Serializes grants and expiries so extensions are not lost
+	mu sync.Mutex
+}
+
+// Grant adds the server group to the user until the given time,
+// an active grant of the same group is only ever prolonged
+func (s *Scheduler) Grant(user *database.User, group int, until time.Time, source string) (*database.Grant, error) {
+	return s.save(user, group, source, func(current time.Time) time.Time {
+		if current.After(until) {
+			return current
+		}
+		return until
+	})
+}
+
+// Extend adds the server group to the user for the given duration,
+// the duration is added on top of an active grant of the same group
+func (s *Scheduler) Extend(user *database.User, group int, duration time.Duration, source string) (*database.Grant, error) {
+	return s.save(user, group, source, func(current time.Time) time.Time {
+		start := time.Now()
+		if current.After(start) {
+			start = current
+		}
+		return start.Add(duration)
+	})
+}
+
+// Creates or updates the grant of the group, expiry maps the current
+// expiry of the grant (zero if there is none) to the new one
+func (s *Scheduler) save(
+	user *database.User,
+	group int,
+	source string,
+	expiry func(current time.Time) time.Time,
+) (*database.Grant, error) {
+	if group <= 0 {
+		return nil, fmt.Errorf("invalid server group %d", group)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	grant, err := s.db.GetGrant(user.TwitchID, group)
+	if errors.Is(err, database.ErrNotFound) {
+		grant = &database.Grant{
+			TwitchID:     user.TwitchID,
+			TeamSpeakUID: user.TeamSpeakUID,
+			ServerGroup:  group,
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("getting grant: %w", err)
+	}
+
+	grant.ExpiresAt = expiry(grant.ExpiresAt)
+	grant.Source = source
+	if !grant.ExpiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("grant of server group %d would expire immediately", group)
+	}
+
+	if err := s.bot.AddServerGroup(user.TeamSpeakUID, group); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.SaveGrant(grant); err != nil {
+		return nil, fmt.Errorf("saving grant: %w", err)
+	}
+
+	err = s.db.AddAuditEvent(&database.AuditEvent{
+		Action:       database.AuditGrantAdded,
+		TeamSpeakUID: user.TeamSpeakUID,
+		TwitchID:     user.TwitchID,
+		Source:       source,
+		Details: fmt.Sprintf(
+			"server group %d until %s",
+			group,
+			grant.ExpiresAt.Format(time.RFC3339),
+		),
+	})
+	if err != nil {
+		s.logger.Error("Error adding audit event: %v", err)
+	}
+
+	s.logger.Info(
+		"Granted server group %d to %s until %s (%s)",
+		group,
+		user.TeamSpeakUID,
+		grant.ExpiresAt.Format(time.RFC3339),
+		source,
+	)
+
+	return grant, nil
+}
+
+// Expire removes server groups whose grant expired,
+// including grants which expired while the app was not running
+func (s *Scheduler) Expire() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	grants, err := s.db.ListExpiredGrants(time.Now())
+	if err != nil {
+		return fmt.Errorf("listing grants: %w", err)
+	}
+
+	for _, grant := range grants {
+		if err := s.bot.RemoveServerGroup(grant.TeamSpeakUID, grant.ServerGroup); err != nil {
+			s.logger.Error("Error removing server group %d from %s: %v", grant.ServerGroup, grant.TeamSpeakUID, err)
+			continue
+		}
+
+		if err := s.db.DeleteGrant(grant.ID); err != nil && !errors.Is(err, database.ErrNotFound) {
+			s.logger.Error("Error deleting grant %d: %v", grant.ID, err)
+			continue
+		}
+
+		err := s.db.AddAuditEvent(&database.AuditEvent{
+			Action:       database.AuditGrantExpired,
+			TeamSpeakUID: grant.TeamSpeakUID,
+			TwitchID:     grant.TwitchID,
+			Source:       grant.Source,
+			Details:      fmt.Sprintf("server group %d", grant.ServerGroup),
+		})
+		if err != nil {
+			s.logger.Error("Error adding audit event: %v", err)
+		}
+
+		s.logger.Info("Grant of server group %d to %s expired", grant.ServerGroup, grant.TeamSpeakUID)
+	}
+
+	return nil
+}
+
+// Run removes expired grants right away and every minute until context is canceled
+func (s *Scheduler) Run(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	if err := s.Expire(); err != nil {
+		s.logger.Error("Error expiring grants: %v", err)
+	}
+
+	ticker := time.NewTicker(expiryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.logger.Debug("Exiting grant scheduler")
+			return
+		case <-ticker.C:
+			if err := s.Expire(); err != nil {
+				s.logger.Error("Error expiring grants: %v", err)
+			}
+		}
+	}
+}
+
+// RegisterCommands registers the grant related commands on the bot
+func (s *Scheduler) RegisterCommands() error {
+	return s.bot.RegisterCommand(&teamspeak.Command{
+		Name:        "mygrants",
+		Description: "Lists your temporary server groups",
+		LinkedOnly:  true,
+		Cooldown:    5 * time.Second,
+		Handler:     s.handleCommand,
+	})
+}
+
+// Replies with the active grants of the invoker and their remaining time
+func (s *Scheduler) handleCommand(ctx *teamspeak.CommandContext) error {
+	grants, err := s.db.ListActiveGrants(ctx.User.TwitchID)
+	if err != nil {
+		return err
+	}
+
+	if len(grants) == 0 {
+		return ctx.Reply("You do not have any temporary server groups.")
+	}
+
+	var sb strings.Builder
+	sb.WriteString("Your temporary server groups:")
+	for _, grant := range grants {
+		fmt.Fprintf(
+			&sb,
+			"\nServer group %d: %v left (%s)",
+			grant.ServerGroup,
+			Remaining(grant),
+			grant.Source,
+		)
+	}
+
+	return ctx.Reply(sb.String())
+}
+
+// Remaining returns the time left until the grant expires, rounded to seconds
+func Remaining(grant *database.Grant) time.Duration {
+	return max(time.Until(grant.ExpiresAt).Round(time.Second), 0)
+}
+
+// NewScheduler creates a new grant scheduler
+func NewScheduler(cfg Config) (*Scheduler, error) {
+	if cfg.Bot == nil {
+		return nil, fmt.Errorf("grants: bot is nil")
+	}
+
+	if cfg.DB == nil {
+		return nil, fmt.Errorf("grants: database service is nil")
+	}
+
+	logger := log.NewLogger(
+		log.WithOwnLogFile("grants.log"),
+		log.WithName("grants"),
+		log.WithConsole(cfg.Console),
+		log.WithDebug(cfg.Debug),
+	)
+
+	return &Scheduler{
+		bot:    cfg.Bot,
+		db:     cfg.DB,
+		logger: logger,
+	}, nil
+}
+
+const expiryInterval = time.Minute
@@ -0,0 +1,78 @@
+package helix
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// BannedUser is a user banned or timed out in the broadcaster's chat
+type BannedUser struct {
+	UserID         string
+	UserLogin      string
+	UserName       string
+	ModeratorID    string
+	ModeratorLogin string
+	Reason         string
+	CreatedAt      time.Time
+	// Only set for timeouts
+	ExpiresAt *time.Time
+}
+
+// GetBannedUsers returns the bans per user ID
+// for all given users banned by the broadcaster
+//
+// Requires the moderation:read scope
+func (c *Client) GetBannedUsers(
+	ctx context.Context,
+	broadcasterID string,
+	userIDs []string,
+) (map[string]BannedUser, error) {
+	var resp struct {
+		Data []struct {
+			UserID         string    `json:"user_id"`
+			UserLogin      string    `json:"user_login"`
+			UserName       string    `json:"user_name"`
+			ModeratorID    string    `json:"moderator_id"`
+			ModeratorLogin string    `json:"moderator_login"`
+			Reason         string    `json:"reason"`
+			CreatedAt      time.Time `json:"created_at"`
+			// Empty for permanent bans
+			ExpiresAt string `json:"expires_at"`
+		} `json:"data"`
+	}
+
+	bans := make(map[string]BannedUser)
+	err := c.batched(userIDs, func(batch []string) error {
+		err := c.do(ctx, http.MethodGet, "/moderation/banned", batchQuery(broadcasterID, batch), nil, &resp)
+		if err != nil {
+			return fmt.Errorf("getting banned users: %w", err)
+		}
+
+		for _, b := range resp.Data {
+			ban := BannedUser{
+				UserID:         b.UserID,
+				UserLogin:      b.UserLogin,
+				UserName:       b.UserName,
+				ModeratorID:    b.ModeratorID,
+				ModeratorLogin: b.ModeratorLogin,
+				Reason:         b.Reason,
+				CreatedAt:      b.CreatedAt,
+			}
+
+			if b.ExpiresAt != "" {
+				expires, err := time.Parse(time.RFC3339, b.ExpiresAt)
+				if err != nil {
+					return fmt.Errorf("parsing ban expiry of %s: %w", b.UserID, err)
+				}
+				ban.ExpiresAt = &expires
+			}
+
+			bans[b.UserID] = ban
+		}
+		return nil
+	})
+
+	return bans, err
+}
@@ -0,0 +1,139 @@
+package helix
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// Subscription tiers as returned by Helix
+const (
+	Tier1 = "1000"
+	Tier2 = "2000"
+	Tier3 = "3000"
+)
+
+// GetSubscriptions returns the subscription tier per user ID
+// for all given users subscribed to the broadcaster
+//
+// Requires the channel:read:subscriptions scope
+func (c *Client) GetSubscriptions(
+	ctx context.Context,
+	broadcasterID string,
+	userIDs []string,
+) (map[string]string, error) {
+	var resp struct {
+		Data []struct {
+			UserID string `json:"user_id"`
+			Tier   string `json:"tier"`
+		} `json:"data"`
+	}
+
+	tiers := make(map[string]string)
+	err := c.batched(userIDs, func(batch []string) error {
+		err := c.do(ctx, http.MethodGet, "/subscriptions", batchQuery(broadcasterID, batch), nil, &resp)
+		if err != nil {
+			return fmt.Errorf("getting subscriptions: %w", err)
+		}
+		for _, sub := range resp.Data {
+			tiers[sub.UserID] = sub.Tier
+		}
+		return nil
+	})
+
+	return tiers, err
+}
+
+// GetVIPs returns the set of given users who are VIPs of the broadcaster
+//
+// Requires the channel:read:vips scope
+func (c *Client) GetVIPs(
+	ctx context.Context,
+	broadcasterID string,
+	userIDs []string,
+) (map[string]bool, error) {
+	return c.userSet(ctx, "/channels/vips", broadcasterID, userIDs)
+}
+
+// GetModerators returns the set of given users who are moderators of the broadcaster
+//
+// Requires the moderation:read scope
+func (c *Client) GetModerators(
+	ctx context.Context,
+	broadcasterID string,
+	userIDs []string,
+) (map[string]bool, error) {
+	return c.userSet(ctx, "/moderation/moderators", broadcasterID, userIDs)
+}
+
+// IsFollower returns whether the user follows the broadcaster
+//
+// Requires the moderator:read:followers scope
+func (c *Client) IsFollower(ctx context.Context, broadcasterID string, userID string) (bool, error) {
+	var resp struct {
+		Data []struct {
+			UserID string `json:"user_id"`
+		} `json:"data"`
+	}
+
+	query := url.Values{}
+	query.Set("broadcaster_id", broadcasterID)
+	query.Set("user_id", userID)
+
+	if err := c.do(ctx, http.MethodGet, "/channels/followers", query, nil, &resp); err != nil {
+		return false, fmt.Errorf("getting followers: %w", err)
+	}
+
+	return len(resp.Data) > 0, nil
+}
+
+// Queries an endpoint returning a list of users filtered by user_id
+// and returns the set of user IDs contained in the response
+func (c *Client) userSet(
+	ctx context.Context,
+	path string,
+	broadcasterID string,
+	userIDs []string,
+) (map[string]bool, error) {
+	var resp struct {
+		Data []struct {
+			UserID string `json:"user_id"`
+		} `json:"data"`
+	}
+
+	set := make(map[string]bool)
+	err := c.batched(userIDs, func(batch []string) error {
+		if err := c.do(ctx, http.MethodGet, path, batchQuery(broadcasterID, batch), nil, &resp); err != nil {
+			return fmt.Errorf("getting %s: %w", path, err)
+		}
+		for _, u := range resp.Data {
+			set[u.UserID] = true
+		}
+		return nil
+	})
+
+	return set, err
+}
+
+// Calls fn for every batch of at most MaxBatchSize IDs
+func (c *Client) batched(ids []string, fn func(batch []string) error) error {
+	for start := 0; start < len(ids); start += MaxBatchSize {
+		end := min(start+MaxBatchSize, len(ids))
+		if err := fn(ids[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Builds a query with the broadcaster ID and multiple user IDs
+func batchQuery(broadcasterID string, userIDs []string) url.Values {
+	query := url.Values{}
+	query.Set("broadcaster_id", broadcasterID)
+	query.Set("first", fmt.Sprint(MaxBatchSize))
+	for _, id := range userIDs {
+		query.Add("user_id", id)
+	}
+	return query
+}
@@ -0,0 +1,100 @@
+package helix
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// EventSubSubscription is an EventSub subscription as returned by Helix
+type EventSubSubscription struct {
+	ID        string            `json:"id"`
+	Status    string            `json:"status"`
+	Type      string            `json:"type"`
+	Version   string            `json:"version"`
+	Condition map[string]string `json:"condition"`
+	Transport EventSubTransport `json:"transport"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// EventSubTransport describes how notifications are delivered
+type EventSubTransport struct {
+	Method   string `json:"method"`
+	Callback string `json:"callback"`
+	// Only sent when creating subscriptions
+	Secret string `json:"secret,omitempty"`
+}
+
+// GetEventSubSubscriptions returns all EventSub subscriptions of the client
+//
+// Requires an app access token
+func (c *Client) GetEventSubSubscriptions(ctx context.Context) ([]EventSubSubscription, error) {
+	var subs []EventSubSubscription
+
+	query := url.Values{}
+	for {
+		var resp struct {
+			Data       []EventSubSubscription `json:"data"`
+			Pagination struct {
+				Cursor string `json:"cursor"`
+			} `json:"pagination"`
+		}
+
+		if err := c.do(ctx, http.MethodGet, "/eventsub/subscriptions", query, nil, &resp); err != nil {
+			return nil, fmt.Errorf("getting eventsub subscriptions: %w", err)
+		}
+
+		subs = append(subs, resp.Data...)
+
+		if resp.Pagination.Cursor == "" {
+			return subs, nil
+		}
+		query.Set("after", resp.Pagination.Cursor)
+	}
+}
+
+// CreateEventSubSubscription creates an EventSub subscription
+// and returns it as created by Twitch
+//
+// Requires an app access token
+func (c *Client) CreateEventSubSubscription(
+	ctx context.Context,
+	sub EventSubSubscription,
+) (*EventSubSubscription, error) {
+	var resp struct {
+		Data []EventSubSubscription `json:"data"`
+	}
+
+	body := struct {
+		Type      string            `json:"type"`
+		Version   string            `json:"version"`
+		Condition map[string]string `json:"condition"`
+		Transport EventSubTransport `json:"transport"`
+	}{sub.Type, sub.Version, sub.Condition, sub.Transport}
+
+	if err := c.do(ctx, http.MethodPost, "/eventsub/subscriptions", nil, body, &resp); err != nil {
+		return nil, fmt.Errorf("creating eventsub subscription %s: %w", sub.Type, err)
+	}
+
+	if len(resp.Data) == 0 {
+		return nil, fmt.Errorf("creating eventsub subscription %s: empty response", sub.Type)
+	}
+
+	return &resp.Data[0], nil
+}
+
+// DeleteEventSubSubscription deletes the EventSub subscription with the given ID
+//
+// Requires an app access token
+func (c *Client) DeleteEventSubSubscription(ctx context.Context, id string) error {
+	query := url.Values{}
+	query.Set("id", id)
+
+	if err := c.do(ctx, http.MethodDelete, "/eventsub/subscriptions", query, nil, nil); err != nil {
+		return fmt.Errorf("deleting eventsub subscription %s: %w", id, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,206 @@
+package helix
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// Config for the Helix API client
+type Config struct {
+	ClientID string
+	// Source of the (user or app) access token used for requests
+	TokenSource oauth2.TokenSource
+	// Defaults to the official Helix API
+	BaseURL string
+}
+
+// Client is a minimal Twitch Helix API client
+//
+// Respects the rate limit Helix reports via response headers
+// by waiting for the bucket to refill once it is exhausted
+type Client struct {
+	clientID    string
+	tokenSource oauth2.TokenSource
+	baseURL     string
+	httpClient  *http.Client
+
+	mu sync.Mutex
+	// Remaining points in the rate limit bucket, -1 if unknown
+	remaining int
+	// Time the rate limit bucket refills
+	reset time.Time
+}
+
+// Error is returned if Helix responds with a non 2xx status code
+type Error struct {
+	StatusCode int    `json:"status"`
+	ErrorText  string `json:"error"`
+	Message    string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("helix: %d %s: %s", e.StatusCode, e.ErrorText, e.Message)
+}
+
+// Performs a request against path with query and body (marshalled as json)
+// and decodes the json response into v
+//
+// Requests hitting the rate limit are retried once after the bucket refilled
+func (c *Client) do(
+	ctx context.Context,
+	method string,
+	path string,
+	query url.Values,
+	body interface{},
+	v interface{},
+) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		payload, err = json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("helix: marshalling body: %w", err)
+		}
+	}
+
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	for attempt := 0; ; attempt++ {
+		if err := c.waitForRateLimit(ctx); err != nil {
+			return err
+		}
+
+		token, err := c.tokenSource.Token()
+		if err != nil {
+			return fmt.Errorf("helix: getting token: %w", err)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+		req.Header.Add("Accept", "application/json")
+		req.Header.Add("Content-Type", "application/json")
+		req.Header.Add("Client-Id", c.clientID)
+		token.SetAuthHeader(req)
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return err
+		}
+
+		c.updateRateLimit(resp.Header)
+
+		if resp.StatusCode == http.StatusTooManyRequests && attempt == 0 {
+			resp.Body.Close()
+			continue
+		}
+
+		err = decodeResponse(resp, v)
+		resp.Body.Close()
+		return err
+	}
+}
+
+// Decodes a Helix response into v or returns an *Error
+func decodeResponse(resp *http.Response, v interface{}) error {
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		hErr := &Error{StatusCode: resp.StatusCode}
+		_ = json.NewDecoder(resp.Body).Decode(hErr)
+		return hErr
+	}
+
+	if v == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// Blocks until the rate limit bucket has points left or ctx is done
+func (c *Client) waitForRateLimit(ctx context.Context) error {
+	c.mu.Lock()
+	wait := time.Duration(0)
+	if c.remaining == 0 {
+		wait = time.Until(c.reset)
+	}
+	c.mu.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		c.mu.Lock()
+		c.remaining = -1
+		c.mu.Unlock()
+		return nil
+	}
+}
+
+// Stores the rate limit state reported by Helix
+func (c *Client) updateRateLimit(header http.Header) {
+	remaining, err := strconv.Atoi(header.Get("Ratelimit-Remaining"))
+	if err != nil {
+		return
+	}
+
+	reset, err := strconv.ParseInt(header.Get("Ratelimit-Reset"), 10, 64)
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.remaining = remaining
+	c.reset = time.Unix(reset, 0)
+}
+
+// NewClient creates a new Helix API client
+func NewClient(cfg Config) (*Client, error) {
+	if cfg.ClientID == "" {
+		return nil, fmt.Errorf("helix: client id is empty")
+	}
+
+	if cfg.TokenSource == nil {
+		return nil, fmt.Errorf("helix: token source is nil")
+	}
+
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
+		baseURL = defaultBaseURL
+	}
+
+	return &Client{
+		clientID:    cfg.ClientID,
+		tokenSource: cfg.TokenSource,
+		baseURL:     baseURL,
+		httpClient:  &http.Client{Timeout: 10 * time.Second},
+		remaining:   -1,
+	}, nil
+}
+
+const (
+	defaultBaseURL = "https://api.twitch.tv/helix"
+	// Maximum amount of IDs Helix accepts per request
+	MaxBatchSize = 100
+)
@@ -0,0 +1,43 @@
+package helix
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// Statuses of channel points redemptions
+const (
+	RedemptionFulfilled = "FULFILLED"
+	// Refunds the channel points to the viewer
+	RedemptionCanceled = "CANCELED"
+)
+
+// UpdateRedemptionStatus fulfills or cancels a channel points redemption
+//
+// Only works for rewards created with the same client ID,
+// requires the channel:manage:redemptions scope
+func (c *Client) UpdateRedemptionStatus(
+	ctx context.Context,
+	broadcasterID string,
+	rewardID string,
+	redemptionID string,
+	status string,
+) error {
+	query := url.Values{}
+	query.Set("broadcaster_id", broadcasterID)
+	query.Set("reward_id", rewardID)
+	query.Set("id", redemptionID)
+
+	body := struct {
+		Status string `json:"status"`
+	}{status}
+
+	err := c.do(ctx, http.MethodPatch, "/channel_points/custom_rewards/redemptions", query, body, nil)
+	if err != nil {
+		return fmt.Errorf("updating redemption %s: %w", redemptionID, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,46 @@
+package helix
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Stream is a live stream as returned by Helix
+type Stream struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	UserLogin string    `json:"user_login"`
+	UserName  string    `json:"user_name"`
+	GameName  string    `json:"game_name"`
+	Title     string    `json:"title"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// GetStreams returns the live streams of the given users,
+// users who are not live are omitted
+func (c *Client) GetStreams(ctx context.Context, userIDs []string) ([]Stream, error) {
+	var resp struct {
+		Data []Stream `json:"data"`
+	}
+
+	var streams []Stream
+	err := c.batched(userIDs, func(batch []string) error {
+		query := url.Values{}
+		query.Set("first", fmt.Sprint(MaxBatchSize))
+		for _, id := range batch {
+			query.Add("user_id", id)
+		}
+
+		if err := c.do(ctx, http.MethodGet, "/streams", query, nil, &resp); err != nil {
+			return fmt.Errorf("getting streams: %w", err)
+		}
+
+		streams = append(streams, resp.Data...)
+		return nil
+	})
+
+	return streams, err
+}
@@ -0,0 +1,52 @@
+package helix
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// User is a Twitch user as returned by Helix
+type User struct {
+	ID              string `json:"id"`
+	Login           string `json:"login"`
+	DisplayName     string `json:"display_name"`
+	ProfileImageURL string `json:"profile_image_url"`
+}
+
+// GetUsers returns the users with the given IDs,
+// users which do not exist (anymore) are omitted
+func (c *Client) GetUsers(ctx context.Context, ids []string) ([]User, error) {
+	return c.getUsers(ctx, "id", ids)
+}
+
+// GetUsersByLogin returns the users with the given login names,
+// users which do not exist (anymore) are omitted
+func (c *Client) GetUsersByLogin(ctx context.Context, logins []string) ([]User, error) {
+	return c.getUsers(ctx, "login", logins)
+}
+
+// Gets users filtered by key (id or login)
+func (c *Client) getUsers(ctx context.Context, key string, values []string) ([]User, error) {
+	var resp struct {
+		Data []User `json:"data"`
+	}
+
+	var users []User
+	err := c.batched(values, func(batch []string) error {
+		query := url.Values{}
+		for _, v := range batch {
+			query.Add(key, v)
+		}
+
+		if err := c.do(ctx, http.MethodGet, "/users", query, nil, &resp); err != nil {
+			return fmt.Errorf("getting users: %w", err)
+		}
+
+		users = append(users, resp.Data...)
+		return nil
+	})
+
+	return users, err
+}
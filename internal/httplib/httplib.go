@@ -1,7 +1,9 @@
 package httplib
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"time"
 )
@@ -30,6 +32,29 @@ func AuthorizedGet(method string, url string, token string, v interface{}) error
 	return nil
 }
 
+// Gets response from url as json and unmarshals it to v
+//
+// Returns an error for non 2xx status codes
+func Get(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
 var (
 	client = &http.Client{Timeout: 10 * time.Second}
 )
@@ -0,0 +1,174 @@
+package links
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+
+	"github.com/devusSs/twitchspeak/internal/database"
+	"github.com/devusSs/twitchspeak/internal/database/redis"
+)
+
+// Custom errors
+var (
+	ErrInvalidCode     = errors.New("links: invalid or expired code")
+	ErrTooManyAttempts = errors.New("links: too many failed attempts")
+)
+
+// Handler is called after a TeamSpeak identity has been linked to a Twitch account
+type Handler func(user *database.User)
+
+// OnLink registers a handler which is called (in its own goroutine)
+// every time a TeamSpeak identity has been linked to a Twitch account
+func OnLink(fn Handler) {
+	mu.Lock()
+	defer mu.Unlock()
+	handlers = append(handlers, fn)
+}
+
+// Link links a TeamSpeak identity to a Twitch account
+// and notifies the registered handlers
+//
+// Returns the existing user and database.ErrAlreadyLinked
+// if either of them is already linked
+func Link(svc database.Service, teamSpeakUID string, twitchID string) (*database.User, error) {
+	user, err := svc.LinkUser(teamSpeakUID, twitchID)
+	if err != nil {
+		return user, err
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, fn := range handlers {
+		go fn(user)
+	}
+
+	return user, nil
+}
+
+// IssueCode creates a short, human readable code for a logged in Twitch user
+// which can be redeemed in TeamSpeak to link their identity
+//
+// Issuing a new code invalidates the previous one of the user
+func IssueCode(ctx context.Context, twitchID string) (string, time.Duration, error) {
+	code, err := generateCode()
+	if err != nil {
+		return "", 0, fmt.Errorf("links: generating code: %w", err)
+	}
+
+	client := redis.GetClient()
+
+	previous, err := client.Get(ctx, userCodeKey(twitchID)).Result()
+	if err != nil && !errors.Is(err, goredis.Nil) {
+		return "", 0, fmt.Errorf("links: getting previous code: %w", err)
+	}
+
+	_, err = client.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		if previous != "" {
+			pipe.Del(ctx, codeKey(previous))
+		}
+		pipe.Set(ctx, codeKey(code), twitchID, codeTTL)
+		pipe.Set(ctx, userCodeKey(twitchID), code, codeTTL)
+		return nil
+	})
+	if err != nil {
+		return "", 0, fmt.Errorf("links: storing code: %w", err)
+	}
+
+	return code, codeTTL, nil
+}
+
+// RedeemCode returns the Twitch ID the code was issued for and deletes the code
+//
+// Attempts are counted per TeamSpeak identity and reset once a code was
+// redeemed, after maxAttempts ErrTooManyAttempts is returned until they expire
+func RedeemCode(ctx context.Context, teamSpeakUID string, code string) (string, error) {
+	client := redis.GetClient()
+
+	// Counting before checking keeps concurrent attempts from exceeding the limit
+	var attempts *goredis.IntCmd
+	_, err := client.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		attempts = pipe.Incr(ctx, attemptsKey(teamSpeakUID))
+		pipe.Expire(ctx, attemptsKey(teamSpeakUID), attemptsTTL)
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("links: counting attempt: %w", err)
+	}
+	if attempts.Val() > maxAttempts {
+		return "", ErrTooManyAttempts
+	}
+
+	twitchID, err := client.GetDel(ctx, codeKey(normalizeCode(code))).Result()
+	if errors.Is(err, goredis.Nil) {
+		return "", ErrInvalidCode
+	}
+	if err != nil {
+		return "", fmt.Errorf("links: getting code: %w", err)
+	}
+
+	client.Del(ctx, userCodeKey(twitchID), attemptsKey(teamSpeakUID))
+
+	return twitchID, nil
+}
+
+// Generates a code like "ABCD-EFGH" without ambiguous characters
+func generateCode() (string, error) {
+	var sb strings.Builder
+	alphabetSize := big.NewInt(int64(len(codeAlphabet)))
+
+	for i := 0; i < codeLength; i++ {
+		if i == codeLength/2 {
+			sb.WriteByte('-')
+		}
+		n, err := rand.Int(rand.Reader, alphabetSize)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteByte(codeAlphabet[n.Int64()])
+	}
+
+	return sb.String(), nil
+}
+
+// Makes codes case insensitive and the dash optional
+func normalizeCode(code string) string {
+	code = strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	if len(code) != codeLength {
+		return code
+	}
+	return code[:codeLength/2] + "-" + code[codeLength/2:]
+}
+
+func codeKey(code string) string {
+	return "twitchspeak:links:code:" + code
+}
+
+func userCodeKey(twitchID string) string {
+	return "twitchspeak:links:user:" + twitchID
+}
+
+func attemptsKey(teamSpeakUID string) string {
+	return "twitchspeak:links:attempts:" + teamSpeakUID
+}
+
+const (
+	codeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	codeLength   = 8
+	codeTTL      = 10 * time.Minute
+
+	maxAttempts = 5
+	attemptsTTL = 15 * time.Minute
+)
+
+var (
+	mu       sync.RWMutex
+	handlers []Handler
+)
@@ -0,0 +1,117 @@
+package links
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"github.com/devusSs/twitchspeak/internal/database/redis"
+)
+
+func startRedis(t *testing.T) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+
+	host, port, err := net.SplitHostPort(mr.Addr())
+	if err != nil {
+		t.Fatalf("splitting redis address: %v", err)
+	}
+	p, err := strconv.ParseUint(port, 10, 0)
+	if err != nil {
+		t.Fatalf("parsing redis port: %v", err)
+	}
+
+	if err := redis.Init(redis.Config{Host: host, Port: uint(p)}); err != nil {
+		t.Fatalf("connecting to redis: %v", err)
+	}
+}
+
+func TestRedeemCode(t *testing.T) {
+	startRedis(t)
+	ctx := context.Background()
+
+	code, _, err := IssueCode(ctx, "1337")
+	if err != nil {
+		t.Fatalf("issuing code: %v", err)
+	}
+
+	if _, err := RedeemCode(ctx, "uid=", "WRON-GCOD"); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("err = %v, want %v", err, ErrInvalidCode)
+	}
+
+	// Lowercase and without the dash
+	twitchID, err := RedeemCode(ctx, "uid=", " "+strings.ToLower(strings.ReplaceAll(code, "-", ""))+" ")
+	if err != nil {
+		t.Fatalf("redeeming code: %v", err)
+	}
+	if twitchID != "1337" {
+		t.Fatalf("twitch id = %q, want %q", twitchID, "1337")
+	}
+
+	if _, err := RedeemCode(ctx, "uid=", code); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("err = %v, want %v when redeeming a code twice", err, ErrInvalidCode)
+	}
+}
+
+func TestRedeemCodeAttemptLimit(t *testing.T) {
+	startRedis(t)
+	ctx := context.Background()
+
+	const concurrent = 20
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		invalid  int
+		tooMany  int
+		failures []error
+	)
+	for i := 0; i < concurrent; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			_, err := RedeemCode(ctx, "uid=", "WRON-GCOD")
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case errors.Is(err, ErrInvalidCode):
+				invalid++
+			case errors.Is(err, ErrTooManyAttempts):
+				tooMany++
+			default:
+				failures = append(failures, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(failures) != 0 {
+		t.Fatalf("unexpected errors: %v", failures)
+	}
+	if invalid != maxAttempts || tooMany != concurrent-maxAttempts {
+		t.Fatalf("got %d invalid and %d rejected attempts, want %d and %d", invalid, tooMany, maxAttempts, concurrent-maxAttempts)
+	}
+
+	// Valid codes are rejected as well once the limit is reached
+	code, _, err := IssueCode(ctx, "1337")
+	if err != nil {
+		t.Fatalf("issuing code: %v", err)
+	}
+	if _, err := RedeemCode(ctx, "uid=", code); !errors.Is(err, ErrTooManyAttempts) {
+		t.Fatalf("err = %v, want %v", err, ErrTooManyAttempts)
+	}
+
+	// Other identities are not affected
+	if _, err := RedeemCode(ctx, "other=", code); err != nil {
+		t.Fatalf("redeeming code from another identity: %v", err)
+	}
+}
@@ -0,0 +1,252 @@
+package revoke
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/devusSs/twitchspeak/internal/database"
+	"github.com/devusSs/twitchspeak/internal/eventsub"
+	"github.com/devusSs/twitchspeak/internal/teamspeak"
+	"github.com/devusSs/twitchspeak/pkg/log"
+)
+
+// Sources of revocations
+const (
+	SourceEventSub     = "eventsub"
+	SourceTokenRefresh = "token_refresh"
+	SourceAdmin        = "admin"
+)
+
+// Config for the revoker
+type Config struct {
+	Bot *teamspeak.Bot
+	DB  database.Service
+	// Server groups granted by twitchspeak, removed on revocation
+	Groups  []int
+	Console bool
+	Debug   bool
+}
+
+// Revoker strips the privileges of users who revoked
+// the authorization of our app on Twitch
+type Revoker struct {
+	bot    *teamspeak.Bot
+	db     database.Service
+	logger *log.Logger
+
+	mu     sync.RWMutex
+	groups []int
+}
+
+// AddGroups adds server groups granted by twitchspeak
+// which need to be removed on revocation
+func (r *Revoker) AddGroups(groups ...int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, group := range groups {
+		if group != 0 && !slices.Contains(r.groups, group) {
+			r.groups = append(r.groups, group)
+		}
+	}
+}
+
+// Revoke marks the link of the Twitch user as revoked, deletes their tokens
+// and grants, removes the server groups granted by twitchspeak, notifies them
+// in TeamSpeak if online and records an audit event
+//
+// Does nothing if the user is not linked or already revoked
+func (r *Revoker) Revoke(twitchID string, source string) error {
+	err := r.db.DeleteToken(twitchID)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		return fmt.Errorf("deleting token: %w", err)
+	}
+
+	user, err := r.db.GetUserByTwitchID(twitchID)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("getting user: %w", err)
+	}
+
+	if user.Revoked() {
+		return nil
+	}
+
+	now := time.Now()
+	if err := r.db.SetRevokedAt(twitchID, &now); err != nil {
+		return fmt.Errorf("marking user as revoked: %w", err)
+	}
+
+	// The granted groups are removed below, a new login does not restore them
+	if err := r.db.DeleteGrantsByTwitchID(twitchID); err != nil {
+		return fmt.Errorf("deleting grants: %w", err)
+	}
+
+	removed, err := r.removeGroups(user.TeamSpeakUID)
+	if err != nil {
+		r.logger.Error("Error removing server groups of %s: %v", user.TeamSpeakUID, err)
+	}
+
+	online, err := r.bot.MessageUID(user.TeamSpeakUID, fmt.Sprintf(
+		"You revoked the access to your Twitch account, your Twitch related server groups have been removed. Use %sconnect to login again.",
+		r.bot.Commands().Prefix(),
+	))
+	if err != nil {
+		r.logger.Error("Error notifying %s: %v", user.TeamSpeakUID, err)
+	}
+
+	err = r.db.AddAuditEvent(&database.AuditEvent{
+		Action:       database.AuditAuthorizationRevoked,
+		TeamSpeakUID: user.TeamSpeakUID,
+		TwitchID:     user.TwitchID,
+		Source:       source,
+		Details:      fmt.Sprintf("removed server groups %v, notified: %v", removed, online),
+	})
+	if err != nil {
+		return fmt.Errorf("adding audit event: %w", err)
+	}
+
+	r.logger.Info(
+		"Revoked %s (Twitch %s) via %s, removed server groups %v",
+		user.TeamSpeakUID,
+		user.TwitchID,
+		source,
+		removed,
+	)
+
+	return nil
+}
+
+// Unlink removes the link of the Twitch user, their tokens and grants, removes
+// the server groups granted by twitchspeak, notifies them in TeamSpeak if online
+// and records an audit event
+//
+// Returns database.ErrNotFound if the user is not linked
+func (r *Revoker) Unlink(twitchID string, source string) (*database.User, error) {
+	user, err := r.db.GetUserByTwitchID(twitchID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.db.DeleteUserByTeamSpeakUID(user.TeamSpeakUID); err != nil {
+		return nil, fmt.Errorf("deleting user: %w", err)
+	}
+
+	err = r.db.DeleteToken(twitchID)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		return nil, fmt.Errorf("deleting token: %w", err)
+	}
+
+	if err := r.db.DeleteGrantsByTwitchID(twitchID); err != nil {
+		return nil, fmt.Errorf("deleting grants: %w", err)
+	}
+
+	removed, err := r.removeGroups(user.TeamSpeakUID)
+	if err != nil {
+		r.logger.Error("Error removing server groups of %s: %v", user.TeamSpeakUID, err)
+	}
+
+	online, err := r.bot.MessageUID(user.TeamSpeakUID, fmt.Sprintf(
+		"Your TeamSpeak identity has been disconnected from Twitch, your Twitch related server groups have been removed. Use %sconnect to connect it again.",
+		r.bot.Commands().Prefix(),
+	))
+	if err != nil {
+		r.logger.Error("Error notifying %s: %v", user.TeamSpeakUID, err)
+	}
+
+	err = r.db.AddAuditEvent(&database.AuditEvent{
+		Action:       database.AuditUnlinked,
+		TeamSpeakUID: user.TeamSpeakUID,
+		TwitchID:     user.TwitchID,
+		Source:       source,
+		Details:      fmt.Sprintf("removed server groups %v, notified: %v", removed, online),
+	})
+	if err != nil {
+		return user, fmt.Errorf("adding audit event: %w", err)
+	}
+
+	r.logger.Info(
+		"Unlinked %s (Twitch %s) via %s, removed server groups %v",
+		user.TeamSpeakUID,
+		user.TwitchID,
+		source,
+		removed,
+	)
+
+	return user, nil
+}
+
+// HandleEvent revokes users on user.authorization.revoke notifications
+func (r *Revoker) HandleEvent(ctx context.Context, event eventsub.Event) {
+	revoke, ok := event.(*eventsub.UserAuthorizationRevoke)
+	if !ok {
+		return
+	}
+
+	if err := r.Revoke(revoke.UserID, SourceEventSub); err != nil {
+		r.logger.Error("Error revoking %s: %v", revoke.UserID, err)
+	}
+}
+
+// HandleTokenRejected revokes users whose refresh token got rejected
+func (r *Revoker) HandleTokenRejected(twitchID string) {
+	if err := r.Revoke(twitchID, SourceTokenRefresh); err != nil {
+		r.logger.Error("Error revoking %s: %v", twitchID, err)
+	}
+}
+
+// Removes the server groups granted by twitchspeak the client is a member of
+func (r *Revoker) removeGroups(uid string) ([]int, error) {
+	current, err := r.bot.ServerGroupsByUID(uid)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var removed []int
+	for _, group := range r.groups {
+		if !slices.Contains(current, group) {
+			continue
+		}
+		if err := r.bot.RemoveServerGroup(uid, group); err != nil {
+			return removed, err
+		}
+		removed = append(removed, group)
+	}
+
+	return removed, nil
+}
+
+// NewRevoker creates a new revoker
+func NewRevoker(cfg Config) (*Revoker, error) {
+	if cfg.Bot == nil {
+		return nil, fmt.Errorf("revoke: bot is nil")
+	}
+
+	if cfg.DB == nil {
+		return nil, fmt.Errorf("revoke: database service is nil")
+	}
+
+	logger := log.NewLogger(
+		log.WithOwnLogFile("revoke.log"),
+		log.WithName("revoke"),
+		log.WithConsole(cfg.Console),
+		log.WithDebug(cfg.Debug),
+	)
+
+	r := &Revoker{
+		bot:    cfg.Bot,
+		db:     cfg.DB,
+		logger: logger,
+	}
+	r.AddGroups(cfg.Groups...)
+
+	return r, nil
+}
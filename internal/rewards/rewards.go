@@ -0,0 +1,246 @@
+package rewards
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+	"unicode/utf8"
+
+	"github.com/devusSs/twitchspeak/internal/database"
+	"github.com/devusSs/twitchspeak/internal/eventsub"
+	"github.com/devusSs/twitchspeak/internal/grants"
+	"github.com/devusSs/twitchspeak/internal/helix"
+	"github.com/devusSs/twitchspeak/internal/teamspeak"
+	"github.com/devusSs/twitchspeak/internal/tempchannels"
+	"github.com/devusSs/twitchspeak/pkg/log"
+)
+
+// Reasons for refunding redemptions
+var (
+	errNotLinked       = errors.New("redeemer has no linked TeamSpeak identity")
+	errStreamerUnknown = errors.New("streamer has no linked TeamSpeak identity")
+	errStreamerOffline = errors.New("streamer is not online in TeamSpeak")
+	errChannelExists   = errors.New("redeemer already has a channel")
+)
+
+// Config for the redeemer
+type Config struct {
+	Helix *helix.Client
+	// Twitch user ID of the channel the rewards belong to
+	BroadcasterID string
+	Bot           *teamspeak.Bot
+	DB            database.Service
+	// Required for group rewards
+	Grants *grants.Scheduler
+	// Required for channel rewards
+	Channels *tempchannels.Manager
+	Rewards  []Reward
+	Console  bool
+	Debug    bool
+}
+
+// Redeemer triggers TeamSpeak actions for channel points redemptions of linked users
+type Redeemer struct {
+	helix         *helix.Client
+	broadcasterID string
+	bot           *teamspeak.Bot
+	db            database.Service
+	grants        *grants.Scheduler
+	channels      *tempchannels.Manager
+	rewards       map[string]Reward
+	logger        *log.Logger
+}
+
+// HandleEvent handles redemptions of configured rewards,
+// fulfills them if the action succeeded and refunds them otherwise
+func (r *Redeemer) HandleEvent(ctx context.Context, event eventsub.Event) {
+	redemption, ok := event.(*eventsub.RedemptionAdd)
+	if !ok {
+		return
+	}
+
+	reward, ok := r.rewards[redemption.Reward.ID]
+	if !ok {
+		return
+	}
+
+	result, err := r.redeem(redemption, reward)
+
+	status := helix.RedemptionFulfilled
+	if err != nil {
+		status = helix.RedemptionCanceled
+		result = err.Error()
+		r.logger.Warn("Refunding %q redeemed by %s: %v", redemption.Reward.Title, redemption.UserLogin, err)
+	} else {
+		r.logger.Info("%s redeemed %q: %s", redemption.UserLogin, redemption.Reward.Title, result)
+	}
+
+	// Rewards skipping the request queue are fulfilled already
+	if redemption.Status == "unfulfilled" {
+		err := r.helix.UpdateRedemptionStatus(ctx, r.broadcasterID, reward.ID, redemption.ID, status)
+		if err != nil {
+			r.logger.Error("Error updating redemption %s: %v", redemption.ID, err)
+		}
+	}
+
+	var uid string
+	if user, err := r.db.GetUserByTwitchID(redemption.UserID); err == nil {
+		uid = user.TeamSpeakUID
+	}
+
+	err = r.db.AddAuditEvent(&database.AuditEvent{
+		Action:       database.AuditRewardRedeemed,
+		TeamSpeakUID: uid,
+		TwitchID:     redemption.UserID,
+		Source:       database.GrantSourceChannelPoints,
+		Details: fmt.Sprintf(
+			"reward: %s (%s), action: %s, status: %s, result: %s",
+			redemption.Reward.Title,
+			reward.ID,
+			reward.Kind,
+			status,
+			result,
+		),
+	})
+	if err != nil {
+		r.logger.Error("Error adding audit event: %v", err)
+	}
+}
+
+// Runs the action of the reward and returns a description of the result
+func (r *Redeemer) redeem(redemption *eventsub.RedemptionAdd, reward Reward) (string, error) {
+	user, err := r.db.GetUserByTwitchID(redemption.UserID)
+	if errors.Is(err, database.ErrNotFound) {
+		return "", errNotLinked
+	}
+	if err != nil {
+		return "", fmt.Errorf("getting user: %w", err)
+	}
+	if user.Revoked() {
+		return "", errNotLinked
+	}
+
+	switch reward.Kind {
+	case KindGroup:
+		grant, err := r.grants.Extend(user, reward.ServerGroup, reward.Duration, database.GrantSourceChannelPoints)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("server group %d until %s", reward.ServerGroup, grant.ExpiresAt.Format(time.RFC3339)), nil
+	case KindChannel:
+		channel, created, err := r.channels.Ensure(user, nil)
+		if err != nil {
+			return "", err
+		}
+		if !created {
+			return "", errChannelExists
+		}
+		return fmt.Sprintf("channel %d", channel.ChannelID), nil
+	case KindPoke:
+		if err := r.poke(redemption); err != nil {
+			return "", err
+		}
+		return "poked streamer", nil
+	default:
+		return "", fmt.Errorf("unknown action %q", reward.Kind)
+	}
+}
+
+// Pokes the streamer about the redemption
+func (r *Redeemer) poke(redemption *eventsub.RedemptionAdd) error {
+	streamer, err := r.db.GetUserByTwitchID(r.broadcasterID)
+	if errors.Is(err, database.ErrNotFound) {
+		return errStreamerUnknown
+	}
+	if err != nil {
+		return fmt.Errorf("getting streamer: %w", err)
+	}
+
+	msg := fmt.Sprintf("%s redeemed %s", redemption.UserName, redemption.Reward.Title)
+	if redemption.UserInput != "" {
+		msg += ": " + redemption.UserInput
+	}
+
+	// TeamSpeak limits pokes to 100 characters
+	for utf8.RuneCountInString(msg) > maxPokeLength {
+		_, size := utf8.DecodeLastRuneInString(msg)
+		msg = msg[:len(msg)-size]
+	}
+
+	online, err := r.bot.PokeUID(streamer.TeamSpeakUID, msg)
+	if err != nil {
+		return err
+	}
+	if !online {
+		return errStreamerOffline
+	}
+
+	return nil
+}
+
+// Groups returns all server groups granted by rewards
+func (r *Redeemer) Groups() []int {
+	var groups []int
+	for _, reward := range r.rewards {
+		if reward.Kind == KindGroup && !slices.Contains(groups, reward.ServerGroup) {
+			groups = append(groups, reward.ServerGroup)
+		}
+	}
+	return groups
+}
+
+// NewRedeemer creates a new redeemer
+func NewRedeemer(cfg Config) (*Redeemer, error) {
+	if cfg.Helix == nil {
+		return nil, fmt.Errorf("rewards: helix client is nil")
+	}
+
+	if cfg.BroadcasterID == "" {
+		return nil, fmt.Errorf("rewards: broadcaster id is empty")
+	}
+
+	if cfg.Bot == nil {
+		return nil, fmt.Errorf("rewards: bot is nil")
+	}
+
+	if cfg.DB == nil {
+		return nil, fmt.Errorf("rewards: database service is nil")
+	}
+
+	rewards := make(map[string]Reward, len(cfg.Rewards))
+	for _, reward := range cfg.Rewards {
+		if reward.Kind == KindGroup && cfg.Grants == nil {
+			return nil, fmt.Errorf("rewards: reward %s requires the grant scheduler", reward.ID)
+		}
+		if reward.Kind == KindChannel && cfg.Channels == nil {
+			return nil, fmt.Errorf("rewards: reward %s requires streamer channels", reward.ID)
+		}
+		rewards[reward.ID] = reward
+	}
+
+	logger := log.NewLogger(
+		log.WithOwnLogFile("rewards.log"),
+		log.WithName("rewards"),
+		log.WithConsole(cfg.Console),
+		log.WithDebug(cfg.Debug),
+	)
+
+	r := &Redeemer{
+		helix:         cfg.Helix,
+		broadcasterID: cfg.BroadcasterID,
+		bot:           cfg.Bot,
+		db:            cfg.DB,
+		grants:        cfg.Grants,
+		channels:      cfg.Channels,
+		rewards:       rewards,
+		logger:        logger,
+	}
+
+	r.logger.Info("Redeemer initialized with rewards: %v", cfg.Rewards)
+
+	return r, nil
+}
+
+const maxPokeLength = 100
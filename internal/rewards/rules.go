@@ -0,0 +1,104 @@
+package rewards
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kind of TeamSpeak action triggered by a reward
+type Kind string
+
+// Supported kinds
+const (
+	// Server group for a limited duration
+	KindGroup Kind = "group"
+	// Own channel, see tempchannels
+	KindChannel Kind = "channel"
+	// Poke to the streamer
+	KindPoke Kind = "poke"
+)
+
+// Reward maps a custom channel points reward to a TeamSpeak action
+type Reward struct {
+	ID   string
+	Kind Kind
+	// Only set for groups
+	ServerGroup int
+	Duration    time.Duration
+}
+
+func (r Reward) String() string {
+	if r.Kind == KindGroup {
+		return fmt.Sprintf("%s=%s:%d:%v", r.ID, r.Kind, r.ServerGroup, r.Duration)
+	}
+	return fmt.Sprintf("%s=%s", r.ID, r.Kind)
+}
+
+// ParseRewards parses a comma separated list of rewards
+// in the form of "reward ID=action", where action is one of
+// "group:server group ID:duration", "channel" or "poke",
+// e.g. "1a2b=group:15:2h,3c4d=channel,5e6f=poke"
+func ParseRewards(s string) ([]Reward, error) {
+	var rewards []Reward
+
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		id, action, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("rewards: invalid reward %q, expected reward=action", part)
+		}
+
+		reward, err := NewReward(strings.TrimSpace(id), strings.TrimSpace(action))
+		if err != nil {
+			return nil, err
+		}
+
+		rewards = append(rewards, reward)
+	}
+
+	return rewards, nil
+}
+
+// NewReward validates and creates a reward
+func NewReward(id string, action string) (Reward, error) {
+	if id == "" {
+		return Reward{}, fmt.Errorf("rewards: reward id is empty")
+	}
+
+	args := strings.Split(action, ":")
+	reward := Reward{ID: id, Kind: Kind(strings.ToLower(args[0]))}
+
+	switch reward.Kind {
+	case KindGroup:
+		if len(args) != 3 {
+			return Reward{}, fmt.Errorf("rewards: invalid action %q, expected group:server group:duration", action)
+		}
+
+		group, err := strconv.Atoi(args[1])
+		if err != nil || group <= 0 {
+			return Reward{}, fmt.Errorf("rewards: invalid server group %q", args[1])
+		}
+
+		duration, err := time.ParseDuration(args[2])
+		if err != nil || duration <= 0 {
+			return Reward{}, fmt.Errorf("rewards: invalid duration %q", args[2])
+		}
+
+		reward.ServerGroup = group
+		reward.Duration = duration
+	case KindChannel, KindPoke:
+		if len(args) != 1 {
+			return Reward{}, fmt.Errorf("rewards: action %q takes no arguments", args[0])
+		}
+	default:
+		return Reward{}, fmt.Errorf("rewards: unknown action %q", args[0])
+	}
+
+	return reward, nil
+}
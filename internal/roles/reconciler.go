@@ -0,0 +1,153 @@
+package roles
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/devusSs/twitchspeak/internal/database"
+	"github.com/devusSs/twitchspeak/internal/helix"
+)
+
+// Summary of a reconciliation run
+type Summary struct {
+	Users    int
+	Changed  int
+	Added    int
+	Removed  int
+	Failed   int
+	Duration time.Duration
+	DryRun   bool
+}
+
+func (s Summary) String() string {
+	mode := ""
+	if s.DryRun {
+		mode = " (dry run)"
+	}
+	return fmt.Sprintf(
+		"checked %d users, changed %d, added %d groups, removed %d groups, failed %d in %v%s",
+		s.Users,
+		s.Changed,
+		s.Added,
+		s.Removed,
+		s.Failed,
+		s.Duration.Round(time.Millisecond),
+		mode,
+	)
+}
+
+// Reconcile walks all linked users in batches, re-checks their Twitch status
+// and applies the minimal set of server group changes
+//
+// Does not change anything if the syncer runs in dry run mode
+func (s *Syncer) Reconcile(ctx context.Context) (Summary, error) {
+	start := time.Now()
+	summary := Summary{DryRun: s.dryRun}
+
+	for offset := 0; ; offset += helix.MaxBatchSize {
+		users, _, err := s.db.ListUsers(database.ListOptions{
+			Offset: offset,
+			Limit:  helix.MaxBatchSize,
+		})
+		if err != nil {
+			return summary, fmt.Errorf("listing users: %w", err)
+		}
+
+		if len(users) == 0 {
+			break
+		}
+
+		twitchIDs := make([]string, 0, len(users))
+		for _, user := range users {
+			twitchIDs = append(twitchIDs, user.TwitchID)
+		}
+
+		statuses, err := s.Resolve(ctx, twitchIDs)
+		if err != nil {
+			return summary, fmt.Errorf("resolving status: %w", err)
+		}
+
+		for _, user := range users {
+			summary.Users++
+
+			status := statuses[user.TwitchID]
+			// Revoked users lose all managed groups
+			if user.Revoked() {
+				status = Status{}
+			}
+
+			changes, err := s.apply(user.TeamSpeakUID, status, s.dryRun)
+			if err != nil {
+				summary.Failed++
+				s.logger.Warn("Could not reconcile %s (Twitch %s): %v", user.TeamSpeakUID, user.TwitchID, err)
+				continue
+			}
+
+			if changes.Empty() {
+				continue
+			}
+
+			summary.Changed++
+			summary.Added += len(changes.Added)
+			summary.Removed += len(changes.Removed)
+
+			s.logger.Debug(
+				"reconciled %s (Twitch %s): added %v, removed %v, dry run: %v",
+				user.TeamSpeakUID,
+				user.TwitchID,
+				changes.Added,
+				changes.Removed,
+				s.dryRun,
+			)
+		}
+
+		if len(users) < helix.MaxBatchSize {
+			break
+		}
+	}
+
+	summary.Duration = time.Since(start)
+
+	return summary, nil
+}
+
+// PeriodicReconcile reconciles all linked users right away and every interval,
+// interval defaults to 1 hour if not positive
+//
+// Blocking until context is canceled
+func (s *Syncer) PeriodicReconcile(ctx context.Context, interval time.Duration, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	if interval <= 0 {
+		interval = defaultReconcileInterval
+	}
+
+	s.reconcile(ctx)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.logger.Debug("Exiting role reconciler")
+			return
+		case <-ticker.C:
+			s.reconcile(ctx)
+		}
+	}
+}
+
+// Reconciles all linked users and logs the summary
+func (s *Syncer) reconcile(ctx context.Context) {
+	summary, err := s.Reconcile(ctx)
+	if err != nil {
+		s.logger.Error("Error reconciling roles (%s): %v", summary, err)
+		return
+	}
+	s.logger.Info("Reconciled roles: %s", summary)
+}
+
+const defaultReconcileInterval = time.Hour
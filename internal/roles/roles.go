@@ -0,0 +1,445 @@
+package roles
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/devusSs/twitchspeak/internal/database"
+	"github.com/devusSs/twitchspeak/internal/eventsub"
+	"github.com/devusSs/twitchspeak/internal/helix"
+	"github.com/devusSs/twitchspeak/internal/teamspeak"
+	"github.com/devusSs/twitchspeak/pkg/log"
+)
+
+// Config for the role syncer
+type Config struct {
+	Helix *helix.Client
+	// Twitch user ID of the channel relationships are resolved for
+	BroadcasterID string
+	// Seeded into the database if it does not contain any rules yet
+	Rules []Rule
+	Bot   *teamspeak.Bot
+	DB    database.Service
+	// Only log changes of reconciliation runs without applying them
+	DryRun  bool
+	Console bool
+	Debug   bool
+}
+
+// Syncer maps Twitch relationships of linked users to TeamSpeak server groups
+type Syncer struct {
+	helix         *helix.Client
+	broadcasterID string
+
+	bot    *teamspeak.Bot
+	db     database.Service
+	dryRun bool
+	logger *log.Logger
+
+	mu    sync.RWMutex
+	rules []Rule
+	// Groups of deleted rules, still removed from users until a rule
+	// references them again, stored in the database to survive restarts
+	retired []int
+}
+
+// Changes applied to the server groups of a TeamSpeak client
+type Changes struct {
+	Added   []int
+	Removed []int
+}
+
+// Empty returns whether no changes were made
+func (c Changes) Empty() bool {
+	return len(c.Added) == 0 && len(c.Removed) == 0
+}
+
+// Resolve resolves the relationships of the given Twitch users
+// with the broadcaster, only queries what the rules require
+func (s *Syncer) Resolve(ctx context.Context, twitchIDs []string) (map[string]Status, error) {
+	statuses := make(map[string]Status, len(twitchIDs))
+	for _, id := range twitchIDs {
+		statuses[id] = Status{}
+	}
+
+	if s.needs(Subscriber, Tier1, Tier2, Tier3) {
+		tiers, err := s.helix.GetSubscriptions(ctx, s.broadcasterID, twitchIDs)
+		if err != nil {
+			return nil, err
+		}
+		for id, tier := range tiers {
+			status := statuses[id]
+			status.Tier = tier
+			statuses[id] = status
+		}
+	}
+
+	if s.needs(VIP) {
+		vips, err := s.helix.GetVIPs(ctx, s.broadcasterID, twitchIDs)
+		if err != nil {
+			return nil, err
+		}
+		for id := range vips {
+			status := statuses[id]
+			status.VIP = true
+			statuses[id] = status
+		}
+	}
+
+	if s.needs(Moderator) {
+		mods, err := s.helix.GetModerators(ctx, s.broadcasterID, twitchIDs)
+		if err != nil {
+			return nil, err
+		}
+		for id := range mods {
+			status := statuses[id]
+			status.Moderator = true
+			statuses[id] = status
+		}
+	}
+
+	if s.needs(Follower) {
+		// Helix only supports checking one follower per request
+		for _, id := range twitchIDs {
+			follower, err := s.helix.IsFollower(ctx, s.broadcasterID, id)
+			if err != nil {
+				return nil, err
+			}
+			status := statuses[id]
+			status.Follower = follower
+			statuses[id] = status
+		}
+	}
+
+	return statuses, nil
+}
+
+// Diff returns the changes needed to make the current server groups
+// of a client match the status, only considers groups managed by the rules
+func (s *Syncer) Diff(current []int, status Status) Changes {
+	var changes Changes
+
+	for _, group := range s.ManagedGroups() {
+		desired := s.desired(group, status)
+		member := slices.Contains(current, group)
+
+		if desired && !member {
+			changes.Added = append(changes.Added, group)
+		}
+		if !desired && member {
+			changes.Removed = append(changes.Removed, group)
+		}
+	}
+
+	return changes
+}
+
+// Apply applies the server groups matching the status
+// to the TeamSpeak client with the given unique identifier
+func (s *Syncer) Apply(uid string, status Status) (Changes, error) {
+	return s.apply(uid, status, false)
+}
+
+// Computes and (unless dryRun is set) applies the server group changes
+func (s *Syncer) apply(uid string, status Status, dryRun bool) (Changes, error) {
+	current, err := s.bot.ServerGroupsByUID(uid)
+	if err != nil {
+		return Changes{}, err
+	}
+
+	changes := s.Diff(current, status)
+	if dryRun {
+		return changes, nil
+	}
+
+	for _, group := range changes.Added {
+		if err := s.bot.AddServerGroup(uid, group); err != nil {
+			return changes, err
+		}
+	}
+
+	for _, group := range changes.Removed {
+		if err := s.bot.RemoveServerGroup(uid, group); err != nil {
+			return changes, err
+		}
+	}
+
+	return changes, nil
+}
+
+// SyncUser resolves the relationships of a linked user
+// and applies the matching server groups, revoked users lose all managed groups
+func (s *Syncer) SyncUser(ctx context.Context, user *database.User) (Changes, error) {
+	var status Status
+
+	// Revoked users lose all managed groups
+	if !user.Revoked() {
+		statuses, err := s.Resolve(ctx, []string{user.TwitchID})
+		if err != nil {
+			return Changes{}, fmt.Errorf("resolving status: %w", err)
+		}
+		status = statuses[user.TwitchID]
+	}
+
+	changes, err := s.Apply(user.TeamSpeakUID, status)
+	if err != nil {
+		return changes, fmt.Errorf("applying server groups: %w", err)
+	}
+
+	if !changes.Empty() {
+		s.logger.Info(
+			"Synced %s (Twitch %s): added %v, removed %v",
+			user.TeamSpeakUID,
+			user.TwitchID,
+			changes.Added,
+			changes.Removed,
+		)
+	}
+
+	return changes, nil
+}
+
+// ManagedGroups returns all server groups referenced by the rules
+// and groups of deleted rules
+func (s *Syncer) ManagedGroups() []int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	groups := ruleGroups(s.rules)
+	for _, group := range s.retired {
+		if !slices.Contains(groups, group) {
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
+
+// Rules returns the rules currently in use
+func (s *Syncer) Rules() []Rule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Clone(s.rules)
+}
+
+// Reload loads the rules from the database, has to be called after changing them
+//
+// Groups no longer referenced by any rule are retired and removed
+// from users on their next sync until a rule references them again
+func (s *Syncer) Reload() error {
+	stored, err := s.db.ListRoleRules()
+	if err != nil {
+		return fmt.Errorf("listing rules: %w", err)
+	}
+
+	storedRetired, err := s.db.ListRetiredGroups()
+	if err != nil {
+		return fmt.Errorf("listing retired groups: %w", err)
+	}
+
+	rules := make([]Rule, 0, len(stored))
+	for _, r := range stored {
+		rule, err := NewRule(r.Relationship, strconv.Itoa(r.ServerGroup))
+		if err != nil {
+			s.logger.Warn("Skipping rule %d: %v", r.ID, err)
+			continue
+		}
+		rules = append(rules, rule)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	groups := ruleGroups(rules)
+	candidates := append(append(slices.Clone(storedRetired), s.retired...), ruleGroups(s.rules)...)
+
+	var retired []int
+	for _, group := range candidates {
+		if !slices.Contains(groups, group) && !slices.Contains(retired, group) {
+			retired = append(retired, group)
+		}
+	}
+
+	if !slices.Equal(retired, storedRetired) {
+		if err := s.db.SetRetiredGroups(retired); err != nil {
+			return fmt.Errorf("storing retired groups: %w", err)
+		}
+	}
+
+	s.retired = retired
+	s.rules = rules
+
+	s.logger.Info("Loaded rules: %v, retired groups: %v", rules, retired)
+
+	return nil
+}
+
+// Stores the rules in the database unless it contains rules already
+func (s *Syncer) seed(rules []Rule) error {
+	stored, err := s.db.ListRoleRules()
+	if err != nil {
+		return fmt.Errorf("listing rules: %w", err)
+	}
+	if len(stored) > 0 {
+		return nil
+	}
+
+	for _, rule := range rules {
+		err := s.db.AddRoleRule(&database.RoleRule{
+			Relationship: string(rule.Relationship),
+			ServerGroup:  rule.ServerGroup,
+		})
+		if err != nil && !errors.Is(err, database.ErrAlreadyExists) {
+			return fmt.Errorf("adding rule %s: %w", rule, err)
+		}
+	}
+
+	if len(rules) > 0 {
+		s.logger.Info("Seeded database with rules: %v", rules)
+	}
+
+	return nil
+}
+
+// Returns the distinct server groups referenced by the rules
+func ruleGroups(rules []Rule) []int {
+	var groups []int
+	for _, rule := range rules {
+		if !slices.Contains(groups, rule.ServerGroup) {
+			groups = append(groups, rule.ServerGroup)
+		}
+	}
+	return groups
+}
+
+// RegisterCommands registers the sync related commands on the bot
+func (s *Syncer) RegisterCommands() error {
+	return s.bot.RegisterCommand(&teamspeak.Command{
+		Name:        "sync",
+		Description: "Updates your server groups based on your Twitch status",
+		LinkedOnly:  true,
+		Cooldown:    time.Minute,
+		Handler: func(ctx *teamspeak.CommandContext) error {
+			c, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			changes, err := s.SyncUser(c, ctx.User)
+			if err != nil {
+				return err
+			}
+
+			if changes.Empty() {
+				return ctx.Reply("Your server groups are up to date.")
+			}
+
+			return ctx.Reply("Your server groups have been updated.")
+		},
+	})
+}
+
+// HandleEvent syncs linked users once their relationship
+// with the broadcaster changes according to EventSub
+func (s *Syncer) HandleEvent(ctx context.Context, event eventsub.Event) {
+	var twitchID string
+	switch event := event.(type) {
+	case *eventsub.ChannelSubscribe:
+		twitchID = event.UserID
+	case *eventsub.ChannelSubscriptionEnd:
+		twitchID = event.UserID
+	case *eventsub.ChannelFollow:
+		twitchID = event.UserID
+	default:
+		return
+	}
+
+	user, err := s.db.GetUserByTwitchID(twitchID)
+	if errors.Is(err, database.ErrNotFound) {
+		return
+	}
+	if err != nil {
+		s.logger.Error("Error getting user %s: %v", twitchID, err)
+		return
+	}
+
+	if _, err := s.SyncUser(ctx, user); err != nil {
+		s.logger.Error("Error syncing %s after %s: %v", twitchID, event.SubscriptionType(), err)
+	}
+}
+
+// Whether a server group is desired for the status,
+// a group may be granted by multiple rules
+func (s *Syncer) desired(group int, status Status) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, rule := range s.rules {
+		if rule.ServerGroup == group && status.Has(rule.Relationship) {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether any rule requires one of the relationships
+func (s *Syncer) needs(rels ...Relationship) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, rule := range s.rules {
+		if slices.Contains(rels, rule.Relationship) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewSyncer creates a new role syncer
+func NewSyncer(cfg Config) (*Syncer, error) {
+	if cfg.Helix == nil {
+		return nil, fmt.Errorf("roles: helix client is nil")
+	}
+
+	if cfg.BroadcasterID == "" {
+		return nil, fmt.Errorf("roles: broadcaster id is empty")
+	}
+
+	if cfg.Bot == nil {
+		return nil, fmt.Errorf("roles: bot is nil")
+	}
+
+	if cfg.DB == nil {
+		return nil, fmt.Errorf("roles: database service is nil")
+	}
+
+	logger := log.NewLogger(
+		log.WithOwnLogFile("roles.log"),
+		log.WithName("roles"),
+		log.WithConsole(cfg.Console),
+		log.WithDebug(cfg.Debug),
+	)
+
+	s := &Syncer{
+		helix:         cfg.Helix,
+		broadcasterID: cfg.BroadcasterID,
+		bot:           cfg.Bot,
+		db:            cfg.DB,
+		dryRun:        cfg.DryRun,
+		logger:        logger,
+	}
+
+	if err := s.seed(cfg.Rules); err != nil {
+		return nil, fmt.Errorf("roles: %w", err)
+	}
+
+	if err := s.Reload(); err != nil {
+		return nil, fmt.Errorf("roles: %w", err)
+	}
+
+	s.logger.Info("Role syncer initialized")
+
+	return s, nil
+}
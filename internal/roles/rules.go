@@ -0,0 +1,129 @@
+package roles
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/devusSs/twitchspeak/internal/helix"
+)
+
+// Relationship is a relation between a Twitch user and the broadcaster
+type Relationship string
+
+// Supported relationships
+const (
+	Follower Relationship = "follower"
+	// Subscriber of any tier
+	Subscriber Relationship = "subscriber"
+	Tier1      Relationship = "tier1"
+	Tier2      Relationship = "tier2"
+	Tier3      Relationship = "tier3"
+	VIP        Relationship = "vip"
+	Moderator  Relationship = "moderator"
+)
+
+// Relationships lists all supported relationships
+var Relationships = []Relationship{
+	Follower,
+	Subscriber,
+	Tier1,
+	Tier2,
+	Tier3,
+	VIP,
+	Moderator,
+}
+
+// Rule maps a relationship to a TeamSpeak server group
+type Rule struct {
+	Relationship Relationship
+	ServerGroup  int
+}
+
+func (r Rule) String() string {
+	return fmt.Sprintf("%s=%d", r.Relationship, r.ServerGroup)
+}
+
+// ParseRules parses a comma separated list of rules
+// in the form of "relationship=server group ID",
+// e.g. "follower=10,tier2=12,vip=14"
+func ParseRules(s string) ([]Rule, error) {
+	var rules []Rule
+
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		rel, group, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("roles: invalid rule %q, expected relationship=group", part)
+		}
+
+		rule, err := NewRule(strings.TrimSpace(rel), strings.TrimSpace(group))
+		if err != nil {
+			return nil, err
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// NewRule validates and creates a rule
+func NewRule(relationship string, group string) (Rule, error) {
+	rel := Relationship(strings.ToLower(relationship))
+	if !rel.Valid() {
+		return Rule{}, fmt.Errorf("roles: unknown relationship %q", relationship)
+	}
+
+	id, err := strconv.Atoi(group)
+	if err != nil || id <= 0 {
+		return Rule{}, fmt.Errorf("roles: invalid server group %q", group)
+	}
+
+	return Rule{Relationship: rel, ServerGroup: id}, nil
+}
+
+// Valid returns whether the relationship is supported
+func (r Relationship) Valid() bool {
+	for _, rel := range Relationships {
+		if r == rel {
+			return true
+		}
+	}
+	return false
+}
+
+// Status describes the relationships of a Twitch user with the broadcaster
+type Status struct {
+	Follower bool `json:"follower"`
+	// Subscription tier as returned by Helix, empty if not subscribed
+	Tier      string `json:"tier"`
+	VIP       bool   `json:"vip"`
+	Moderator bool   `json:"moderator"`
+}
+
+// Has returns whether the status satisfies the relationship
+func (s Status) Has(rel Relationship) bool {
+	switch rel {
+	case Follower:
+		return s.Follower
+	case Subscriber:
+		return s.Tier != ""
+	case Tier1:
+		return s.Tier == helix.Tier1
+	case Tier2:
+		return s.Tier == helix.Tier2
+	case Tier3:
+		return s.Tier == helix.Tier3
+	case VIP:
+		return s.VIP
+	case Moderator:
+		return s.Moderator
+	default:
+		return false
+	}
+}
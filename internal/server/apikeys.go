@@ -0,0 +1,114 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	ratelimit "github.com/JGLTechnologies/gin-rate-limit"
+	"github.com/gin-gonic/gin"
+
+	"github.com/devusSs/twitchspeak/internal/auth/apikey"
+	"github.com/devusSs/twitchspeak/internal/database"
+	"github.com/devusSs/twitchspeak/internal/database/redis"
+	"github.com/devusSs/twitchspeak/internal/server/responses"
+	"github.com/devusSs/twitchspeak/internal/server/routes"
+)
+
+// Authenticates requests carrying an API key as bearer token,
+// failed attempts count towards the rate limit of the address
+// and valid keys are rate limited per key
+func (s *Server) apiKeys(
+	svc database.Service,
+	ipStore ratelimit.Store,
+	errorHandler func(*gin.Context, ratelimit.Info),
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, ok := bearerToken(c)
+		if !ok {
+			c.Next()
+			return
+		}
+
+		key, err := svc.GetAPIKeyByHash(apikey.Hash(token))
+		if err != nil && !errors.Is(err, database.ErrNotFound) {
+			s.logger.Error("Error getting API key: %v", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, responses.Error{
+				Code:         http.StatusInternalServerError,
+				ErrorCode:    responses.CodeInternalError,
+				ErrorMessage: responses.MessageInternalError,
+			})
+			return
+		}
+
+		if err != nil || !key.Active() {
+			if info := ipStore.Limit(c.ClientIP(), c); info.RateLimited {
+				errorHandler(c, info)
+				c.Abort()
+				return
+			}
+
+			c.AbortWithStatusJSON(http.StatusUnauthorized, responses.Error{
+				Code:         http.StatusUnauthorized,
+				ErrorCode:    "invalid_api_key",
+				ErrorMessage: "The API key is invalid, expired or revoked",
+			})
+			return
+		}
+
+		limit := key.RateLimit
+		if limit <= 0 {
+			limit = s.apiKeyRateLimit
+		}
+
+		info := s.keyStore(limit).Limit(fmt.Sprintf("apikey:%d", key.ID), c)
+		if info.RateLimited {
+			errorHandler(c, info)
+			c.Abort()
+			return
+		}
+
+		// Saves a write per request for busy keys
+		now := time.Now()
+		if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > lastUsedPrecision {
+			if err := svc.SetAPIKeyLastUsed(key.ID, now); err != nil {
+				s.logger.Error("Error updating last use of API key %d: %v", key.ID, err)
+			}
+		}
+
+		c.Set(routes.APIKeyKey, key)
+		c.Next()
+	}
+}
+
+// Returns the rate limit store allowing limit requests per minute
+func (s *Server) keyStore(limit int) ratelimit.Store {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	store, ok := s.keyStores[limit]
+	if !ok {
+		store = ratelimit.RedisStore(&ratelimit.RedisOptions{
+			RedisClient: redis.GetClient(),
+			Rate:        time.Minute,
+			Limit:       uint(max(limit, 1)),
+		})
+		s.keyStores[limit] = store
+	}
+
+	return store
+}
+
+// Returns the bearer token of the Authorization header
+func bearerToken(c *gin.Context) (string, bool) {
+	scheme, token, ok := strings.Cut(c.GetHeader("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+// API keys track their last use with this precision
+const lastUsedPrecision = time.Minute
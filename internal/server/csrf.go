@@ -0,0 +1,40 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/devusSs/twitchspeak/internal/server/responses"
+)
+
+// Rejects POST requests which are not sent as JSON to prevent cross-site request forgery
+//
+// Browsers send cross-site forms (and other simple requests) without a CORS preflight,
+// but those can not have the application/json content type. Other state changing
+// methods always require a preflight, which only allows the frontend.
+// Requests using API keys are exempt since browsers do not attach those on their own,
+// EventSub notifications are signed
+func requireJSON(c *gin.Context) {
+	if c.Request.Method != http.MethodPost {
+		c.Next()
+		return
+	}
+
+	if _, ok := bearerToken(c); ok || c.Request.URL.Path == EventSubPath {
+		c.Next()
+		return
+	}
+
+	// Strips parameters like charset
+	if c.ContentType() != gin.MIMEJSON {
+		c.AbortWithStatusJSON(http.StatusUnsupportedMediaType, responses.Error{
+			Code:         http.StatusUnsupportedMediaType,
+			ErrorCode:    "unsupported_media_type",
+			ErrorMessage: "Requests need to be sent with the content type application/json",
+		})
+		return
+	}
+
+	c.Next()
+}
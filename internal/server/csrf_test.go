@@ -0,0 +1,58 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequireJSON(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	engine := gin.New()
+	engine.Use(requireJSON)
+	engine.Any("/*path", func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		auth        string
+		want        int
+	}{
+		{"get", http.MethodGet, "/users/me", "", "", http.StatusNoContent},
+		{"json post", http.MethodPost, "/keys", "application/json", "", http.StatusNoContent},
+		{"json post with charset", http.MethodPost, "/keys", "application/json; charset=utf-8", "", http.StatusNoContent},
+		{"form post", http.MethodPost, "/admin/rules", "application/x-www-form-urlencoded", "", http.StatusUnsupportedMediaType},
+		{"text post", http.MethodPost, "/admin/links", "text/plain", "", http.StatusUnsupportedMediaType},
+		{"post without content type", http.MethodPost, "/admin/users/1/sync", "", "", http.StatusUnsupportedMediaType},
+		{"api key post", http.MethodPost, "/admin/users/1/sync", "", "Bearer tsk_key", http.StatusNoContent},
+		{"eventsub", http.MethodPost, EventSubPath, "text/plain", "", http.StatusNoContent},
+		{"delete", http.MethodDelete, "/keys/1", "", "", http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader("{}"))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+
+			rec := httptest.NewRecorder()
+			engine.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,443 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/devusSs/twitchspeak/internal/database"
+	"github.com/devusSs/twitchspeak/internal/links"
+	"github.com/devusSs/twitchspeak/internal/revoke"
+	"github.com/devusSs/twitchspeak/internal/roles"
+	"github.com/devusSs/twitchspeak/internal/server/responses"
+)
+
+// Need to be initialized for the admin routes
+var (
+	Revoker *revoke.Revoker = nil
+	// Optional, nil if role sync is disabled
+	Roles *roles.Syncer = nil
+)
+
+// ListUsersRoute handles requests to list and search linked users
+//
+// Supports the query parameters search, needs_reauth, seen_since (RFC 3339),
+// offset and limit (defaults to 50, at most 100)
+func ListUsersRoute(c *gin.Context) {
+	opts := database.ListOptions{
+		Search: strings.TrimSpace(c.Query("search")),
+		Limit:  defaultLimit,
+	}
+
+	var err error
+	if v := c.Query("offset"); v != "" {
+		opts.Offset, err = strconv.Atoi(v)
+		if err != nil || opts.Offset < 0 {
+			abort(c, http.StatusBadRequest, "invalid_offset", "Offset needs to be a positive number")
+			return
+		}
+	}
+
+	if v := c.Query("limit"); v != "" {
+		opts.Limit, err = strconv.Atoi(v)
+		if err != nil || opts.Limit <= 0 || opts.Limit > maxLimit {
+			abort(c, http.StatusBadRequest, "invalid_limit", fmt.Sprintf("Limit needs to be between 1 and %d", maxLimit))
+			return
+		}
+	}
+
+	if v := c.Query("needs_reauth"); v != "" {
+		needsReauth, err := strconv.ParseBool(v)
+		if err != nil {
+			abort(c, http.StatusBadRequest, "invalid_needs_reauth", "needs_reauth needs to be true or false")
+			return
+		}
+		opts.NeedsReauth = &needsReauth
+	}
+
+	if v := c.Query("seen_since"); v != "" {
+		opts.SeenSince, err = time.Parse(time.RFC3339, v)
+		if err != nil {
+			abort(c, http.StatusBadRequest, "invalid_seen_since", "seen_since needs to be a RFC 3339 timestamp")
+			return
+		}
+	}
+
+	users, total, err := Svc.ListUsers(opts)
+	if err != nil {
+		abortInternal(c)
+		return
+	}
+
+	resp := responses.Success{
+		Code: http.StatusOK,
+		Data: usersResponse{
+			Users:  nonNil(users),
+			Total:  total,
+			Offset: opts.Offset,
+			Limit:  opts.Limit,
+		},
+	}
+	c.JSON(resp.Code, resp)
+}
+
+// GetUserRoute handles requests to get a linked user by their Twitch ID
+func GetUserRoute(c *gin.Context) {
+	user, err := Svc.GetUserByTwitchID(c.Param("twitch_id"))
+	if errors.Is(err, database.ErrNotFound) {
+		abort(c, http.StatusNotFound, "not_linked", "The Twitch account is not connected to TeamSpeak")
+		return
+	}
+	if err != nil {
+		abortInternal(c)
+		return
+	}
+
+	resp := responses.Success{
+		Code: http.StatusOK,
+		Data: user,
+	}
+	c.JSON(resp.Code, resp)
+}
+
+// UnlinkUserRoute handles requests to force unlink a user,
+// their Twitch related server groups are removed
+func UnlinkUserRoute(c *gin.Context) {
+	user, err := Revoker.Unlink(c.Param("twitch_id"), revoke.SourceAdmin)
+	if errors.Is(err, database.ErrNotFound) {
+		abort(c, http.StatusNotFound, "not_linked", "The Twitch account is not connected to TeamSpeak")
+		return
+	}
+	if err != nil && user == nil {
+		abortInternal(c)
+		return
+	}
+
+	resp := responses.Success{
+		Code: http.StatusOK,
+		Data: user,
+	}
+	c.JSON(resp.Code, resp)
+}
+
+// SyncUserRoute handles requests to resync the server groups of a linked user
+func SyncUserRoute(c *gin.Context) {
+	if Roles == nil {
+		abort(c, http.StatusServiceUnavailable, "role_sync_disabled", "Role sync is not enabled")
+		return
+	}
+
+	user, err := Svc.GetUserByTwitchID(c.Param("twitch_id"))
+	if errors.Is(err, database.ErrNotFound) {
+		abort(c, http.StatusNotFound, "not_linked", "The Twitch account is not connected to TeamSpeak")
+		return
+	}
+	if err != nil {
+		abortInternal(c)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c, 30*time.Second)
+	defer cancel()
+
+	changes, err := Roles.SyncUser(ctx, user)
+	if err != nil {
+		abort(c, http.StatusBadGateway, "sync_failed", err.Error())
+		return
+	}
+
+	resp := responses.Success{
+		Code: http.StatusOK,
+		Data: syncResponse{
+			Added:   nonNil(changes.Added),
+			Removed: nonNil(changes.Removed),
+		},
+	}
+	c.JSON(resp.Code, resp)
+}
+
+// LinkUserRoute handles requests to manually link
+// a TeamSpeak identity to a Twitch account
+func LinkUserRoute(c *gin.Context) {
+	var req linkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abort(c, http.StatusBadRequest, "invalid_body", "Body needs to contain teamspeak_uid and twitch_id")
+		return
+	}
+
+	req.TeamSpeakUID = strings.TrimSpace(req.TeamSpeakUID)
+	req.TwitchID = strings.TrimSpace(req.TwitchID)
+	if req.TeamSpeakUID == "" || req.TwitchID == "" {
+		abort(c, http.StatusBadRequest, "invalid_body", "Body needs to contain teamspeak_uid and twitch_id")
+		return
+	}
+
+	user, err := links.Link(Svc, req.TeamSpeakUID, req.TwitchID)
+	if errors.Is(err, database.ErrAlreadyLinked) {
+		abort(c, http.StatusConflict, "already_linked", "The TeamSpeak identity or Twitch account is already connected")
+		return
+	}
+	if err != nil {
+		abortInternal(c)
+		return
+	}
+
+	audit(c, database.AuditLinked, user.TeamSpeakUID, user.TwitchID, "")
+
+	resp := responses.Success{
+		Code: http.StatusCreated,
+		Data: user,
+	}
+	c.JSON(resp.Code, resp)
+}
+
+// ListRulesRoute handles requests to list the role rules
+func ListRulesRoute(c *gin.Context) {
+	rules, err := Svc.ListRoleRules()
+	if err != nil {
+		abortInternal(c)
+		return
+	}
+
+	resp := responses.Success{
+		Code: http.StatusOK,
+		Data: nonNil(rules),
+	}
+	c.JSON(resp.Code, resp)
+}
+
+// CreateRuleRoute handles requests to create a role rule
+func CreateRuleRoute(c *gin.Context) {
+	rule, ok := bindRule(c)
+	if !ok {
+		return
+	}
+
+	err := Svc.AddRoleRule(rule)
+	if errors.Is(err, database.ErrAlreadyExists) {
+		abort(c, http.StatusConflict, "rule_exists", "The rule exists already")
+		return
+	}
+	if err != nil {
+		abortInternal(c)
+		return
+	}
+
+	audit(c, database.AuditRoleRuleAdded, "", "", ruleDetails(rule))
+
+	if !reloadRules(c) {
+		return
+	}
+
+	resp := responses.Success{
+		Code: http.StatusCreated,
+		Data: rule,
+	}
+	c.JSON(resp.Code, resp)
+}
+
+// UpdateRuleRoute handles requests to update a role rule
+func UpdateRuleRoute(c *gin.Context) {
+	id, ok := ruleID(c)
+	if !ok {
+		return
+	}
+
+	rule, ok := bindRule(c)
+	if !ok {
+		return
+	}
+	rule.ID = id
+
+	err := Svc.UpdateRoleRule(rule)
+	if errors.Is(err, database.ErrNotFound) {
+		abort(c, http.StatusNotFound, "not_found", "The rule does not exist")
+		return
+	}
+	if errors.Is(err, database.ErrAlreadyExists) {
+		abort(c, http.StatusConflict, "rule_exists", "The rule exists already")
+		return
+	}
+	if err != nil {
+		abortInternal(c)
+		return
+	}
+
+	rule, err = Svc.GetRoleRule(id)
+	if err != nil {
+		abortInternal(c)
+		return
+	}
+
+	audit(c, database.AuditRoleRuleUpdated, "", "", ruleDetails(rule))
+
+	if !reloadRules(c) {
+		return
+	}
+
+	resp := responses.Success{
+		Code: http.StatusOK,
+		Data: rule,
+	}
+	c.JSON(resp.Code, resp)
+}
+
+// DeleteRuleRoute handles requests to delete a role rule
+func DeleteRuleRoute(c *gin.Context) {
+	id, ok := ruleID(c)
+	if !ok {
+		return
+	}
+
+	rule, err := Svc.GetRoleRule(id)
+	if errors.Is(err, database.ErrNotFound) {
+		abort(c, http.StatusNotFound, "not_found", "The rule does not exist")
+		return
+	}
+	if err != nil {
+		abortInternal(c)
+		return
+	}
+
+	err = Svc.DeleteRoleRule(id)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		abortInternal(c)
+		return
+	}
+
+	audit(c, database.AuditRoleRuleDeleted, "", "", ruleDetails(rule))
+
+	if !reloadRules(c) {
+		return
+	}
+
+	resp := responses.Success{
+		Code: http.StatusOK,
+		Data: rule,
+	}
+	c.JSON(resp.Code, resp)
+}
+
+// Parses and validates the rule in the request body
+func bindRule(c *gin.Context) (*database.RoleRule, bool) {
+	var req ruleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abort(c, http.StatusBadRequest, "invalid_body", "Body needs to contain relationship and server_group")
+		return nil, false
+	}
+
+	rule, err := roles.NewRule(req.Relationship, strconv.Itoa(req.ServerGroup))
+	if err != nil {
+		abort(c, http.StatusBadRequest, "invalid_rule", strings.TrimPrefix(err.Error(), "roles: "))
+		return nil, false
+	}
+
+	return &database.RoleRule{
+		Relationship: string(rule.Relationship),
+		ServerGroup:  rule.ServerGroup,
+	}, true
+}
+
+// Parses the rule ID path parameter
+func ruleID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 0)
+	if err != nil || id == 0 {
+		abort(c, http.StatusBadRequest, "invalid_id", "The rule ID needs to be a positive number")
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// Applies changed rules to the role syncer if it is enabled
+func reloadRules(c *gin.Context) bool {
+	if Roles == nil {
+		return true
+	}
+
+	if err := Roles.Reload(); err != nil {
+		abortInternal(c)
+		return false
+	}
+
+	// New groups need to be removed on revocation too
+	Revoker.AddGroups(Roles.ManagedGroups()...)
+
+	return true
+}
+
+func ruleDetails(rule *database.RoleRule) string {
+	return fmt.Sprintf("rule %d: %s=%d", rule.ID, rule.Relationship, rule.ServerGroup)
+}
+
+// Records an audit event for an admin route, audit events are best effort
+func audit(c *gin.Context, action string, teamSpeakUID string, twitchID string, details string) {
+	if details != "" {
+		details += ", "
+	}
+	details += fmt.Sprintf("by %s %s", c.GetString(roleKey), c.GetString(callerKey))
+	if key, ok := apiKey(c); ok {
+		details += fmt.Sprintf(" via API key %d (%s)", key.ID, key.Prefix)
+	}
+
+	_ = Svc.AddAuditEvent(&database.AuditEvent{
+		Action:       action,
+		TeamSpeakUID: teamSpeakUID,
+		TwitchID:     twitchID,
+		Source:       revoke.SourceAdmin,
+		Details:      details,
+	})
+}
+
+func abort(c *gin.Context, code int, errCode string, msg string) {
+	resp := responses.Error{
+		Code:         code,
+		ErrorCode:    errCode,
+		ErrorMessage: msg,
+	}
+	c.AbortWithStatusJSON(resp.Code, resp)
+}
+
+func abortInternal(c *gin.Context) {
+	abort(c, http.StatusInternalServerError, responses.CodeInternalError, responses.MessageInternalError)
+}
+
+// Returns an empty slice instead of nil so lists are encoded as []
+func nonNil[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+	return s
+}
+
+type usersResponse struct {
+	Users  []*database.User `json:"users"`
+	Total  int64            `json:"total"`
+	Offset int              `json:"offset"`
+	Limit  int              `json:"limit"`
+}
+
+type syncResponse struct {
+	Added   []int `json:"added"`
+	Removed []int `json:"removed"`
+}
+
+type linkRequest struct {
+	TeamSpeakUID string `json:"teamspeak_uid"`
+	TwitchID     string `json:"twitch_id"`
+}
+
+type ruleRequest struct {
+	Relationship string `json:"relationship"`
+	ServerGroup  int    `json:"server_group"`
+}
+
+const (
+	defaultLimit = 50
+	maxLimit     = 100
+)
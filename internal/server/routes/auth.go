@@ -0,0 +1,87 @@
+package routes
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+
+	"github.com/devusSs/twitchspeak/internal/access"
+	"github.com/devusSs/twitchspeak/internal/database"
+)
+
+// APIKeyKey is the context key of the API key the request
+// was authenticated with, set by the API key middleware
+const APIKeyKey = "api_key"
+
+// Optional, every logged in user is a viewer if nil
+var Access *access.Resolver = nil
+
+// Require returns a middleware aborting requests of users who are not
+// logged in or whose role lacks the permission, requests authenticated
+// via API key additionally need the permission in the key's scopes
+func Require(perm access.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key, viaKey := apiKey(c)
+
+		var twitchID string
+		if viaKey {
+			twitchID = key.TwitchID
+		} else {
+			id, ok := sessions.Default(c).Get("twitch_id").(string)
+			if !ok {
+				abort(c, http.StatusUnauthorized, "unauthorized", "You are not authorized to access this resource")
+				return
+			}
+			twitchID = id
+		}
+
+		role := access.Viewer
+		if Access != nil {
+			role = Access.Resolve(c, twitchID)
+		}
+
+		// Keys never grant more than their creator currently has
+		if !role.Can(perm) || (viaKey && !keyCan(key, perm)) {
+			abort(c, http.StatusForbidden, "forbidden", "You are not allowed to access this resource")
+			return
+		}
+
+		c.Set(callerKey, twitchID)
+		c.Set(roleKey, string(role))
+		c.Next()
+	}
+}
+
+// RequireSession aborts requests authenticated via API key,
+// used for routes managing API keys so keys can not create keys
+func RequireSession(c *gin.Context) {
+	if _, ok := apiKey(c); ok {
+		abort(c, http.StatusForbidden, "session_required", "This resource can not be accessed using an API key")
+		return
+	}
+	c.Next()
+}
+
+// Returns the API key the request was authenticated with
+func apiKey(c *gin.Context) (*database.APIKey, bool) {
+	v, ok := c.Get(APIKeyKey)
+	if !ok {
+		return nil, false
+	}
+	key, ok := v.(*database.APIKey)
+	return key, ok
+}
+
+// Whether the scopes of the key include the permission
+func keyCan(key *database.APIKey, perm access.Permission) bool {
+	scopes, err := access.ParsePermissions(key.Scopes)
+	return err == nil && slices.Contains(scopes, perm)
+}
+
+const (
+	// Context keys of the Twitch ID and role of the caller
+	callerKey = "caller_twitch_id"
+	roleKey   = "caller_role"
+)
@@ -0,0 +1,204 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/devusSs/twitchspeak/internal/access"
+	"github.com/devusSs/twitchspeak/internal/auth/apikey"
+	"github.com/devusSs/twitchspeak/internal/database"
+	"github.com/devusSs/twitchspeak/internal/server/responses"
+)
+
+// Default and maximum requests per minute of API keys, needs to be initialized
+var APIKeyRateLimit = 0
+
+// ListKeysRoute handles requests to list the API keys of the logged in user
+func ListKeysRoute(c *gin.Context) {
+	keys, err := Svc.ListAPIKeys(c.GetString(callerKey))
+	if err != nil {
+		abortInternal(c)
+		return
+	}
+
+	data := make([]keyResponse, 0, len(keys))
+	for _, key := range keys {
+		data = append(data, newKeyResponse(key))
+	}
+
+	resp := responses.Success{
+		Code: http.StatusOK,
+		Data: data,
+	}
+	c.JSON(resp.Code, resp)
+}
+
+// CreateKeyRoute handles requests to create an API key for the logged in user,
+// the key is only returned once
+func CreateKeyRoute(c *gin.Context) {
+	var req keyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abort(c, http.StatusBadRequest, "invalid_body", "Body needs to contain name and scopes")
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > maxKeyNameLength {
+		abort(c, http.StatusBadRequest, "invalid_name", fmt.Sprintf("Name needs to have 1 to %d characters", maxKeyNameLength))
+		return
+	}
+
+	scopes, err := access.ParsePermissions(strings.Join(req.Scopes, ","))
+	if err != nil || len(scopes) == 0 {
+		abort(c, http.StatusBadRequest, "invalid_scopes", "Scopes need to be a non-empty list of permissions")
+		return
+	}
+
+	role := access.Role(c.GetString(roleKey))
+	for _, scope := range scopes {
+		if !role.Can(scope) {
+			abort(c, http.StatusForbidden, "forbidden_scope", fmt.Sprintf("You do not have the permission %s", scope))
+			return
+		}
+	}
+
+	if req.RateLimit < 0 || req.RateLimit > APIKeyRateLimit {
+		abort(c, http.StatusBadRequest, "invalid_rate_limit", fmt.Sprintf("Rate limit needs to be between 0 and %d", APIKeyRateLimit))
+		return
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresIn < 0 {
+		abort(c, http.StatusBadRequest, "invalid_expires_in", "expires_in needs to be a positive number of seconds")
+		return
+	}
+	if req.ExpiresIn > 0 {
+		t := time.Now().Add(time.Duration(req.ExpiresIn) * time.Second)
+		expiresAt = &t
+	}
+
+	plain, prefix, hash, err := apikey.Generate()
+	if err != nil {
+		abortInternal(c)
+		return
+	}
+
+	parts := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		parts = append(parts, string(scope))
+	}
+
+	key := &database.APIKey{
+		Name:      req.Name,
+		Prefix:    prefix,
+		Hash:      hash,
+		TwitchID:  c.GetString(callerKey),
+		Scopes:    strings.Join(parts, ","),
+		RateLimit: req.RateLimit,
+		ExpiresAt: expiresAt,
+	}
+
+	if err := Svc.AddAPIKey(key); err != nil {
+		abortInternal(c)
+		return
+	}
+
+	audit(c, database.AuditAPIKeyCreated, "", key.TwitchID, fmt.Sprintf("key %d (%s), scopes: %s", key.ID, key.Prefix, key.Scopes))
+
+	data := newKeyResponse(key)
+	data.Key = plain
+
+	resp := responses.Success{
+		Code: http.StatusCreated,
+		Data: data,
+	}
+	c.JSON(resp.Code, resp)
+}
+
+// RevokeKeyRoute handles requests to revoke an API key of the logged in user
+func RevokeKeyRoute(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 0)
+	if err != nil || id == 0 {
+		abort(c, http.StatusBadRequest, "invalid_id", "The key ID needs to be a positive number")
+		return
+	}
+
+	key, err := Svc.GetAPIKey(uint(id))
+	if errors.Is(err, database.ErrNotFound) || (err == nil && key.TwitchID != c.GetString(callerKey)) {
+		abort(c, http.StatusNotFound, "not_found", "The key does not exist")
+		return
+	}
+	if err != nil {
+		abortInternal(c)
+		return
+	}
+
+	err = Svc.RevokeAPIKey(key.ID)
+	if errors.Is(err, database.ErrNotFound) {
+		abort(c, http.StatusConflict, "already_revoked", "The key is revoked already")
+		return
+	}
+	if err != nil {
+		abortInternal(c)
+		return
+	}
+
+	audit(c, database.AuditAPIKeyRevoked, "", key.TwitchID, fmt.Sprintf("key %d (%s)", key.ID, key.Prefix))
+
+	key, err = Svc.GetAPIKey(key.ID)
+	if err != nil {
+		abortInternal(c)
+		return
+	}
+
+	resp := responses.Success{
+		Code: http.StatusOK,
+		Data: newKeyResponse(key),
+	}
+	c.JSON(resp.Code, resp)
+}
+
+func newKeyResponse(key *database.APIKey) keyResponse {
+	scopes := []string{}
+	if key.Scopes != "" {
+		scopes = strings.Split(key.Scopes, ",")
+	}
+
+	rateLimit := key.RateLimit
+	if rateLimit == 0 {
+		rateLimit = APIKeyRateLimit
+	}
+
+	return keyResponse{
+		APIKey:    key,
+		Scopes:    scopes,
+		RateLimit: rateLimit,
+	}
+}
+
+type keyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// Requests per minute, 0 for the default
+	RateLimit int `json:"rate_limit"`
+	// Seconds until the key expires, 0 for never
+	ExpiresIn int `json:"expires_in"`
+}
+
+type keyResponse struct {
+	*database.APIKey
+	Scopes []string `json:"scopes"`
+	// Effective requests per minute
+	RateLimit int `json:"rate_limit"`
+	// Only set once after creating the key
+	Key string `json:"key,omitempty"`
+}
+
+// Keys show up in the audit log and responses
+const maxKeyNameLength = 64
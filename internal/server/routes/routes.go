@@ -1,14 +1,19 @@
 package routes
 
 import (
+	"errors"
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 
+	"github.com/devusSs/twitchspeak/internal/access"
 	"github.com/devusSs/twitchspeak/internal/database"
+	"github.com/devusSs/twitchspeak/internal/grants"
+	"github.com/devusSs/twitchspeak/internal/links"
 	"github.com/devusSs/twitchspeak/internal/server/responses"
 )
 
@@ -17,6 +22,9 @@ var (
 	Svc database.Service = nil
 )
 
+// Whether session cookies may only be sent via https, needs to be initialized
+var SecureCookies = false
+
 // NoRoute handles requests with invalid routes
 func NoRoute(c *gin.Context) {
 	resp := responses.Error{
@@ -85,7 +93,7 @@ func LogoutRoute(c *gin.Context) {
 			1,
 		),
 		MaxAge:   -1,
-		Secure:   strings.Contains(u.String(), "https://"),
+		Secure:   SecureCookies,
 		HttpOnly: true,
 		SameSite: http.SameSiteStrictMode,
 	})
@@ -107,22 +115,55 @@ func LogoutRoute(c *gin.Context) {
 	c.JSON(resp.Code, resp)
 }
 
-// GetMeRoute handles requests to the get me route
+// GetMeRoute handles requests to the get me route,
+// requires the self permission
 func GetMeRoute(c *gin.Context) {
-	session := sessions.Default(c)
-	twitchID := session.Get("twitch_id")
+	twitchID := c.GetString(callerKey)
 
-	if twitchID == nil {
+	// Callers without a linked TeamSpeak identity (e.g. allowlisted admins)
+	// still get their role and permissions
+	user, err := Svc.GetUserByTwitchID(twitchID)
+	if errors.Is(err, database.ErrNotFound) {
+		user, err = nil, nil
+	}
+	if err != nil {
 		resp := responses.Error{
-			Code:         http.StatusUnauthorized,
-			ErrorCode:    "unauthorized",
-			ErrorMessage: "You are not authorized to access this resource",
+			Code:         http.StatusInternalServerError,
+			ErrorCode:    responses.CodeInternalError,
+			ErrorMessage: responses.MessageInternalError,
 		}
 		c.JSON(resp.Code, resp)
 		return
 	}
 
-	user, err := Svc.GetUserByTwitchID(twitchID.(string))
+	role := access.Role(c.GetString(roleKey))
+	data := meResponse{
+		User:        user,
+		Role:        role,
+		Permissions: role.Permissions(),
+	}
+
+	resp := responses.Success{
+		Code: http.StatusOK,
+		Data: data,
+	}
+	c.JSON(resp.Code, resp)
+}
+
+// The linked user (nil if not linked) along with
+// their effective role and permissions on the API
+type meResponse struct {
+	User        *database.User      `json:"user"`
+	Role        access.Role         `json:"role,omitempty"`
+	Permissions []access.Permission `json:"permissions,omitempty"`
+}
+
+// GetMyGrantsRoute handles requests to list the active temporary
+// server groups of the logged in user, requires the self permission
+func GetMyGrantsRoute(c *gin.Context) {
+	twitchID := c.GetString(callerKey)
+
+	active, err := Svc.ListActiveGrants(twitchID)
 	if err != nil {
 		resp := responses.Error{
 			Code:         http.StatusInternalServerError,
@@ -133,9 +174,80 @@ func GetMeRoute(c *gin.Context) {
 		return
 	}
 
+	data := make([]grantResponse, 0, len(active))
+	for _, grant := range active {
+		data = append(data, grantResponse{
+			ServerGroup: grant.ServerGroup,
+			Source:      grant.Source,
+			ExpiresAt:   grant.ExpiresAt,
+			ExpiresIn:   int(grants.Remaining(grant).Seconds()),
+		})
+	}
+
 	resp := responses.Success{
 		Code: http.StatusOK,
-		Data: user,
+		Data: data,
+	}
+	c.JSON(resp.Code, resp)
+}
+
+type grantResponse struct {
+	ServerGroup int       `json:"server_group"`
+	Source      string    `json:"source"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	// Seconds until the grant expires
+	ExpiresIn int `json:"expires_in"`
+}
+
+// CreateLinkCodeRoute handles requests to create a link code
+// which can be redeemed in TeamSpeak using the !link command,
+// requires the self permission
+func CreateLinkCodeRoute(c *gin.Context) {
+	twitchID := c.GetString(callerKey)
+
+	_, err := Svc.GetUserByTwitchID(twitchID)
+	if err == nil {
+		resp := responses.Error{
+			Code:         http.StatusConflict,
+			ErrorCode:    "already_linked",
+			ErrorMessage: "Your Twitch account is already connected to TeamSpeak",
+		}
+		c.JSON(resp.Code, resp)
+		return
+	}
+	if !errors.Is(err, database.ErrNotFound) {
+		resp := responses.Error{
+			Code:         http.StatusInternalServerError,
+			ErrorCode:    responses.CodeInternalError,
+			ErrorMessage: responses.MessageInternalError,
+		}
+		c.JSON(resp.Code, resp)
+		return
+	}
+
+	code, ttl, err := links.IssueCode(c, twitchID)
+	if err != nil {
+		resp := responses.Error{
+			Code:         http.StatusInternalServerError,
+			ErrorCode:    responses.CodeInternalError,
+			ErrorMessage: responses.MessageInternalError,
+		}
+		c.JSON(resp.Code, resp)
+		return
+	}
+
+	resp := responses.Success{
+		Code: http.StatusCreated,
+		Data: linkCodeResponse{
+			Code:      code,
+			ExpiresIn: int(ttl.Seconds()),
+		},
 	}
 	c.JSON(resp.Code, resp)
 }
+
+type linkCodeResponse struct {
+	Code string `json:"code"`
+	// Seconds until the code expires
+	ExpiresIn int `json:"expires_in"`
+}
@@ -15,9 +15,13 @@ import (
 	"github.com/gin-contrib/sessions/postgres"
 	"github.com/gin-gonic/gin"
 
+	"github.com/devusSs/twitchspeak/internal/access"
 	"github.com/devusSs/twitchspeak/internal/auth/twitch"
 	"github.com/devusSs/twitchspeak/internal/database"
 	"github.com/devusSs/twitchspeak/internal/database/redis"
+	"github.com/devusSs/twitchspeak/internal/eventsub"
+	"github.com/devusSs/twitchspeak/internal/revoke"
+	"github.com/devusSs/twitchspeak/internal/roles"
 	"github.com/devusSs/twitchspeak/internal/server/responses"
 	"github.com/devusSs/twitchspeak/internal/server/routes"
 	"github.com/devusSs/twitchspeak/pkg/log"
@@ -28,13 +32,28 @@ var (
 	ErrorCritical = fmt.Errorf("critical error")
 )
 
+// EventSubPath is the path EventSub notifications are received on
+const EventSubPath = "/eventsub"
+
+// Sessions of users who did not log in yet, e.g. during the login flow
+const sessionMaxAge = 86400 * 7
+
 // Config for the http server
 type Config struct {
 	Port        uint
 	BackendURL  string
 	FrontendURL string
-	Console     bool
-	Debug       bool
+	// Optional, receives EventSub notifications on EventSubPath
+	EventSub *eventsub.Receiver
+	// Resolves roles for the admin routes and /users/me
+	Access  *access.Resolver
+	Revoker *revoke.Revoker
+	// Optional, allows syncing single users via the admin routes
+	Roles *roles.Syncer
+	// Default and maximum requests per minute of API keys
+	APIKeyRateLimit int
+	Console         bool
+	Debug           bool
 }
 
 // Server is the main struct for the http server
@@ -45,20 +64,30 @@ type Server struct {
 	backendURL string
 	// Host (host:port) of the frontend server (for cors purposes)
 	frontendURl string
+	eventSub    *eventsub.Receiver
+	access      *access.Resolver
+	revoker     *revoke.Revoker
+	roles       *roles.Syncer
+	// Default and maximum requests per minute of API keys
+	apiKeyRateLimit int
 
 	logger *log.Logger
 	engine *gin.Engine
+
+	mu sync.Mutex
+	// Redis rate limit stores by requests per minute
+	keyStores map[int]ratelimit.Store
 }
 
 // Applies middlewares to the gin engine
-// like recovery, custom logging, cors, rate limiting and sessions
+// like recovery, custom logging, cors, rate limiting, API keys and sessions
 func (s *Server) ApplyMiddlewares(svc database.Service, secretKey string) error {
 	s.engine.Use(gin.Recovery())
 	s.engine.Use(s.customLogger())
 	s.engine.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{s.frontendURl},
-		AllowMethods:     []string{http.MethodGet, http.MethodPatch},
-		AllowHeaders:     []string{"Origin"},
+		AllowMethods:     []string{http.MethodGet, http.MethodPost, http.MethodPatch, http.MethodDelete},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
 		ExposeHeaders:    []string{"Content-Length"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
@@ -90,7 +119,18 @@ func (s *Server) ApplyMiddlewares(svc database.Service, secretKey string) error
 		KeyFunc:      keyFunc,
 	})
 
-	s.engine.Use(mw)
+	// Twitch may deliver many notifications at once from the same addresses,
+	// requests using API keys are limited per key instead
+	s.engine.Use(func(c *gin.Context) {
+		if _, ok := bearerToken(c); ok || c.Request.URL.Path == EventSubPath {
+			c.Next()
+			return
+		}
+		mw(c)
+	})
+
+	s.engine.Use(s.apiKeys(svc, rStore, errorHandler))
+	s.engine.Use(requireJSON)
 
 	db, err := svc.GetDB()
 	if err != nil {
@@ -102,6 +142,16 @@ func (s *Server) ApplyMiddlewares(svc database.Service, secretKey string) error
 		return fmt.Errorf("could not create postgres store: %v", err)
 	}
 
+	// Lax still sends the cookie when Twitch redirects back to us after logging in,
+	// the session of logged in users is restricted further (see twitch.HandleRedirectRoute)
+	store.Options(sessions.Options{
+		Path:     "/",
+		MaxAge:   sessionMaxAge,
+		Secure:   s.secureCookies(),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
 	s.engine.Use(sessions.Sessions("twitchspeak", store))
 
 	s.logger.Info("Applied middlewares successfully")
@@ -116,6 +166,11 @@ func (s *Server) SetupRoutes(twitchRedirectURI string, svc database.Service) err
 	}
 
 	routes.Svc = svc
+	routes.Access = s.access
+	routes.Revoker = s.revoker
+	routes.Roles = s.roles
+	routes.APIKeyRateLimit = s.apiKeyRateLimit
+	routes.SecureCookies = s.secureCookies()
 
 	u, err := url.Parse(twitchRedirectURI)
 	if err != nil {
@@ -143,9 +198,41 @@ func (s *Server) SetupRoutes(twitchRedirectURI string, svc database.Service) err
 			auth.GET("/logout", routes.LogoutRoute)
 		}
 
-		users := base.Group("/users")
+		users := base.Group("/users", routes.Require(access.PermSelf))
 		{
 			users.GET("/me", routes.GetMeRoute)
+			users.GET("/me/grants", routes.GetMyGrantsRoute)
+		}
+
+		links := base.Group("/links", routes.Require(access.PermSelf))
+		{
+			links.POST("/code", routes.CreateLinkCodeRoute)
+		}
+
+		keys := base.Group("/keys", routes.RequireSession, routes.Require(access.PermSelf))
+		{
+			keys.GET("", routes.ListKeysRoute)
+			keys.POST("", routes.CreateKeyRoute)
+			keys.DELETE("/:id", routes.RevokeKeyRoute)
+		}
+
+		if s.access != nil && s.revoker != nil {
+			admin := base.Group("/admin")
+			{
+				admin.GET("/users", routes.Require(access.PermUsersRead), routes.ListUsersRoute)
+				admin.GET("/users/:twitch_id", routes.Require(access.PermUsersRead), routes.GetUserRoute)
+				admin.DELETE("/users/:twitch_id", routes.Require(access.PermUsersUnlink), routes.UnlinkUserRoute)
+				admin.POST("/users/:twitch_id/sync", routes.Require(access.PermUsersSync), routes.SyncUserRoute)
+				admin.POST("/links", routes.Require(access.PermLinksWrite), routes.LinkUserRoute)
+				admin.GET("/rules", routes.Require(access.PermRulesRead), routes.ListRulesRoute)
+				admin.POST("/rules", routes.Require(access.PermRulesWrite), routes.CreateRuleRoute)
+				admin.PATCH("/rules/:id", routes.Require(access.PermRulesWrite), routes.UpdateRuleRoute)
+				admin.DELETE("/rules/:id", routes.Require(access.PermRulesWrite), routes.DeleteRuleRoute)
+			}
+		}
+
+		if s.eventSub != nil {
+			base.POST(EventSubPath, s.eventSub.HandleWebhook)
 		}
 	}
 
@@ -154,6 +241,12 @@ func (s *Server) SetupRoutes(twitchRedirectURI string, svc database.Service) err
 	return nil
 }
 
+// Returns whether session cookies may only be sent via https,
+// which is the case if the backend is served via https
+func (s *Server) secureCookies() bool {
+	return strings.HasPrefix(s.backendURL, "https://")
+}
+
 // Start starts the server and listens for incoming requests
 //
 // Blocks until the context is canceled or a critical error occurs
@@ -234,8 +327,15 @@ func NewServer(cfg Config) *Server {
 		port:        cfg.Port,
 		backendURL:  cfg.BackendURL,
 		frontendURl: cfg.FrontendURL,
+		eventSub:    cfg.EventSub,
+		access:      cfg.Access,
+		revoker:     cfg.Revoker,
+		roles:       cfg.Roles,
 		logger:      logger,
 		engine:      engine,
+
+		apiKeyRateLimit: cfg.APIKeyRateLimit,
+		keyStores:       make(map[int]ratelimit.Store),
 	}
 
 	s.logger.Info("Server initialized successfully")
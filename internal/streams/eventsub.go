@@ -0,0 +1,152 @@
+package streams
+
+import (
+	"context"
+	"time"
+
+	"github.com/devusSs/twitchspeak/internal/eventsub"
+	"github.com/devusSs/twitchspeak/internal/helix"
+	"github.com/devusSs/twitchspeak/pkg/log"
+)
+
+// EventSubSource is a Source receiving stream.online and stream.offline
+// notifications via EventSub instead of polling every channel
+type EventSubSource struct {
+	receiver *eventsub.Receiver
+	manager  *eventsub.Manager
+	helix    *helix.Client
+	// Interval the watched channels are refreshed in
+	interval time.Duration
+	logger   *log.Logger
+}
+
+// Run implements Source
+//
+// Polls Helix once on start to report the initial state,
+// afterwards keeps the subscriptions in line with the watched channels
+func (e *EventSubSource) Run(ctx context.Context, channels ChannelsFunc, h Handler) error {
+	e.receiver.OnEvent(func(ctx context.Context, event eventsub.Event) {
+		switch event := event.(type) {
+		case *eventsub.StreamOnline:
+			e.online(ctx, event, h)
+		case *eventsub.StreamOffline:
+			h.Offline(ctx, event.BroadcasterUserID)
+		}
+	})
+
+	initial := NewPollingSource(e.helix, e.interval, e.logger)
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	// Watched user IDs with subscriptions, nil until the first successful refresh
+	var watched map[string]bool
+
+	for {
+		ids, err := channels(ctx)
+		if err != nil {
+			e.logger.Error("Error getting watched channels: %v", err)
+		} else {
+			if watched == nil {
+				e.report(ctx, initial, ids, h)
+			}
+			watched = e.subscribe(ctx, watched, ids)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Reports the current state of all channels
+func (e *EventSubSource) report(ctx context.Context, p *PollingSource, ids []string, h Handler) {
+	current, _, err := p.poll(ctx, func(context.Context) ([]string, error) { return ids, nil })
+	if err != nil {
+		e.logger.Error("Error polling initial streams: %v", err)
+		return
+	}
+
+	for _, id := range ids {
+		if stream, ok := current[id]; ok {
+			h.Online(ctx, stream)
+		} else {
+			h.Offline(ctx, id)
+		}
+	}
+}
+
+// Updates the desired subscriptions to match ids and reconciles them if needed,
+// returns the new set of watched user IDs
+func (e *EventSubSource) subscribe(ctx context.Context, watched map[string]bool, ids []string) map[string]bool {
+	next := make(map[string]bool, len(ids))
+	changed := false
+
+	for _, id := range ids {
+		next[id] = true
+		if !watched[id] {
+			e.manager.Add(eventsub.StreamSpecs(id)...)
+			changed = true
+		}
+	}
+
+	for id := range watched {
+		if !next[id] {
+			e.manager.Remove(eventsub.StreamSpecs(id)...)
+			changed = true
+		}
+	}
+
+	if changed {
+		if err := e.manager.Reconcile(ctx); err != nil {
+			e.logger.Error("Error reconciling stream subscriptions: %v", err)
+		}
+	}
+
+	return next
+}
+
+// Resolves title and game of the stream which are not part of the notification
+func (e *EventSubSource) online(ctx context.Context, event *eventsub.StreamOnline, h Handler) {
+	stream := Stream{
+		ID:        event.ID,
+		UserID:    event.BroadcasterUserID,
+		UserLogin: event.BroadcasterUserLogin,
+		UserName:  event.BroadcasterUserName,
+		StartedAt: event.StartedAt,
+	}
+
+	streams, err := e.helix.GetStreams(ctx, []string{event.BroadcasterUserID})
+	if err != nil {
+		e.logger.Warn("Error getting stream of %s: %v", event.BroadcasterUserLogin, err)
+	} else if len(streams) > 0 {
+		stream.Title = streams[0].Title
+		stream.Game = streams[0].GameName
+	}
+
+	h.Online(ctx, stream)
+}
+
+// NewEventSubSource creates a new Source based on EventSub,
+// watched channels are refreshed every interval
+func NewEventSubSource(
+	receiver *eventsub.Receiver,
+	manager *eventsub.Manager,
+	client *helix.Client,
+	interval time.Duration,
+	logger *log.Logger,
+) *EventSubSource {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	return &EventSubSource{
+		receiver: receiver,
+		manager:  manager,
+		helix:    client,
+		interval: interval,
+		logger:   logger,
+	}
+}
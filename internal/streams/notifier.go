@@ -0,0 +1,341 @@
+package streams
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/devusSs/twitchspeak/internal/database"
+	"github.com/devusSs/twitchspeak/internal/database/redis"
+	"github.com/devusSs/twitchspeak/internal/eventsub"
+	"github.com/devusSs/twitchspeak/internal/helix"
+	"github.com/devusSs/twitchspeak/internal/teamspeak"
+	"github.com/devusSs/twitchspeak/pkg/log"
+)
+
+// DefaultTemplate is the default message posted when a channel goes live
+const DefaultTemplate = `[B]{{.UserName}}[/B] is live now: {{.Title}}{{if .Game}} ({{.Game}}){{end}} [URL]{{.URL}}[/URL]`
+
+// Config for the stream notifier
+type Config struct {
+	Bot   *teamspeak.Bot
+	DB    database.Service
+	Helix *helix.Client
+	// Detects streams going live, defaults to EventSub if Receiver and Manager
+	// are set and to polling Helix every PollInterval otherwise
+	Source Source
+	// Watched channels are refreshed every PollInterval when using EventSub
+	PollInterval time.Duration
+	Receiver     *eventsub.Receiver
+	Manager      *eventsub.Manager
+	// Login names of additional channels to watch
+	Channels []string
+	// Watch the channels of all linked users
+	Linked bool
+	// TeamSpeak channel to post messages into, 0 for none
+	ChannelID int
+	// Post messages into the server chat
+	ServerChat bool
+	// Server group linked users are a member of while live, 0 for none
+	LiveGroup int
+	// Go template of the posted message, executed with a Stream
+	Template string
+	Console  bool
+	Debug    bool
+}
+
+// Notifier posts messages to TeamSpeak when watched channels go live
+// and manages the live server group of linked streamers
+type Notifier struct {
+	bot        *teamspeak.Bot
+	db         database.Service
+	helix      *helix.Client
+	source     Source
+	channels   []string
+	linked     bool
+	channelID  int
+	serverChat bool
+	liveGroup  int
+	template   *template.Template
+	logger     *log.Logger
+
+	mu sync.Mutex
+	// Resolved user IDs of the configured channels
+	channelIDs []string
+	handlers   []Handler
+}
+
+// AddHandler registers a handler which is notified (in its own goroutine)
+// about watched channels going live or offline, the context passed
+// to the handler is not canceled once the source moves on
+func (n *Notifier) AddHandler(h Handler) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.handlers = append(n.handlers, h)
+}
+
+// Run watches the channels until context is canceled
+func (n *Notifier) Run(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	n.logger.Info("Watching streams")
+
+	err := n.source.Run(ctx, n.watched, n)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		n.logger.Error("Error watching streams: %v", err)
+	}
+
+	n.logger.Debug("Exiting stream notifier")
+}
+
+// Online implements Handler
+func (n *Notifier) Online(ctx context.Context, stream Stream) {
+	for _, h := range n.registered() {
+		go h.Online(context.WithoutCancel(ctx), stream)
+	}
+
+	ok, err := n.announce(ctx, stream)
+	if err != nil {
+		n.logger.Error("Error checking announcement of stream %s: %v", stream.ID, err)
+	}
+	if ok {
+		n.logger.Info("%s went live: %s", stream.UserLogin, stream.Title)
+		if err := n.post(stream); err != nil {
+			n.logger.Error("Error posting stream of %s: %v", stream.UserLogin, err)
+		}
+	}
+
+	if n.liveGroup == 0 {
+		return
+	}
+
+	user, err := n.user(stream.UserID)
+	if err != nil || user == nil {
+		return
+	}
+
+	if err := n.bot.AddServerGroup(user.TeamSpeakUID, n.liveGroup); err != nil {
+		n.logger.Error("Error adding live group to %s: %v", user.TeamSpeakUID, err)
+	}
+}
+
+// Offline implements Handler
+func (n *Notifier) Offline(ctx context.Context, userID string) {
+	for _, h := range n.registered() {
+		go h.Offline(context.WithoutCancel(ctx), userID)
+	}
+
+	if n.liveGroup == 0 {
+		return
+	}
+
+	user, err := n.user(userID)
+	if err != nil || user == nil {
+		return
+	}
+
+	if err := n.bot.RemoveServerGroup(user.TeamSpeakUID, n.liveGroup); err != nil {
+		n.logger.Error("Error removing live group from %s: %v", user.TeamSpeakUID, err)
+	}
+}
+
+// Returns a copy of the registered handlers
+func (n *Notifier) registered() []Handler {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return slices.Clone(n.handlers)
+}
+
+// Returns whether the stream has not been announced yet and marks it as announced,
+// prevents announcing streams again after restarts
+func (n *Notifier) announce(ctx context.Context, stream Stream) (bool, error) {
+	client := redis.GetClient()
+	if client == nil {
+		return true, nil
+	}
+
+	return client.SetNX(ctx, "twitchspeak:streams:announced:"+stream.ID, 1, announcedTTL).Result()
+}
+
+// Posts the message for the stream into the configured channel and server chat
+func (n *Notifier) post(stream Stream) error {
+	// Names, title and game are chosen on Twitch and must not be able to inject BBCode
+	stream.UserLogin = teamspeak.EscapeBBCode(stream.UserLogin)
+	stream.UserName = teamspeak.EscapeBBCode(stream.UserName)
+	stream.Title = teamspeak.EscapeBBCode(stream.Title)
+	stream.Game = teamspeak.EscapeBBCode(stream.Game)
+
+	var sb strings.Builder
+	if err := n.template.Execute(&sb, stream); err != nil {
+		return fmt.Errorf("executing template: %w", err)
+	}
+	msg := sb.String()
+
+	if n.channelID != 0 {
+		if err := n.bot.SendChannelMessage(n.channelID, msg); err != nil {
+			return err
+		}
+	}
+
+	if n.serverChat {
+		if err := n.bot.SendServerMessage(msg); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Returns the linked user of the Twitch user ID, nil if not linked or revoked
+func (n *Notifier) user(twitchID string) (*database.User, error) {
+	user, err := n.db.GetUserByTwitchID(twitchID)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		n.logger.Error("Error getting user %s: %v", twitchID, err)
+		return nil, err
+	}
+	if user.Revoked() {
+		return nil, nil
+	}
+	return user, nil
+}
+
+// Returns the Twitch user IDs of the configured channels and linked users
+func (n *Notifier) watched(ctx context.Context) ([]string, error) {
+	ids, err := n.configured(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if !n.linked {
+		return ids, nil
+	}
+
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		seen[id] = true
+	}
+
+	for offset := 0; ; offset += pageSize {
+		users, total, err := n.db.ListUsers(database.ListOptions{Offset: offset, Limit: pageSize})
+		if err != nil {
+			return nil, fmt.Errorf("listing users: %w", err)
+		}
+
+		for _, user := range users {
+			if !seen[user.TwitchID] {
+				seen[user.TwitchID] = true
+				ids = append(ids, user.TwitchID)
+			}
+		}
+
+		if len(users) == 0 || int64(offset+len(users)) >= total {
+			break
+		}
+	}
+
+	return ids, nil
+}
+
+// Resolves the user IDs of the configured channels once
+func (n *Notifier) configured(ctx context.Context) ([]string, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.channelIDs != nil || len(n.channels) == 0 {
+		return n.channelIDs, nil
+	}
+
+	users, err := n.helix.GetUsersByLogin(ctx, n.channels)
+	if err != nil {
+		return nil, fmt.Errorf("resolving channels: %w", err)
+	}
+
+	ids := make([]string, 0, len(users))
+	for _, user := range users {
+		ids = append(ids, user.ID)
+	}
+
+	if len(ids) < len(n.channels) {
+		n.logger.Warn("Resolved only %d of %d configured channels: %v", len(ids), len(n.channels), n.channels)
+	}
+
+	n.channelIDs = ids
+	return ids, nil
+}
+
+// NewNotifier creates a new stream notifier
+func NewNotifier(cfg Config) (*Notifier, error) {
+	if cfg.Bot == nil {
+		return nil, fmt.Errorf("streams: bot is nil")
+	}
+
+	if cfg.DB == nil {
+		return nil, fmt.Errorf("streams: database service is nil")
+	}
+
+	if cfg.Helix == nil {
+		return nil, fmt.Errorf("streams: helix client is nil")
+	}
+
+	if cfg.Template == "" {
+		cfg.Template = DefaultTemplate
+	}
+
+	tmpl, err := template.New("stream").Parse(cfg.Template)
+	if err != nil {
+		return nil, fmt.Errorf("streams: parsing template: %w", err)
+	}
+
+	logger := log.NewLogger(
+		log.WithOwnLogFile("streams.log"),
+		log.WithName("streams"),
+		log.WithConsole(cfg.Console),
+		log.WithDebug(cfg.Debug),
+	)
+
+	source := cfg.Source
+	switch {
+	case source != nil:
+	case cfg.Receiver != nil && cfg.Manager != nil:
+		source = NewEventSubSource(cfg.Receiver, cfg.Manager, cfg.Helix, cfg.PollInterval, logger)
+	default:
+		source = NewPollingSource(cfg.Helix, cfg.PollInterval, logger)
+	}
+
+	n := &Notifier{
+		bot:        cfg.Bot,
+		db:         cfg.DB,
+		helix:      cfg.Helix,
+		source:     source,
+		channels:   cfg.Channels,
+		linked:     cfg.Linked,
+		channelID:  cfg.ChannelID,
+		serverChat: cfg.ServerChat,
+		liveGroup:  cfg.LiveGroup,
+		template:   tmpl,
+		logger:     logger,
+	}
+
+	n.logger.Info(
+		"Stream notifier initialized, channels: %v, linked: %v, live group: %d",
+		n.channels,
+		n.linked,
+		n.liveGroup,
+	)
+
+	return n, nil
+}
+
+const (
+	// Announced streams are remembered for longer than streams usually last
+	announcedTTL = 48 * time.Hour
+	pageSize     = 100
+)
@@ -0,0 +1,109 @@
+package streams
+
+import (
+	"context"
+	"time"
+
+	"github.com/devusSs/twitchspeak/internal/helix"
+	"github.com/devusSs/twitchspeak/pkg/log"
+)
+
+// PollingSource is a Source periodically polling Helix for live streams
+type PollingSource struct {
+	helix    *helix.Client
+	interval time.Duration
+	logger   *log.Logger
+}
+
+// Run implements Source
+//
+// The first poll reports all channels which are not live as offline,
+// later polls only report changes
+func (p *PollingSource) Run(ctx context.Context, channels ChannelsFunc, h Handler) error {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	// Live streams per user ID, nil until the first successful poll
+	var live map[string]Stream
+
+	for {
+		current, ids, err := p.poll(ctx, channels)
+		if err != nil {
+			p.logger.Error("Error polling streams: %v", err)
+		} else {
+			for id, stream := range current {
+				if _, ok := live[id]; !ok {
+					h.Online(ctx, stream)
+				}
+			}
+
+			if live == nil {
+				for _, id := range ids {
+					if _, ok := current[id]; !ok {
+						h.Offline(ctx, id)
+					}
+				}
+			}
+
+			for id := range live {
+				if _, ok := current[id]; !ok {
+					h.Offline(ctx, id)
+				}
+			}
+
+			live = current
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Returns the live streams per user ID and all watched user IDs
+func (p *PollingSource) poll(
+	ctx context.Context,
+	channels ChannelsFunc,
+) (map[string]Stream, []string, error) {
+	ids, err := channels(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	streams, err := p.helix.GetStreams(ctx, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	current := make(map[string]Stream, len(streams))
+	for _, s := range streams {
+		current[s.UserID] = Stream{
+			ID:        s.ID,
+			UserID:    s.UserID,
+			UserLogin: s.UserLogin,
+			UserName:  s.UserName,
+			Title:     s.Title,
+			Game:      s.GameName,
+			StartedAt: s.StartedAt,
+		}
+	}
+
+	p.logger.Debug("polled %d channels, %d live", len(ids), len(current))
+
+	return current, ids, nil
+}
+
+// NewPollingSource creates a new Source polling Helix every interval
+func NewPollingSource(client *helix.Client, interval time.Duration, logger *log.Logger) *PollingSource {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	return &PollingSource{
+		helix:    client,
+		interval: interval,
+		logger:   logger,
+	}
+}
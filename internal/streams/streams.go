@@ -0,0 +1,39 @@
+package streams
+
+import (
+	"context"
+	"time"
+)
+
+// Stream is a live stream of a watched channel
+type Stream struct {
+	ID        string
+	UserID    string
+	UserLogin string
+	UserName  string
+	Title     string
+	Game      string
+	StartedAt time.Time
+}
+
+// URL returns the link to the stream
+func (s Stream) URL() string {
+	return "https://twitch.tv/" + s.UserLogin
+}
+
+// Handler is notified by a Source about channels going live or offline
+type Handler interface {
+	Online(ctx context.Context, stream Stream)
+	Offline(ctx context.Context, userID string)
+}
+
+// ChannelsFunc returns the Twitch user IDs of the channels to watch
+type ChannelsFunc func(ctx context.Context) ([]string, error)
+
+// Source detects channels going live and offline,
+// e.g. by polling Helix or via EventSub
+type Source interface {
+	// Run reports changes of the channels returned by channels to h,
+	// blocks until context is canceled
+	Run(ctx context.Context, channels ChannelsFunc, h Handler) error
+}
@@ -0,0 +1,71 @@
+package teamspeak
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/multiplay/go-ts3"
+)
+
+// Reason ID of kicks from the server
+const kickReasonServer = 5
+
+// BanUID bans the unique identifier from the server for the duration,
+// 0 for a permanent ban, and returns the ID of the ban
+//
+// Clients already connected are not kicked, see KickUID
+func (b *Bot) BanUID(uid string, duration time.Duration, reason string) (int, error) {
+	var resp struct {
+		ID int `ms:"banid"`
+	}
+	_, err := b.exec(ts3.NewCmd("banadd").WithArgs(
+		ts3.NewArg("uid", uid),
+		ts3.NewArg("time", int(duration.Seconds())),
+		ts3.NewArg("banreason", reason),
+	).WithResponse(&resp))
+	if err != nil {
+		return 0, fmt.Errorf("banning %s: %w", uid, err)
+	}
+
+	b.logger.Debug("banned %s for %v (ban %d)", uid, duration, resp.ID)
+
+	return resp.ID, nil
+}
+
+// RemoveBan deletes the ban with the given ID
+//
+// Does not return an error if the ban does not exist (anymore)
+func (b *Bot) RemoveBan(banID int) error {
+	_, err := b.exec(ts3.NewCmd("bandel").WithArgs(
+		ts3.NewArg("banid", banID),
+	))
+	if err != nil && !isTSError(err, errIDDatabaseEmptyResult) {
+		return fmt.Errorf("removing ban %d: %w", banID, err)
+	}
+
+	b.logger.Debug("removed ban %d", banID)
+
+	return nil
+}
+
+// KickUID kicks all clients connected with the given unique identifier
+// from the server, TeamSpeak limits the reason to 40 characters
+func (b *Bot) KickUID(uid string, reason string) error {
+	clids, err := b.clientIDs(uid)
+	if err != nil {
+		return err
+	}
+
+	for _, clid := range clids {
+		_, err := b.exec(ts3.NewCmd("clientkick").WithArgs(
+			ts3.NewArg("clid", clid),
+			ts3.NewArg("reasonid", kickReasonServer),
+			ts3.NewArg("reasonmsg", reason),
+		))
+		if err != nil && !isTSError(err, errIDInvalidClientID) {
+			return fmt.Errorf("kicking %s: %w", uid, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,11 @@
+package teamspeak
+
+import "strings"
+
+// EscapeBBCode breaks up BBCode tags in text from outside of TeamSpeak
+// (e.g. Twitch) using zero width spaces, TeamSpeak has no way of escaping them
+func EscapeBBCode(text string) string {
+	return bbCodeEscaper.Replace(text)
+}
+
+var bbCodeEscaper = strings.NewReplacer("[", "[\u200b", "]", "\u200b]")
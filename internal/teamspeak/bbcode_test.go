@@ -0,0 +1,32 @@
+package teamspeak
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestEscapeBBCode(t *testing.T) {
+	bbCode := regexp.MustCompile(`\[/?[a-zA-Z*]+(=[^\]]*)?\]`)
+
+	tests := []string{
+		"[B]bold[/B]",
+		"[URL=https://evil.example.com]click[/URL]",
+		"[img]https://evil.example.com/a.png[/img]",
+		"[*]",
+	}
+
+	for _, text := range tests {
+		escaped := EscapeBBCode(text)
+		if bbCode.MatchString(escaped) {
+			t.Errorf("EscapeBBCode(%q) = %q still contains BBCode", text, escaped)
+		}
+		if got := strings.ReplaceAll(escaped, "\u200b", ""); got != text {
+			t.Errorf("EscapeBBCode(%q) changed the visible text to %q", text, got)
+		}
+	}
+
+	if got := EscapeBBCode("no tags here"); got != "no tags here" {
+		t.Errorf("EscapeBBCode() changed text without brackets to %q", got)
+	}
+}
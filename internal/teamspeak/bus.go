@@ -0,0 +1,143 @@
+package teamspeak
+
+import (
+	"slices"
+	"sync"
+
+	"github.com/devusSs/twitchspeak/pkg/log"
+)
+
+// EventHandler handles an event published on the bus
+type EventHandler func(event Event)
+
+// Filter decides whether an event is delivered to a subscriber
+type Filter func(event Event) bool
+
+// OfType only delivers events of the given types
+func OfType(types ...EventType) Filter {
+	return func(event Event) bool {
+		return slices.Contains(types, event.Type())
+	}
+}
+
+// Bus is an in-process pub/sub bus for TeamSpeak events
+//
+// Every subscriber receives events in order in its own goroutine,
+// so slow subscribers do not block the bot or other subscribers
+type Bus struct {
+	mu     sync.RWMutex
+	subs   map[*Subscription]struct{}
+	logger *log.Logger
+}
+
+// Subscription is a handler subscribed to the bus
+type Subscription struct {
+	bus     *Bus
+	handler EventHandler
+	filters []Filter
+	events  chan Event
+	once    sync.Once
+}
+
+// Subscribe calls handler for every published event matching all filters
+func (b *Bus) Subscribe(handler EventHandler, filters ...Filter) *Subscription {
+	sub := &Subscription{
+		bus:     b,
+		handler: handler,
+		filters: filters,
+		events:  make(chan Event, subscriptionBufSize),
+	}
+
+	b.mu.Lock()
+	b.subs[sub] = struct{}{}
+	b.mu.Unlock()
+
+	go sub.run()
+
+	return sub
+}
+
+// On subscribes handler to all events of type T, e.g.
+//
+//	teamspeak.On(bus, func(e *teamspeak.ClientEntered) { ... })
+func On[T Event](b *Bus, handler func(event T), filters ...Filter) *Subscription {
+	filters = append([]Filter{func(event Event) bool {
+		_, ok := event.(T)
+		return ok
+	}}, filters...)
+
+	return b.Subscribe(func(event Event) {
+		handler(event.(T))
+	}, filters...)
+}
+
+// Publish delivers event to all matching subscribers
+//
+// Events are dropped for subscribers which can not keep up
+func (b *Bus) Publish(event Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for sub := range b.subs {
+		if !sub.matches(event) {
+			continue
+		}
+
+		select {
+		case sub.events <- event:
+		default:
+			b.logger.Warn("Dropped %s event, subscriber can not keep up", event.Type())
+		}
+	}
+}
+
+// Unsubscribe removes the subscription from the bus
+//
+// Events already queued for the subscription are still handled
+func (s *Subscription) Unsubscribe() {
+	s.once.Do(func() {
+		s.bus.mu.Lock()
+		delete(s.bus.subs, s)
+		s.bus.mu.Unlock()
+
+		close(s.events)
+	})
+}
+
+func (s *Subscription) matches(event Event) bool {
+	for _, filter := range s.filters {
+		if !filter(event) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Subscription) run() {
+	for event := range s.events {
+		s.handle(event)
+	}
+}
+
+// Handles a single event, recovers from panics
+// so a faulty subscriber does not take down the bot
+func (s *Subscription) handle(event Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.bus.logger.Error("Recovered from panic handling %s event: %v", event.Type(), r)
+		}
+	}()
+
+	s.handler(event)
+}
+
+// NewBus creates a new event bus
+func NewBus(logger *log.Logger) *Bus {
+	return &Bus{
+		subs:   make(map[*Subscription]struct{}),
+		logger: logger,
+	}
+}
+
+// Number of events queued per subscriber before events get dropped
+const subscriptionBufSize = 64
@@ -0,0 +1,109 @@
+package teamspeak
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/multiplay/go-ts3"
+)
+
+// ErrChannelNameInUse is returned if a sibling channel has the same name
+var ErrChannelNameInUse = errors.New("channel name is already in use")
+
+// Channel is a channel as returned by channellist
+type Channel struct {
+	ID       int    `ms:"cid"`
+	ParentID int    `ms:"pid"`
+	Name     string `ms:"channel_name"`
+	// Includes ServerQuery clients
+	TotalClients int `ms:"total_clients"`
+}
+
+// Channels returns all channels of the server
+func (b *Bot) Channels() ([]*Channel, error) {
+	var channels []*Channel
+	_, err := b.exec(ts3.NewCmd("channellist").WithResponse(&channels))
+	if err != nil {
+		return nil, fmt.Errorf("listing channels: %w", err)
+	}
+	return channels, nil
+}
+
+// CreateChannel creates a permanent sub-channel of parent
+// and returns the ID of the new channel
+func (b *Bot) CreateChannel(parent int, name string, description string) (int, error) {
+	var resp struct {
+		ID int `ms:"cid"`
+	}
+	_, err := b.exec(ts3.NewCmd("channelcreate").WithArgs(
+		ts3.NewArg("channel_name", name),
+		ts3.NewArg("channel_description", description),
+		ts3.NewArg("cpid", parent),
+		ts3.NewArg("channel_flag_permanent", 1),
+	).WithResponse(&resp))
+	if isTSError(err, errIDChannelNameInUse) {
+		return 0, ErrChannelNameInUse
+	}
+	if err != nil {
+		return 0, fmt.Errorf("creating channel %q: %w", name, err)
+	}
+
+	b.logger.Debug("created channel %d (%q) below %d", resp.ID, name, parent)
+
+	return resp.ID, nil
+}
+
+// SetChannelDescription replaces the description of the channel
+func (b *Bot) SetChannelDescription(cid int, description string) error {
+	_, err := b.exec(ts3.NewCmd("channeledit").WithArgs(
+		ts3.NewArg("cid", cid),
+		ts3.NewArg("channel_description", description),
+	))
+	if err != nil {
+		return fmt.Errorf("editing channel %d: %w", cid, err)
+	}
+	return nil
+}
+
+// DeleteChannel deletes the channel even if clients are in it
+//
+// Does not return an error if the channel does not exist
+func (b *Bot) DeleteChannel(cid int) error {
+	_, err := b.exec(ts3.NewCmd("channeldelete").WithArgs(
+		ts3.NewArg("cid", cid),
+		ts3.NewArg("force", 1),
+	))
+	if err != nil && !isTSError(err, errIDInvalidChannelID) {
+		return fmt.Errorf("deleting channel %d: %w", cid, err)
+	}
+
+	b.logger.Debug("deleted channel %d", cid)
+
+	return nil
+}
+
+// SetClientChannelGroup puts the client with the given database ID
+// into a channel group of the channel
+func (b *Bot) SetClientChannelGroup(cldbid int, cid int, group int) error {
+	_, err := b.exec(ts3.NewCmd("setclientchannelgroup").WithArgs(
+		ts3.NewArg("cgid", group),
+		ts3.NewArg("cid", cid),
+		ts3.NewArg("cldbid", cldbid),
+	))
+	if err != nil {
+		return fmt.Errorf("setting channel group %d in channel %d: %w", group, cid, err)
+	}
+	return nil
+}
+
+// MoveClient moves the client with the given client id into the channel
+func (b *Bot) MoveClient(clid string, cid int) error {
+	_, err := b.exec(ts3.NewCmd("clientmove").WithArgs(
+		ts3.NewArg("clid", clid),
+		ts3.NewArg("cid", cid),
+	))
+	if err != nil {
+		return fmt.Errorf("moving client to channel %d: %w", cid, err)
+	}
+	return nil
+}
@@ -0,0 +1,449 @@
+package teamspeak
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/multiplay/go-ts3"
+
+	"github.com/devusSs/twitchspeak/internal/database"
+	"github.com/devusSs/twitchspeak/internal/database/redis"
+	"github.com/devusSs/twitchspeak/internal/links"
+)
+
+// RegisterCommand adds a command to the bot's command registry
+func (b *Bot) RegisterCommand(cmd *Command) error {
+	return b.commands.Register(cmd)
+}
+
+// Commands returns the bot's command registry
+func (b *Bot) Commands() *Registry {
+	return b.commands
+}
+
+// Parses text messages and dispatches them to the matching command
+func (b *Bot) handleTextMessage(msg *TextMessage) {
+	invokerID := strconv.Itoa(msg.Invoker.ID)
+	invokerUID := msg.Invoker.UID
+
+	// Ignore our own messages, the server echoes them back to us
+	if invokerID == b.OwnID() || invokerUID == "" {
+		return
+	}
+
+	switch msg.TargetMode {
+	case TargetModePrivate, TargetModeChannel, TargetModeServer:
+	default:
+		return
+	}
+
+	name, args, ok := b.commands.Parse(msg.Message)
+	if !ok {
+		return
+	}
+
+	cmd, ok := b.commands.Lookup(name)
+	if !ok {
+		return
+	}
+
+	b.logger.Debug("command %q invoked by %s (%s)", cmd.Name, msg.Invoker.Name, invokerUID)
+
+	ctx := &CommandContext{
+		Bot:         b,
+		Command:     cmd,
+		Args:        args,
+		InvokerID:   invokerID,
+		InvokerUID:  invokerUID,
+		InvokerName: msg.Invoker.Name,
+	}
+
+	if err := b.runCommand(ctx); err != nil {
+		b.logger.Error("Error handling command %q for %s: %v", cmd.Name, invokerUID, err)
+		_ = ctx.Reply("Something went wrong, sorry about that.")
+	}
+}
+
+// Resolves invoker details, checks permissions and cooldowns
+// and finally runs the command handler
+func (b *Bot) runCommand(ctx *CommandContext) error {
+	info, err := b.clientInfo(ctx.InvokerID)
+	if err != nil {
+		return fmt.Errorf("getting client info: %w", err)
+	}
+
+	ctx.InvokerDBID = strconv.Itoa(info.DatabaseID)
+	ctx.ChannelID = strconv.Itoa(info.ChannelID)
+	ctx.ServerGroups = info.serverGroups()
+
+	user, err := b.db.GetUserByTeamSpeakUID(ctx.InvokerUID)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		return fmt.Errorf("getting user: %w", err)
+	}
+	ctx.User = user
+
+	if ctx.Command.ServerGroup != 0 && !slices.Contains(ctx.ServerGroups, ctx.Command.ServerGroup) {
+		return ctx.Reply("You are not allowed to use this command.")
+	}
+
+	if ctx.Command.LinkedOnly && (ctx.User == nil || ctx.User.Revoked()) {
+		return ctx.Replyf(
+			"This command requires a connected Twitch account. Use %sconnect to connect it.",
+			b.commands.Prefix(),
+		)
+	}
+
+	remaining, err := b.checkCooldown(ctx.Command, ctx.InvokerUID)
+	if err != nil {
+		return fmt.Errorf("checking cooldown: %w", err)
+	}
+	if remaining > 0 {
+		return ctx.Replyf(
+			"Please wait %v before using this command again.",
+			remaining.Round(time.Second),
+		)
+	}
+
+	err = ctx.Command.Handler(ctx)
+	// Failed and rejected invocations do not lock the invoker out
+	if err != nil || ctx.rejected {
+		if resetErr := b.resetCooldown(ctx.Command, ctx.InvokerUID); resetErr != nil {
+			b.logger.Error("Error resetting cooldown of %s for %s: %v", ctx.Command.Name, ctx.InvokerUID, resetErr)
+		}
+	}
+	return err
+}
+
+// Checks and starts the cooldown of cmd for uid,
+// starting it right away keeps concurrent invocations out
+//
+// Returns the remaining duration if the cooldown is still active
+func (b *Bot) checkCooldown(cmd *Command, uid string) (time.Duration, error) {
+	client := redis.GetClient()
+	if cmd.Cooldown <= 0 || client == nil {
+		return 0, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	key := cooldownKey(cmd, uid)
+
+	ok, err := client.SetNX(ctx, key, 1, cmd.Cooldown).Result()
+	if err != nil {
+		return 0, err
+	}
+	if ok {
+		return 0, nil
+	}
+
+	ttl, err := client.PTTL(ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	return ttl, nil
+}
+
+// Ends the cooldown of cmd for uid
+func (b *Bot) resetCooldown(cmd *Command, uid string) error {
+	client := redis.GetClient()
+	if cmd.Cooldown <= 0 || client == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return client.Del(ctx, cooldownKey(cmd, uid)).Err()
+}
+
+func cooldownKey(cmd *Command, uid string) string {
+	return fmt.Sprintf("twitchspeak:cooldown:%s:%s", strings.ToLower(cmd.Name), uid)
+}
+
+// Registers the commands every bot provides
+func (b *Bot) registerDefaultCommands() {
+	cmds := []*Command{
+		{
+			Name:        "connect",
+			Aliases:     []string{"login"},
+			Description: "Sends you your personal link for connecting your Twitch account",
+			Cooldown:    10 * time.Second,
+			Handler:     b.handleConnectCommand,
+		},
+		{
+			Name:        "link",
+			Usage:       "<code>",
+			Description: "Connects your Twitch account using the code shown on the website after logging in",
+			Cooldown:    5 * time.Second,
+			Handler:     b.handleLinkCommand,
+		},
+		{
+			Name:        "disconnect",
+			Description: "Removes the connection between your TeamSpeak identity and Twitch",
+			Cooldown:    10 * time.Second,
+			Handler:     b.handleDisconnectCommand,
+		},
+		{
+			Name:        "status",
+			Description: "Shows whether your TeamSpeak identity is connected to Twitch",
+			Handler:     b.handleStatusCommand,
+		},
+		{
+			Name:        "help",
+			Usage:       "[command]",
+			Description: "Lists available commands or shows details about one command",
+			Handler:     b.handleHelpCommand,
+		},
+	}
+
+	for _, cmd := range cmds {
+		if err := b.commands.Register(cmd); err != nil {
+			b.logger.Error("Error registering default command %q: %v", cmd.Name, err)
+		}
+	}
+}
+
+// Sends the invoker their personal login link
+func (b *Bot) handleConnectCommand(ctx *CommandContext) error {
+	// Revoked users need to login again
+	if ctx.User != nil && !ctx.User.Revoked() {
+		return ctx.Rejectf(
+			"Your TeamSpeak identity is already connected to Twitch. Use %sdisconnect to remove the connection.",
+			b.commands.Prefix(),
+		)
+	}
+
+	link, err := b.LoginURL(ctx.InvokerUID)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Replyf(
+		"Connect your Twitch account here (valid once, expires soon): [URL]%s[/URL]",
+		link,
+	)
+}
+
+// Links the invoker to the Twitch account a link code was issued for
+func (b *Bot) handleLinkCommand(ctx *CommandContext) error {
+	if ctx.User != nil {
+		return ctx.Rejectf(
+			"Your TeamSpeak identity is already connected to Twitch. Use %sdisconnect to remove the connection.",
+			b.commands.Prefix(),
+		)
+	}
+
+	if len(ctx.Args) != 1 {
+		return ctx.Rejectf("Usage: %s", formatUsage(b.commands.Prefix(), ctx.Command))
+	}
+
+	c, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	twitchID, err := links.RedeemCode(c, ctx.InvokerUID, ctx.Args[0])
+	if errors.Is(err, links.ErrTooManyAttempts) {
+		return ctx.Reply("Too many invalid codes, please try again later.")
+	}
+	if errors.Is(err, links.ErrInvalidCode) {
+		return ctx.Reply("This code is invalid or expired, please request a new one on the website.")
+	}
+	if err != nil {
+		return fmt.Errorf("redeeming link code: %w", err)
+	}
+
+	_, err = links.Link(b.db, ctx.InvokerUID, twitchID)
+	if errors.Is(err, database.ErrAlreadyLinked) {
+		return ctx.Reply("This Twitch account is already connected to another TeamSpeak identity.")
+	}
+	if err != nil {
+		return fmt.Errorf("linking user: %w", err)
+	}
+
+	b.logger.Info("Linked TeamSpeak identity %s to Twitch ID %s via link code", ctx.InvokerUID, twitchID)
+
+	return ctx.Reply("Your TeamSpeak identity has been connected to Twitch.")
+}
+
+// Removes the connection between the invoker and their Twitch account
+func (b *Bot) handleDisconnectCommand(ctx *CommandContext) error {
+	if ctx.User == nil {
+		return ctx.Rejectf(
+			"Your TeamSpeak identity is not connected to Twitch. Use %sconnect to connect it.",
+			b.commands.Prefix(),
+		)
+	}
+
+	err := b.db.DeleteUserByTeamSpeakUID(ctx.InvokerUID)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		return fmt.Errorf("deleting user: %w", err)
+	}
+
+	err = b.db.DeleteToken(ctx.User.TwitchID)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		return fmt.Errorf("deleting token: %w", err)
+	}
+
+	b.logger.Info("Disconnected TeamSpeak identity %s from Twitch", ctx.InvokerUID)
+
+	return ctx.Reply("Your TeamSpeak identity has been disconnected from Twitch.")
+}
+
+// Reports whether the invoker is connected to Twitch
+func (b *Bot) handleStatusCommand(ctx *CommandContext) error {
+	if ctx.User == nil {
+		return ctx.Replyf(
+			"Your TeamSpeak identity is not connected to Twitch. Use %sconnect to connect it.",
+			b.commands.Prefix(),
+		)
+	}
+
+	if ctx.User.Revoked() {
+		return ctx.Replyf(
+			"You revoked the access to your Twitch account. Use %sconnect to login again.",
+			b.commands.Prefix(),
+		)
+	}
+
+	return ctx.Replyf(
+		"Your TeamSpeak identity is connected to Twitch ID %s since %s.",
+		ctx.User.TwitchID,
+		ctx.User.CreatedAt.Format("2006-01-02 15:04"),
+	)
+}
+
+// Lists the commands the invoker may use or details about a single command
+func (b *Bot) handleHelpCommand(ctx *CommandContext) error {
+	prefix := b.commands.Prefix()
+
+	if len(ctx.Args) > 0 {
+		cmd, ok := b.commands.Lookup(strings.TrimPrefix(ctx.Args[0], prefix))
+		if !ok {
+			return ctx.Replyf("Unknown command %q.", ctx.Args[0])
+		}
+
+		var sb strings.Builder
+		sb.WriteString(formatUsage(prefix, cmd))
+		sb.WriteString("\n")
+		sb.WriteString(cmd.Description)
+		if len(cmd.Aliases) > 0 {
+			sb.WriteString("\nAliases: ")
+			sb.WriteString(prefix + strings.Join(cmd.Aliases, ", "+prefix))
+		}
+		if cmd.Cooldown > 0 {
+			sb.WriteString(fmt.Sprintf("\nCooldown: %v", cmd.Cooldown))
+		}
+
+		return ctx.Reply(sb.String())
+	}
+
+	var sb strings.Builder
+	sb.WriteString("Available commands:")
+	for _, cmd := range b.commands.Commands() {
+		if cmd.ServerGroup != 0 && !slices.Contains(ctx.ServerGroups, cmd.ServerGroup) {
+			continue
+		}
+		if cmd.LinkedOnly && ctx.User == nil {
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("\n%s - %s", formatUsage(prefix, cmd), cmd.Description))
+	}
+
+	return ctx.Reply(sb.String())
+}
+
+// Formats the usage line of a command
+func formatUsage(prefix string, cmd *Command) string {
+	if cmd.Usage == "" {
+		return prefix + cmd.Name
+	}
+	return fmt.Sprintf("%s%s %s", prefix, cmd.Name, cmd.Usage)
+}
+
+// LoginURL builds the personal login url for a TeamSpeak unique identifier
+// containing a signed, short-lived link token
+func (b *Bot) LoginURL(uid string) (string, error) {
+	token, err := b.linkTokens.Issue(uid)
+	if err != nil {
+		return "", fmt.Errorf("issuing link token: %w", err)
+	}
+	return fmt.Sprintf("%s?token=%s", b.loginBaseURL, url.QueryEscape(token)), nil
+}
+
+// SendPrivateMessage sends a private text message to the client with the given client id
+func (b *Bot) SendPrivateMessage(clid string, msg string) error {
+	_, err := b.exec(ts3.NewCmd("sendtextmessage").WithArgs(
+		ts3.NewArg("targetmode", TargetModePrivate),
+		ts3.NewArg("target", clid),
+		ts3.NewArg("msg", msg),
+	))
+	if err != nil {
+		return fmt.Errorf("sending private message: %w", err)
+	}
+	return nil
+}
+
+// Poke pokes the client with the given client id,
+// TeamSpeak limits pokes to 100 characters
+func (b *Bot) Poke(clid string, msg string) error {
+	_, err := b.exec(ts3.NewCmd("clientpoke").WithArgs(
+		ts3.NewArg("clid", clid),
+		ts3.NewArg("msg", msg),
+	))
+	if err != nil {
+		return fmt.Errorf("poking client: %w", err)
+	}
+	return nil
+}
+
+// Details about an online client as returned by clientinfo
+type clientInfo struct {
+	ChannelID    int    `ms:"cid"`
+	DatabaseID   int    `ms:"client_database_id"`
+	UID          string `ms:"client_unique_identifier"`
+	Nickname     string `ms:"client_nickname"`
+	ServerGroups string `ms:"client_servergroups"`
+	Country      string `ms:"client_country"`
+}
+
+// Parses the comma separated server group IDs
+func (c *clientInfo) serverGroups() []int {
+	var groups []int
+	for _, g := range strings.Split(c.ServerGroups, ",") {
+		id, err := strconv.Atoi(strings.TrimSpace(g))
+		if err != nil {
+			continue
+		}
+		groups = append(groups, id)
+	}
+	return groups
+}
+
+// ClientChannelID returns the ID of the channel
+// the online client with the given client id is in
+func (b *Bot) ClientChannelID(clid string) (int, error) {
+	info, err := b.clientInfo(clid)
+	if err != nil {
+		return 0, fmt.Errorf("getting client info: %w", err)
+	}
+	return info.ChannelID, nil
+}
+
+// Gets details about the online client with the given client id
+func (b *Bot) clientInfo(clid string) (*clientInfo, error) {
+	var info clientInfo
+	_, err := b.exec(ts3.NewCmd("clientinfo").WithArgs(
+		ts3.NewArg("clid", clid),
+	).WithResponse(&info))
+	if err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
@@ -0,0 +1,62 @@
+package teamspeak
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"github.com/devusSs/twitchspeak/internal/database/redis"
+)
+
+func TestCooldown(t *testing.T) {
+	mr := miniredis.RunT(t)
+
+	host, port, err := net.SplitHostPort(mr.Addr())
+	if err != nil {
+		t.Fatalf("splitting redis address: %v", err)
+	}
+	p, err := strconv.ParseUint(port, 10, 0)
+	if err != nil {
+		t.Fatalf("parsing redis port: %v", err)
+	}
+	if err := redis.Init(redis.Config{Host: host, Port: uint(p)}); err != nil {
+		t.Fatalf("connecting to redis: %v", err)
+	}
+
+	b := &Bot{}
+	cmd := &Command{Name: "Link", Cooldown: time.Minute}
+
+	remaining, err := b.checkCooldown(cmd, "uid=")
+	if err != nil || remaining != 0 {
+		t.Fatalf("first invocation: remaining = %v, err = %v, want no cooldown", remaining, err)
+	}
+
+	remaining, err = b.checkCooldown(cmd, "uid=")
+	if err != nil || remaining <= 0 || remaining > time.Minute {
+		t.Fatalf("second invocation: remaining = %v, err = %v, want an active cooldown", remaining, err)
+	}
+
+	// Other invokers are not affected
+	if remaining, err := b.checkCooldown(cmd, "other="); err != nil || remaining != 0 {
+		t.Fatalf("other invoker: remaining = %v, err = %v, want no cooldown", remaining, err)
+	}
+
+	// Failed or rejected invocations reset the cooldown
+	if err := b.resetCooldown(cmd, "uid="); err != nil {
+		t.Fatalf("resetting cooldown: %v", err)
+	}
+	if remaining, err := b.checkCooldown(cmd, "uid="); err != nil || remaining != 0 {
+		t.Fatalf("after reset: remaining = %v, err = %v, want no cooldown", remaining, err)
+	}
+
+	// Commands without cooldown never wait
+	free := &Command{Name: "status"}
+	for i := 0; i < 2; i++ {
+		if remaining, err := b.checkCooldown(free, "uid="); err != nil || remaining != 0 {
+			t.Fatalf("command without cooldown: remaining = %v, err = %v", remaining, err)
+		}
+	}
+}
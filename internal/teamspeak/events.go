@@ -0,0 +1,275 @@
+package teamspeak
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/multiplay/go-ts3"
+)
+
+// EventType is the type of a TeamSpeak event as sent by the server
+type EventType string
+
+// Supported event types
+const (
+	EventClientEntered  EventType = "cliententerview"
+	EventClientLeft     EventType = "clientleftview"
+	EventClientMoved    EventType = "clientmoved"
+	EventTextMessage    EventType = "textmessage"
+	EventTokenUsed      EventType = "tokenused"
+	EventChannelCreated EventType = "channelcreated"
+	EventChannelEdited  EventType = "channeledited"
+	EventChannelDeleted EventType = "channeldeleted"
+	EventServerEdited   EventType = "serveredited"
+)
+
+// Event is a typed TeamSpeak event decoded from a notification
+type Event interface {
+	Type() EventType
+}
+
+// Invoker is the client which caused an event
+//
+// Empty for events caused by the server itself
+type Invoker struct {
+	ID   int
+	Name string
+	UID  string
+}
+
+// Reasons for clients entering, leaving or moving
+const (
+	ReasonNone         = 0
+	ReasonMoved        = 1
+	ReasonTimeout      = 3
+	ReasonChannelKick  = 4
+	ReasonServerKick   = 5
+	ReasonBan          = 6
+	ReasonLeft         = 8
+	ReasonServerEdited = 10
+	ReasonShutdown     = 11
+)
+
+// ClientEntered is sent when a client connects to the server
+type ClientEntered struct {
+	ClientID     int
+	DatabaseID   int
+	UID          string
+	Nickname     string
+	Country      string
+	ChannelID    int
+	ServerGroups []int
+	// Whether the client is a ServerQuery client instead of a regular one
+	Query bool
+}
+
+// Type implements Event
+func (e *ClientEntered) Type() EventType { return EventClientEntered }
+
+// ClientLeft is sent when a client disconnects from the server
+type ClientLeft struct {
+	ClientID      int
+	FromChannelID int
+	ReasonID      int
+	ReasonMessage string
+	// Set if the client got kicked or banned
+	Invoker Invoker
+}
+
+// Type implements Event
+func (e *ClientLeft) Type() EventType { return EventClientLeft }
+
+// ClientMoved is sent when a client switches channels
+type ClientMoved struct {
+	ClientID  int
+	ChannelID int
+	ReasonID  int
+	// Set if the client got moved by someone else
+	Invoker Invoker
+}
+
+// Type implements Event
+func (e *ClientMoved) Type() EventType { return EventClientMoved }
+
+// TextMessage is sent for private, channel and server chat messages
+type TextMessage struct {
+	// One of TargetModePrivate, TargetModeChannel or TargetModeServer
+	TargetMode int
+	Message    string
+	// Client ID the message was sent to, only set for private messages
+	TargetID int
+	Invoker  Invoker
+}
+
+// Type implements Event
+func (e *TextMessage) Type() EventType { return EventTextMessage }
+
+// TokenUsed is sent when a client uses a privilege key
+type TokenUsed struct {
+	ClientID   int
+	DatabaseID int
+	UID        string
+	Token      string
+	// Custom fields set when the token was created
+	CustomSet string
+	// Server or channel group ID and channel ID the token granted
+	GroupID   int
+	ChannelID int
+}
+
+// Type implements Event
+func (e *TokenUsed) Type() EventType { return EventTokenUsed }
+
+// ChannelCreated is sent when a channel gets created
+type ChannelCreated struct {
+	ChannelID int
+	ParentID  int
+	Name      string
+	Invoker   Invoker
+}
+
+// Type implements Event
+func (e *ChannelCreated) Type() EventType { return EventChannelCreated }
+
+// ChannelEdited is sent when properties of a channel get changed
+type ChannelEdited struct {
+	ChannelID int
+	ReasonID  int
+	Invoker   Invoker
+	// Changed channel properties like channel_name with their new values
+	Changes map[string]string
+}
+
+// Type implements Event
+func (e *ChannelEdited) Type() EventType { return EventChannelEdited }
+
+// ChannelDeleted is sent when a channel gets deleted
+type ChannelDeleted struct {
+	ChannelID int
+	Invoker   Invoker
+}
+
+// Type implements Event
+func (e *ChannelDeleted) Type() EventType { return EventChannelDeleted }
+
+// RawEvent is any event without a typed representation
+type RawEvent struct {
+	EventType EventType
+	Data      map[string]string
+}
+
+// Type implements Event
+func (e *RawEvent) Type() EventType { return e.EventType }
+
+// Target modes of text messages as sent by the TeamSpeak server
+const (
+	TargetModePrivate = 1
+	TargetModeChannel = 2
+	TargetModeServer  = 3
+)
+
+// DecodeEvent decodes a notification into a typed event,
+// unknown notifications are returned as RawEvent
+func DecodeEvent(n ts3.Notification) Event {
+	d := eventData(n.Data)
+
+	switch EventType(n.Type) {
+	case EventClientEntered:
+		return &ClientEntered{
+			ClientID:     d.int("clid"),
+			DatabaseID:   d.int("client_database_id"),
+			UID:          d["client_unique_identifier"],
+			Nickname:     d["client_nickname"],
+			Country:      d["client_country"],
+			ChannelID:    d.int("ctid"),
+			ServerGroups: d.ints("client_servergroups"),
+			Query:        d["client_type"] == "1",
+		}
+	case EventClientLeft:
+		return &ClientLeft{
+			ClientID:      d.int("clid"),
+			FromChannelID: d.int("cfid"),
+			ReasonID:      d.int("reasonid"),
+			ReasonMessage: d["reasonmsg"],
+			Invoker:       d.invoker(),
+		}
+	case EventClientMoved:
+		return &ClientMoved{
+			ClientID:  d.int("clid"),
+			ChannelID: d.int("ctid"),
+			ReasonID:  d.int("reasonid"),
+			Invoker:   d.invoker(),
+		}
+	case EventTextMessage:
+		return &TextMessage{
+			TargetMode: d.int("targetmode"),
+			Message:    d["msg"],
+			TargetID:   d.int("target"),
+			Invoker:    d.invoker(),
+		}
+	case EventTokenUsed:
+		return &TokenUsed{
+			ClientID:   d.int("clid"),
+			DatabaseID: d.int("cldbid"),
+			UID:        d["cluid"],
+			Token:      d["token"],
+			CustomSet:  d["tokencustomset"],
+			GroupID:    d.int("token1"),
+			ChannelID:  d.int("token2"),
+		}
+	case EventChannelCreated:
+		return &ChannelCreated{
+			ChannelID: d.int("cid"),
+			ParentID:  d.int("cpid"),
+			Name:      d["channel_name"],
+			Invoker:   d.invoker(),
+		}
+	case EventChannelEdited:
+		changes := make(map[string]string)
+		for k, v := range d {
+			if strings.HasPrefix(k, "channel_") {
+				changes[k] = v
+			}
+		}
+		return &ChannelEdited{
+			ChannelID: d.int("cid"),
+			ReasonID:  d.int("reasonid"),
+			Invoker:   d.invoker(),
+			Changes:   changes,
+		}
+	case EventChannelDeleted:
+		return &ChannelDeleted{
+			ChannelID: d.int("cid"),
+			Invoker:   d.invoker(),
+		}
+	default:
+		return &RawEvent{EventType: EventType(n.Type), Data: n.Data}
+	}
+}
+
+// Notification data with helpers for decoding values
+type eventData map[string]string
+
+func (d eventData) int(key string) int {
+	i, _ := strconv.Atoi(d[key])
+	return i
+}
+
+// Decodes comma separated IDs like server groups
+func (d eventData) ints(key string) []int {
+	var ids []int
+	for _, s := range strings.Split(d[key], ",") {
+		if id, err := strconv.Atoi(s); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func (d eventData) invoker() Invoker {
+	return Invoker{
+		ID:   d.int("invokerid"),
+		Name: d["invokername"],
+		UID:  d["invokeruid"],
+	}
+}
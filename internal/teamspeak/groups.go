@@ -0,0 +1,110 @@
+package teamspeak
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/multiplay/go-ts3"
+)
+
+// Error IDs returned by the TeamSpeak server
+const (
+	errIDInvalidClientID     = 512
+	errIDInvalidChannelID    = 768
+	errIDChannelNameInUse    = 771
+	errIDDatabaseEmptyResult = 1281
+	errIDDuplicateEntry      = 2561
+)
+
+// ClientDBIDFromUID returns the database ID of the client
+// with the given unique identifier
+func (b *Bot) ClientDBIDFromUID(uid string) (int, error) {
+	var resp struct {
+		DatabaseID int `ms:"cldbid"`
+	}
+	_, err := b.exec(ts3.NewCmd("clientgetdbidfromuid").WithArgs(
+		ts3.NewArg("cluid", uid),
+	).WithResponse(&resp))
+	if err != nil {
+		return 0, fmt.Errorf("getting database id: %w", err)
+	}
+	return resp.DatabaseID, nil
+}
+
+// ServerGroupsByUID returns the IDs of all server groups
+// the client with the given unique identifier is a member of
+func (b *Bot) ServerGroupsByUID(uid string) ([]int, error) {
+	cldbid, err := b.ClientDBIDFromUID(uid)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp []struct {
+		ID int `ms:"sgid"`
+	}
+	_, err = b.exec(ts3.NewCmd("servergroupsbyclientid").WithArgs(
+		ts3.NewArg("cldbid", cldbid),
+	).WithResponse(&resp))
+	if isTSError(err, errIDDatabaseEmptyResult) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting server groups: %w", err)
+	}
+
+	groups := make([]int, 0, len(resp))
+	for _, g := range resp {
+		groups = append(groups, g.ID)
+	}
+	return groups, nil
+}
+
+// AddServerGroup adds the client with the given unique identifier to a server group
+//
+// Does not return an error if the client already is a member
+func (b *Bot) AddServerGroup(uid string, group int) error {
+	cldbid, err := b.ClientDBIDFromUID(uid)
+	if err != nil {
+		return err
+	}
+
+	_, err = b.exec(ts3.NewCmd("servergroupaddclient").WithArgs(
+		ts3.NewArg("sgid", group),
+		ts3.NewArg("cldbid", cldbid),
+	))
+	if err != nil && !isTSError(err, errIDDuplicateEntry) {
+		return fmt.Errorf("adding server group %d: %w", group, err)
+	}
+
+	b.logger.Debug("added %s to server group %d", uid, group)
+
+	return nil
+}
+
+// RemoveServerGroup removes the client with the given unique identifier from a server group
+//
+// Does not return an error if the client is not a member
+func (b *Bot) RemoveServerGroup(uid string, group int) error {
+	cldbid, err := b.ClientDBIDFromUID(uid)
+	if err != nil {
+		return err
+	}
+
+	_, err = b.exec(ts3.NewCmd("servergroupdelclient").WithArgs(
+		ts3.NewArg("sgid", group),
+		ts3.NewArg("cldbid", cldbid),
+	))
+	if err != nil && !isTSError(err, errIDDatabaseEmptyResult) {
+		return fmt.Errorf("removing server group %d: %w", group, err)
+	}
+
+	b.logger.Debug("removed %s from server group %d", uid, group)
+
+	return nil
+}
+
+// Checks whether err is an error returned by the TeamSpeak server with the given ID
+func isTSError(err error, id int) bool {
+	var tsErr *ts3.Error
+	return errors.As(err, &tsErr) && tsErr.ID == id
+}
@@ -0,0 +1,160 @@
+package teamspeak
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/multiplay/go-ts3"
+)
+
+// SendChannelMessage sends a text message to the channel with the given ID
+//
+// ServerQuery clients can only write to their own channel,
+// so the bot moves itself into the channel first and
+// returns to its home channel (if set) afterwards
+func (b *Bot) SendChannelMessage(cid int, msg string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.enterChannel(cid); err != nil {
+		return err
+	}
+	if b.homeChannel != 0 && b.homeChannel != cid {
+		defer b.returnHome()
+	}
+
+	_, err := b.client.ExecCmd(ts3.NewCmd("sendtextmessage").WithArgs(
+		ts3.NewArg("targetmode", TargetModeChannel),
+		ts3.NewArg("target", cid),
+		ts3.NewArg("msg", msg),
+	))
+	if err != nil {
+		return fmt.Errorf("sending channel message: %w", err)
+	}
+	return nil
+}
+
+// EnterChannel moves the bot into the channel with the given ID,
+// the bot receives channel messages of the channel it is in
+func (b *Bot) EnterChannel(cid int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.enterChannel(cid)
+}
+
+// SetHomeChannel moves the bot into the channel and keeps it there,
+// the bot returns to it after messaging other channels and after reconnecting
+//
+// The bot only receives channel messages of the channel it is in
+func (b *Bot) SetHomeChannel(cid int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.homeChannel = cid
+	return b.enterChannel(cid)
+}
+
+// Moves the bot back into its home channel, needs to be called with mu held
+func (b *Bot) returnHome() {
+	if err := b.enterChannel(b.homeChannel); err != nil {
+		b.logger.Error("Error returning to home channel %d: %v", b.homeChannel, err)
+	}
+}
+
+// Moves the bot into the channel unless it is in there already,
+// needs to be called with mu held
+func (b *Bot) enterChannel(cid int) error {
+	info, err := b.client.Whoami()
+	if err != nil {
+		return fmt.Errorf("getting own client info: %w", err)
+	}
+
+	if info.ClientChannelID == cid {
+		return nil
+	}
+
+	_, err = b.client.ExecCmd(ts3.NewCmd("clientmove").WithArgs(
+		ts3.NewArg("clid", info.ClientID),
+		ts3.NewArg("cid", cid),
+	))
+	if err != nil {
+		return fmt.Errorf("moving to channel %d: %w", cid, err)
+	}
+	return nil
+}
+
+// SendServerMessage sends a text message to the server chat
+func (b *Bot) SendServerMessage(msg string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	info, err := b.client.Whoami()
+	if err != nil {
+		return fmt.Errorf("getting own client info: %w", err)
+	}
+
+	_, err = b.client.ExecCmd(ts3.NewCmd("sendtextmessage").WithArgs(
+		ts3.NewArg("targetmode", TargetModeServer),
+		ts3.NewArg("target", info.ServerID),
+		ts3.NewArg("msg", msg),
+	))
+	if err != nil {
+		return fmt.Errorf("sending server message: %w", err)
+	}
+	return nil
+}
+
+// MessageUID sends a private text message to all clients connected
+// with the given unique identifier, returns false if none is online
+func (b *Bot) MessageUID(uid string, msg string) (bool, error) {
+	clids, err := b.clientIDs(uid)
+	if err != nil {
+		return false, err
+	}
+
+	for _, clid := range clids {
+		if err := b.SendPrivateMessage(strconv.Itoa(clid), msg); err != nil {
+			return true, err
+		}
+	}
+
+	return len(clids) > 0, nil
+}
+
+// PokeUID pokes all clients connected with the given unique identifier,
+// returns false if none is online
+func (b *Bot) PokeUID(uid string, msg string) (bool, error) {
+	clids, err := b.clientIDs(uid)
+	if err != nil {
+		return false, err
+	}
+
+	for _, clid := range clids {
+		if err := b.Poke(strconv.Itoa(clid), msg); err != nil {
+			return true, err
+		}
+	}
+
+	return len(clids) > 0, nil
+}
+
+// Returns the client ids of all clients connected with the given unique identifier
+func (b *Bot) clientIDs(uid string) ([]int, error) {
+	var resp []struct {
+		ClientID int `ms:"clid"`
+	}
+	_, err := b.exec(ts3.NewCmd("clientgetids").WithArgs(
+		ts3.NewArg("cluid", uid),
+	).WithResponse(&resp))
+	if isTSError(err, errIDDatabaseEmptyResult) || isTSError(err, errIDInvalidClientID) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting client ids: %w", err)
+	}
+
+	clids := make([]int, 0, len(resp))
+	for _, c := range resp {
+		clids = append(clids, c.ClientID)
+	}
+	return clids, nil
+}
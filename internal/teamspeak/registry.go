@@ -0,0 +1,239 @@
+package teamspeak
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/devusSs/twitchspeak/internal/database"
+)
+
+// CommandHandler handles an invoked command
+type CommandHandler func(ctx *CommandContext) error
+
+// Command is a text command the bot reacts to
+type Command struct {
+	// Name the command is invoked with (without prefix)
+	Name    string
+	Aliases []string
+	// Arguments the command accepts, e.g. "<code>"
+	Usage       string
+	Description string
+	// Server group ID the invoker needs to be a member of, 0 for none
+	ServerGroup int
+	// Only allow invokers who connected their Twitch account
+	LinkedOnly bool
+	// Per invoker cooldown, 0 for none
+	Cooldown time.Duration
+	Handler  CommandHandler
+}
+
+// CommandContext is passed to command handlers
+// and holds information about the invocation
+type CommandContext struct {
+	Bot     *Bot
+	Command *Command
+	// Arguments passed to the command, quoted strings are one argument
+	Args []string
+
+	InvokerID   string
+	InvokerUID  string
+	InvokerName string
+	// Database ID of the invoker on the TeamSpeak server
+	InvokerDBID string
+	// Channel the invoker is currently in
+	ChannelID string
+	// Server groups the invoker is a member of
+	ServerGroups []int
+	// Linked user of the invoker, nil if not linked
+	User *database.User
+
+	// Set by Reject, rejected invocations do not start the cooldown
+	rejected bool
+}
+
+// Reply sends a private message to the invoker
+func (c *CommandContext) Reply(msg string) error {
+	return c.Bot.SendPrivateMessage(c.InvokerID, msg)
+}
+
+// Replyf formats according to format and sends a private message to the invoker
+func (c *CommandContext) Replyf(format string, args ...interface{}) error {
+	return c.Reply(fmt.Sprintf(format, args...))
+}
+
+// Reject sends a private message to the invoker explaining why the invocation
+// was rejected (e.g. invalid arguments), the cooldown of the command is not started
+func (c *CommandContext) Reject(msg string) error {
+	c.rejected = true
+	return c.Reply(msg)
+}
+
+// Rejectf formats according to format and rejects the invocation
+func (c *CommandContext) Rejectf(format string, args ...interface{}) error {
+	return c.Reject(fmt.Sprintf(format, args...))
+}
+
+// Registry holds the commands known to the bot
+type Registry struct {
+	mu       sync.RWMutex
+	prefix   string
+	commands map[string]*Command
+	aliases  map[string]string
+}
+
+// Register adds a command to the registry
+//
+// Names and aliases are case insensitive and must be unique
+func (r *Registry) Register(cmd *Command) error {
+	if cmd == nil || cmd.Name == "" {
+		return fmt.Errorf("command name is empty")
+	}
+
+	if cmd.Handler == nil {
+		return fmt.Errorf("command %q has no handler", cmd.Name)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := append([]string{cmd.Name}, cmd.Aliases...)
+	for _, name := range names {
+		name = strings.ToLower(name)
+		if _, ok := r.commands[name]; ok {
+			return fmt.Errorf("command %q already registered", name)
+		}
+		if _, ok := r.aliases[name]; ok {
+			return fmt.Errorf("command %q already registered", name)
+		}
+	}
+
+	name := strings.ToLower(cmd.Name)
+	r.commands[name] = cmd
+	for _, alias := range cmd.Aliases {
+		r.aliases[strings.ToLower(alias)] = name
+	}
+
+	return nil
+}
+
+// Lookup returns the command registered under name or alias
+func (r *Registry) Lookup(name string) (*Command, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	name = strings.ToLower(name)
+	if alias, ok := r.aliases[name]; ok {
+		name = alias
+	}
+
+	cmd, ok := r.commands[name]
+	return cmd, ok
+}
+
+// Commands returns all registered commands sorted by name
+func (r *Registry) Commands() []*Command {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	cmds := make([]*Command, 0, len(r.commands))
+	for _, cmd := range r.commands {
+		cmds = append(cmds, cmd)
+	}
+
+	sort.Slice(cmds, func(i, j int) bool {
+		return cmds[i].Name < cmds[j].Name
+	})
+
+	return cmds
+}
+
+// Prefix returns the prefix commands are invoked with
+func (r *Registry) Prefix() string {
+	return r.prefix
+}
+
+// Parse splits a message into command name and arguments
+//
+// Returns false if the message does not start with the prefix
+func (r *Registry) Parse(msg string) (string, []string, bool) {
+	msg = strings.TrimSpace(msg)
+	if !strings.HasPrefix(msg, r.prefix) {
+		return "", nil, false
+	}
+
+	fields := parseArgs(strings.TrimPrefix(msg, r.prefix))
+	if len(fields) == 0 || fields[0] == "" {
+		return "", nil, false
+	}
+
+	return strings.ToLower(fields[0]), fields[1:], true
+}
+
+// NewRegistry creates a new, empty command registry
+//
+// If prefix is empty "!" will be used
+func NewRegistry(prefix string) *Registry {
+	if prefix == "" {
+		prefix = defaultCommandPrefix
+	}
+
+	return &Registry{
+		prefix:   prefix,
+		commands: make(map[string]*Command),
+		aliases:  make(map[string]string),
+	}
+}
+
+const (
+	defaultCommandPrefix = "!"
+)
+
+// Splits s by whitespace, treats single or double quoted strings
+// as one argument and supports escaping with backslashes
+func parseArgs(s string) []string {
+	var (
+		args    []string
+		current strings.Builder
+		quote   rune
+		escaped bool
+		inArg   bool
+	)
+
+	for _, r := range s {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+			inArg = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+				continue
+			}
+			current.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+
+	if inArg {
+		args = append(args, current.String())
+	}
+
+	return args
+}
@@ -0,0 +1,39 @@
+package teamspeak
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []string
+	}{
+		{"empty", "", nil},
+		{"only whitespace", " \t\n ", nil},
+		{"single", "link", []string{"link"}},
+		{"whitespace", "ban  cool_user\t7d\nspam", []string{"ban", "cool_user", "7d", "spam"}},
+		{"double quotes", `ban cool_user "being rude"`, []string{"ban", "cool_user", "being rude"}},
+		{"single quotes", `ban cool_user 'being rude'`, []string{"ban", "cool_user", "being rude"}},
+		{"other quote inside quotes", `say "it's fine" 'say "hi"'`, []string{"say", "it's fine", `say "hi"`}},
+		{"quotes inside word", `nick=" Cool User "`, []string{"nick= Cool User "}},
+		{"empty quotes", `set "" ''`, []string{"set", "", ""}},
+		{"unterminated quote", `say "hello world`, []string{"say", "hello world"}},
+		{"escaped space", `say hello\ world`, []string{"say", "hello world"}},
+		{"escaped quote", `say \"hi\"`, []string{"say", `"hi"`}},
+		{"escaped quote inside quotes", `say "a \" b"`, []string{"say", `a " b`}},
+		{"escaped backslash", `path C:\\temp`, []string{"path", `C:\temp`}},
+		{"trailing backslash", `say \`, []string{"say", ""}},
+		{"multibyte", `say "grüße aus köln" 😀`, []string{"say", "grüße aus köln", "😀"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseArgs(tt.in); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("parseArgs(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
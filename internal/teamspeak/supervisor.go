@@ -0,0 +1,168 @@
+package teamspeak
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ConnState is the state of the ServerQuery connection
+type ConnState int32
+
+// Possible connection states
+const (
+	StateDisconnected ConnState = iota
+	StateConnected
+	StateReconnecting
+	// Reconnecting failed too many times in a row,
+	// the supervisor keeps retrying at the maximum backoff
+	StateFailed
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case StateDisconnected:
+		return "disconnected"
+	case StateConnected:
+		return "connected"
+	case StateReconnecting:
+		return "reconnecting"
+	case StateFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+// State returns the current state of the ServerQuery connection
+func (b *Bot) State() ConnState {
+	return ConnState(b.state.Load())
+}
+
+// OnStateChange registers a function which is called
+// every time the state of the ServerQuery connection changes
+func (b *Bot) OnStateChange(fn func(ConnState)) {
+	b.stateMu.Lock()
+	defer b.stateMu.Unlock()
+	b.stateFuncs = append(b.stateFuncs, fn)
+}
+
+// Supervise periodically checks the ServerQuery connection and
+// re-establishes it with exponential backoff once it has been lost
+//
+// Blocks until context is canceled
+func (b *Bot) Supervise(ctx context.Context, wg *sync.WaitGroup) {
+	b.logger.Info("Supervising connection, keepalive every %s", b.keepAlive)
+
+	ticker := time.NewTicker(b.keepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			b.logger.Debug("Exiting supervisor")
+			wg.Done()
+			return
+		case <-ticker.C:
+			err := b.keepAliveCheck()
+			if err == nil {
+				continue
+			}
+
+			b.logger.Error("Connection lost: %s", err.Error())
+
+			if !b.reconnect(ctx) {
+				b.logger.Debug("Exiting supervisor")
+				wg.Done()
+				return
+			}
+		}
+	}
+}
+
+// Sends a keepalive to the server, returns an error if the connection is dead
+func (b *Bot) keepAliveCheck() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.client.IsConnected() {
+		return errNotConnected
+	}
+
+	_, err := b.client.Whoami()
+	return err
+}
+
+// Retries establishing the connection until it succeeds,
+// returns false if context was canceled before
+func (b *Bot) reconnect(ctx context.Context) bool {
+	b.setState(StateReconnecting)
+
+	// The dead client is closed by EstablishConn once it gets replaced,
+	// closing it twice panics
+
+	for attempt := 1; ; attempt++ {
+		delay := backoff(attempt)
+
+		b.logger.Info("Reconnecting in %s (attempt %d)", delay, attempt)
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(delay):
+		}
+
+		err := b.EstablishConn()
+		if err == nil {
+			err = b.RegisterEvents()
+		}
+		if err == nil {
+			b.logger.Info("Reconnected after %d attempt(s)", attempt)
+			return true
+		}
+
+		b.logger.Error("Reconnect attempt %d failed: %s", attempt, err.Error())
+
+		if attempt == b.maxAttempts {
+			b.logger.Error("Reconnecting failed %d times in a row, continuing to retry", attempt)
+			b.setState(StateFailed)
+		}
+	}
+}
+
+// Sets the connection state and notifies listeners if it changed
+func (b *Bot) setState(state ConnState) {
+	if ConnState(b.state.Swap(int32(state))) == state {
+		return
+	}
+
+	b.logger.Debug("connection state: %s", state)
+
+	b.stateMu.Lock()
+	defer b.stateMu.Unlock()
+	for _, fn := range b.stateFuncs {
+		go fn(state)
+	}
+}
+
+// Returns the delay before a reconnect attempt,
+// exponential backoff with full jitter
+func backoff(attempt int) time.Duration {
+	delay := maxBackoff
+	if attempt < 32 {
+		delay = min(minBackoff<<(attempt-1), maxBackoff)
+	}
+	return minBackoff + time.Duration(rand.Int63n(int64(delay)))
+}
+
+var errNotConnected = errors.New("not connected")
+
+const (
+	defaultKeepAlive            = time.Minute
+	defaultMaxReconnectAttempts = 10
+
+	minBackoff = time.Second
+	maxBackoff = 2 * time.Minute
+)
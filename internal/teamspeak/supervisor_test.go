@@ -0,0 +1,190 @@
+package teamspeak
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/devusSs/twitchspeak/pkg/log"
+)
+
+// Fake ServerQuery server, answers every command with ok
+// unless registering for notifications is set to fail
+type fakeServer struct {
+	listener     net.Listener
+	wg           sync.WaitGroup
+	quits        atomic.Int32
+	failRegister atomic.Bool
+
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listening: %v", err)
+	}
+
+	s := &fakeServer{listener: l}
+	s.wg.Add(1)
+	go s.serve()
+
+	t.Cleanup(func() {
+		_ = s.listener.Close()
+		s.mu.Lock()
+		for _, conn := range s.conns {
+			_ = conn.Close()
+		}
+		s.mu.Unlock()
+		s.wg.Wait()
+	})
+
+	return s
+}
+
+func (s *fakeServer) port() uint {
+	return uint(s.listener.Addr().(*net.TCPAddr).Port)
+}
+
+func (s *fakeServer) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.conns = append(s.conns, conn)
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeServer) handle(conn net.Conn) {
+	defer s.wg.Done()
+	defer conn.Close()
+
+	write := func(line string) {
+		_, _ = fmt.Fprintf(conn, "%s\n\r", line)
+	}
+
+	write("TS3")
+	write("Welcome to the TeamSpeak 3 ServerQuery interface")
+
+	sc := bufio.NewScanner(conn)
+	for sc.Scan() {
+		cmd, _, _ := strings.Cut(strings.TrimSpace(sc.Text()), " ")
+		switch cmd {
+		case "":
+			// Keepalive
+		case "whoami":
+			write("virtualserver_status=online virtualserver_id=1 client_id=42 client_channel_id=1 client_nickname=bot client_database_id=1")
+			write("error id=0 msg=ok")
+		case "servernotifyregister":
+			if s.failRegister.Load() {
+				write(`error id=2568 msg=insufficient\sclient\spermissions`)
+				continue
+			}
+			write("error id=0 msg=ok")
+		case "quit":
+			s.quits.Add(1)
+			write("error id=0 msg=ok")
+			return
+		default:
+			write("error id=0 msg=ok")
+		}
+	}
+}
+
+func TestReconnectClosesReplacedClientOnce(t *testing.T) {
+	log.SetDefaultLogsDirectory(t.TempDir())
+
+	server := newFakeServer(t)
+
+	bot := NewBot(BotConfig{
+		Host:      "127.0.0.1",
+		Queryport: server.port(),
+		Port:      9987,
+		Username:  "serveradmin",
+		Password:  "password",
+		Nickname:  "bot",
+	})
+
+	if err := bot.EstablishConn(); err != nil {
+		t.Fatalf("establishing connection: %v", err)
+	}
+
+	for i := 1; i <= 2; i++ {
+		if !bot.reconnect(context.Background()) {
+			t.Fatalf("reconnect %d: returned false", i)
+		}
+
+		if state := bot.State(); state != StateConnected {
+			t.Fatalf("reconnect %d: state = %s, want %s", i, state, StateConnected)
+		}
+
+		if got := server.quits.Load(); got != int32(i) {
+			t.Fatalf("reconnect %d: replaced clients closed = %d, want %d", i, got, i)
+		}
+	}
+
+	server.mu.Lock()
+	conns := len(server.conns)
+	server.mu.Unlock()
+	if conns != 3 {
+		t.Fatalf("connections = %d, want 3", conns)
+	}
+
+	if id := bot.OwnID(); id != "42" {
+		t.Fatalf("own id = %q, want %q", id, "42")
+	}
+}
+
+func TestConnectedOnlyAfterRegisteringEvents(t *testing.T) {
+	log.SetDefaultLogsDirectory(t.TempDir())
+
+	server := newFakeServer(t)
+	server.failRegister.Store(true)
+
+	bot := NewBot(BotConfig{
+		Host:      "127.0.0.1",
+		Queryport: server.port(),
+		Port:      9987,
+		Username:  "serveradmin",
+		Password:  "password",
+		Nickname:  "bot",
+	})
+
+	if err := bot.EstablishConn(); err != nil {
+		t.Fatalf("establishing connection: %v", err)
+	}
+	if state := bot.State(); state == StateConnected {
+		t.Fatalf("state = %s before registering events", state)
+	}
+
+	if err := bot.RegisterEvents(); err == nil {
+		t.Fatal("expected registering events to fail")
+	}
+	if state := bot.State(); state == StateConnected {
+		t.Fatalf("state = %s after registering events failed", state)
+	}
+
+	server.failRegister.Store(false)
+	if err := bot.RegisterEvents(); err != nil {
+		t.Fatalf("registering events: %v", err)
+	}
+	if state := bot.State(); state != StateConnected {
+		t.Fatalf("state = %s, want %s", state, StateConnected)
+	}
+}
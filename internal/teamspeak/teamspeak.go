@@ -3,10 +3,14 @@ package teamspeak
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/multiplay/go-ts3"
 
+	"github.com/devusSs/twitchspeak/internal/auth/linktoken"
 	"github.com/devusSs/twitchspeak/internal/database"
 	"github.com/devusSs/twitchspeak/pkg/log"
 )
@@ -22,9 +26,18 @@ type BotConfig struct {
 	Nickname string
 	// API specific login url for connecting Twitch
 	LoginBaseURL string
-	DB           database.Service
-	Console      bool
-	Debug        bool
+	// Issues link tokens proving ownership of a TeamSpeak identity
+	LinkTokens *linktoken.Signer
+	// Prefix commands are invoked with, defaults to "!"
+	CommandPrefix string
+	// Interval of keepalive checks of the ServerQuery connection, defaults to 1 minute
+	KeepAlive time.Duration
+	// Consecutive failed reconnects until the connection is considered failed,
+	// defaults to 10
+	MaxReconnectAttempts int
+	DB                   database.Service
+	Console              bool
+	Debug                bool
 }
 
 // Bot is the bot
@@ -37,48 +50,107 @@ type Bot struct {
 	nickname  string
 
 	loginBaseURL string
+	linkTokens   *linktoken.Signer
+
+	commands *Registry
+	events   *Bus
 
 	logger *log.Logger
 	db     database.Service
+	// Guards client since commands may be executed from multiple goroutines
+	mu     sync.Mutex
 	client *ts3.Client
+	// Client ID of the bot itself, used to ignore own messages
+	clid string
+	// Closed once client gets replaced by a new connection
+	replaced chan struct{}
+	// Channel the bot stays in, 0 for none
+	homeChannel int
+
+	keepAlive   time.Duration
+	maxAttempts int
+	state       atomic.Int32
+	stateMu     sync.Mutex
+	stateFuncs  []func(ConnState)
 }
 
 // EstablishConn establishes a connection to the TeamSpeak server
 // and sets up the client's port and nickname
+//
+// Replaces (and closes) any previously established connection
 func (b *Bot) EstablishConn() error {
 	client, err := ts3.NewClient(fmt.Sprintf("%s:%d", b.host, b.queryport))
 	if err != nil {
 		return fmt.Errorf("creating client: %w", err)
 	}
 
+	b.logger.Debug("created new client connection to %s:%d", b.host, b.queryport)
+
+	clid, err := b.setupClient(client)
+	if err != nil {
+		_ = client.Close()
+		return err
+	}
+
+	b.mu.Lock()
+	old := b.client
 	b.client = client
+	b.clid = clid
+	// Signal listeners to pick up the notifications of the new client
+	if b.replaced != nil {
+		close(b.replaced)
+	}
+	b.replaced = make(chan struct{})
+	// New connections start in the default channel
+	if b.homeChannel != 0 {
+		b.returnHome()
+	}
+	b.mu.Unlock()
 
-	b.logger.Debug("created new client connection to %s:%d", b.host, b.queryport)
+	if old != nil {
+		_ = old.Close()
+	}
 
-	if err := b.client.Login(b.username, b.password); err != nil {
-		return fmt.Errorf("logging in: %w", err)
+	b.logger.Info("Bot connected and initialized")
+
+	return nil
+}
+
+// Logs in, selects the virtual server and sets the nickname,
+// returns the client ID of the bot
+func (b *Bot) setupClient(client *ts3.Client) (string, error) {
+	if err := client.Login(b.username, b.password); err != nil {
+		return "", fmt.Errorf("logging in: %w", err)
 	}
 
 	b.logger.Debug("logged in")
 
-	if err := b.client.UsePort(int(b.port)); err != nil {
-		return fmt.Errorf("using port: %w", err)
+	if err := client.UsePort(int(b.port)); err != nil {
+		return "", fmt.Errorf("using port: %w", err)
 	}
 
 	b.logger.Debug("using port: %d", b.port)
 
-	if err := b.client.SetNick(b.nickname); err != nil {
-		return fmt.Errorf("setting nickname: %w", err)
+	if err := client.SetNick(b.nickname); err != nil {
+		return "", fmt.Errorf("setting nickname: %w", err)
 	}
 
 	b.logger.Debug("set nickname: %s", b.nickname)
 
-	b.logger.Info("Bot connected and initialized")
+	info, err := client.Whoami()
+	if err != nil {
+		return "", fmt.Errorf("getting own client info: %w", err)
+	}
 
-	return nil
+	clid := strconv.Itoa(info.ClientID)
+
+	b.logger.Debug("own client id: %s", clid)
+
+	return clid, nil
 }
 
-// RegisterEvents registers events for the bot
+// RegisterEvents registers events for the bot,
+// the connection counts as connected once they are registered
 func (b *Bot) RegisterEvents() error {
 	events := []ts3.NotifyCategory{
 		ts3.ServerEvents,
@@ -89,6 +161,9 @@ func (b *Bot) RegisterEvents() error {
 		ts3.TokenUsedEvents,
 	}
 
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
 	for _, event := range events {
 		if err := b.client.Register(event); err != nil {
 			return fmt.Errorf("registering event: %w", err)
@@ -97,31 +172,81 @@ func (b *Bot) RegisterEvents() error {
 
 	b.logger.Info("Registered events: %v", events)
 
+	// Only a connection receiving events is usable
+	b.setState(StateConnected)
+
 	return nil
 }
 
 // HandleEvents handles events from the TeamSpeak server
 //
-// Blocks until context is canceled
+// Follows reconnects of the supervisor, blocks until context is canceled
 func (b *Bot) HandleEvents(ctx context.Context, wg *sync.WaitGroup) {
 	b.logger.Info("Setup event handler")
+
+	// Last enter or leave notification, used to drop duplicates
+	var last string
+
+	notifications, replaced := b.notifications()
 	for {
 		select {
 		case <-ctx.Done():
 			b.logger.Debug("Exiting event handler")
 			wg.Done()
 			return
-		// TODO: setup event handlers
-		case event := <-b.client.Notifications():
-			b.logger.Debug("Event: %v", event)
+		case <-replaced:
+			b.logger.Debug("Connection replaced, following new client")
+			notifications, replaced = b.notifications()
+		case n, ok := <-notifications:
+			if !ok {
+				// Closed client, wait for the supervisor to replace it
+				notifications = nil
+				continue
+			}
+
+			b.logger.Debug("Event: %v", n)
+
+			// Enter and leave events are sent for server and channel events
+			if n.Type == string(EventClientEntered) || n.Type == string(EventClientLeft) {
+				key := fmt.Sprint(n.Type, n.Data)
+				if key == last {
+					continue
+				}
+				last = key
+			}
 
-			// Default commands:
-			// - !connect or login => connect twitch to ts identity or login if not logged in
-			// - !disconnect => disconnect twitch account from ts identity
+			b.events.Publish(DecodeEvent(n))
 		}
 	}
 }
 
+// Events returns the bus TeamSpeak events are published on
+func (b *Bot) Events() *Bus {
+	return b.events
+}
+
+// Returns the notifications of the current client and a channel
+// which is closed once the client gets replaced
+func (b *Bot) notifications() (<-chan ts3.Notification, <-chan struct{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.client.Notifications(), b.replaced
+}
+
+// OwnID returns the client ID of the bot itself
+func (b *Bot) OwnID() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.clid
+}
+
+// Executes cmd on the server, safe for concurrent use
+func (b *Bot) exec(cmd *ts3.Cmd) ([]string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.client.ExecCmd(cmd)
+}
+
 // NewBot creates a new bot but does not connect it
 func NewBot(cfg BotConfig) *Bot {
 	logger := log.NewLogger(
@@ -140,10 +265,30 @@ func NewBot(cfg BotConfig) *Bot {
 		nickname:  cfg.Nickname,
 
 		loginBaseURL: cfg.LoginBaseURL,
+		linkTokens:   cfg.LinkTokens,
+
+		commands: NewRegistry(cfg.CommandPrefix),
+		events:   NewBus(logger),
+
+		keepAlive:   cfg.KeepAlive,
+		maxAttempts: cfg.MaxReconnectAttempts,
 
 		logger: logger,
 		db:     cfg.DB,
 	}
 
+	if bot.keepAlive <= 0 {
+		bot.keepAlive = defaultKeepAlive
+	}
+
+	if bot.maxAttempts <= 0 {
+		bot.maxAttempts = defaultMaxReconnectAttempts
+	}
+
+	bot.registerDefaultCommands()
+
+	On(bot.events, bot.handleTextMessage)
+	On(bot.events, bot.trackClient)
+
 	return bot
 }
@@ -0,0 +1,28 @@
+package teamspeak
+
+import (
+	"errors"
+	"time"
+
+	"github.com/devusSs/twitchspeak/internal/database"
+)
+
+// Updates the stored TeamSpeak details of linked users entering the server
+func (b *Bot) trackClient(e *ClientEntered) {
+	if e.Query || e.UID == "" {
+		return
+	}
+
+	// Only the TeamSpeak details are written, other fields may be
+	// updated concurrently (e.g. by revocations)
+	err := b.db.SetTeamSpeakDetails(e.UID, e.DatabaseID, e.Nickname, e.Country, time.Now())
+	if errors.Is(err, database.ErrNotFound) {
+		return
+	}
+	if err != nil {
+		b.logger.Error("Error updating user %s: %v", e.UID, err)
+		return
+	}
+
+	b.logger.Debug("updated details of %s (%s)", e.Nickname, e.UID)
+}
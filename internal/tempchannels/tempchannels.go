@@ -0,0 +1,448 @@
+package tempchannels
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/devusSs/twitchspeak/internal/database"
+	"github.com/devusSs/twitchspeak/internal/helix"
+	"github.com/devusSs/twitchspeak/internal/streams"
+	"github.com/devusSs/twitchspeak/internal/teamspeak"
+	"github.com/devusSs/twitchspeak/pkg/log"
+)
+
+// Config for the channel manager
+type Config struct {
+	Bot   *teamspeak.Bot
+	DB    database.Service
+	Helix *helix.Client
+	// Channel the streamer channels are created below
+	ParentID int
+	// Channel group streamers get in their channel, e.g. channel admin
+	ChannelGroup int
+	// Server group required for getting a channel, 0 for all linked users
+	ServerGroup int
+	// Create channels automatically once streamers go live
+	OnLive bool
+	// Channels get deleted after being empty for this long
+	EmptyTimeout time.Duration
+	Console      bool
+	Debug        bool
+}
+
+// Manager creates channels for linked streamers
+// and deletes them once they have been empty for a while
+type Manager struct {
+	bot          *teamspeak.Bot
+	db           database.Service
+	helix        *helix.Client
+	parentID     int
+	channelGroup int
+	serverGroup  int
+	onLive       bool
+	emptyTimeout time.Duration
+	logger       *log.Logger
+
+	mu sync.Mutex
+	// When managed channels were first seen empty
+	emptySince map[int]time.Time
+}
+
+// Ensure returns the channel of the linked user and creates it if needed,
+// the description is set to the stream or just the channel link if stream is nil
+//
+// Returns whether the channel was created
+func (m *Manager) Ensure(user *database.User, stream *streams.Stream) (*database.TempChannel, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	desc := description(user, stream)
+
+	channel, err := m.db.GetTempChannelByTwitchID(user.TwitchID)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		return nil, false, fmt.Errorf("getting channel: %w", err)
+	}
+
+	if channel != nil {
+		exists, err := m.exists(channel.ChannelID)
+		if err != nil {
+			return nil, false, err
+		}
+
+		if exists {
+			delete(m.emptySince, channel.ChannelID)
+			if err := m.bot.SetChannelDescription(channel.ChannelID, desc); err != nil {
+				return nil, false, err
+			}
+			return channel, false, nil
+		}
+
+		// Someone deleted the channel in TeamSpeak
+		if err := m.db.DeleteTempChannel(channel.ChannelID); err != nil && !errors.Is(err, database.ErrNotFound) {
+			return nil, false, fmt.Errorf("deleting channel: %w", err)
+		}
+	}
+
+	cid, err := m.bot.CreateChannel(m.parentID, channelName(user, stream), desc)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if err := m.grant(user, cid); err != nil {
+		if err := m.bot.DeleteChannel(cid); err != nil {
+			m.logger.Error("Error deleting channel %d: %v", cid, err)
+		}
+		return nil, false, err
+	}
+
+	channel = &database.TempChannel{
+		TwitchID:     user.TwitchID,
+		TeamSpeakUID: user.TeamSpeakUID,
+		ChannelID:    cid,
+	}
+	if err := m.db.AddTempChannel(channel); err != nil {
+		if err := m.bot.DeleteChannel(cid); err != nil {
+			m.logger.Error("Error deleting channel %d: %v", cid, err)
+		}
+		return nil, false, fmt.Errorf("adding channel: %w", err)
+	}
+
+	m.logger.Info("Created channel %d for %s (Twitch %s)", cid, user.TeamSpeakUID, user.TwitchID)
+
+	return channel, true, nil
+}
+
+// Cleanup deletes channels which have been empty for longer than the timeout
+// and forgets channels which got deleted in TeamSpeak
+func (m *Manager) Cleanup() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	managed, err := m.db.ListTempChannels()
+	if err != nil {
+		return fmt.Errorf("listing channels: %w", err)
+	}
+
+	if len(managed) == 0 {
+		return nil
+	}
+
+	channels, err := m.bot.Channels()
+	if err != nil {
+		return err
+	}
+
+	clients := make(map[int]int, len(channels))
+	for _, c := range channels {
+		clients[c.ID] = c.TotalClients
+	}
+
+	now := time.Now()
+	for _, channel := range managed {
+		total, exists := clients[channel.ChannelID]
+
+		if exists && total > 0 {
+			delete(m.emptySince, channel.ChannelID)
+			continue
+		}
+
+		if exists {
+			since, ok := m.emptySince[channel.ChannelID]
+			if !ok {
+				m.emptySince[channel.ChannelID] = now
+				continue
+			}
+			if now.Sub(since) < m.emptyTimeout {
+				continue
+			}
+
+			if err := m.bot.DeleteChannel(channel.ChannelID); err != nil {
+				m.logger.Error("Error deleting channel %d: %v", channel.ChannelID, err)
+				continue
+			}
+		}
+
+		err := m.db.DeleteTempChannel(channel.ChannelID)
+		if err != nil && !errors.Is(err, database.ErrNotFound) {
+			m.logger.Error("Error deleting channel %d: %v", channel.ChannelID, err)
+			continue
+		}
+		delete(m.emptySince, channel.ChannelID)
+
+		if exists {
+			m.logger.Info("Deleted empty channel %d of %s", channel.ChannelID, channel.TeamSpeakUID)
+		} else {
+			m.logger.Info("Forgot channel %d of %s, it got deleted in TeamSpeak", channel.ChannelID, channel.TeamSpeakUID)
+		}
+	}
+
+	return nil
+}
+
+// Run cleans up empty channels every minute until context is canceled
+func (m *Manager) Run(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	ticker := time.NewTicker(cleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			m.logger.Debug("Exiting channel cleanup")
+			return
+		case <-ticker.C:
+			if err := m.Cleanup(); err != nil {
+				m.logger.Error("Error cleaning up channels: %v", err)
+			}
+		}
+	}
+}
+
+// Online implements streams.Handler, creates the channel of qualifying
+// linked streamers (if enabled) and updates the description of existing ones
+func (m *Manager) Online(ctx context.Context, stream streams.Stream) {
+	user, err := m.db.GetUserByTwitchID(stream.UserID)
+	if errors.Is(err, database.ErrNotFound) {
+		return
+	}
+	if err != nil {
+		m.logger.Error("Error getting user %s: %v", stream.UserID, err)
+		return
+	}
+
+	if user.Revoked() {
+		return
+	}
+
+	if !m.onLive {
+		if _, err := m.db.GetTempChannelByTwitchID(user.TwitchID); err != nil {
+			return
+		}
+	}
+
+	ok, err := m.qualifies(user)
+	if err != nil {
+		m.logger.Error("Error checking server groups of %s: %v", user.TeamSpeakUID, err)
+		return
+	}
+	if !ok {
+		return
+	}
+
+	if _, _, err := m.Ensure(user, &stream); err != nil {
+		m.logger.Error("Error ensuring channel of %s: %v", stream.UserLogin, err)
+	}
+}
+
+// Offline implements streams.Handler, channels are kept until they are empty
+func (m *Manager) Offline(ctx context.Context, userID string) {}
+
+// RegisterCommands registers the channel related commands on the bot
+func (m *Manager) RegisterCommands() error {
+	return m.bot.RegisterCommand(&teamspeak.Command{
+		Name:        "mychannel",
+		Description: "Creates your own channel or moves you into it",
+		ServerGroup: m.serverGroup,
+		LinkedOnly:  true,
+		Cooldown:    30 * time.Second,
+		Handler:     m.handleCommand,
+	})
+}
+
+// Creates the channel of the invoker and moves them into it
+func (m *Manager) handleCommand(ctx *teamspeak.CommandContext) error {
+	c, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	stream, err := m.stream(c, ctx.User.TwitchID)
+	if err != nil {
+		m.logger.Warn("Error getting stream of %s: %v", ctx.User.TwitchID, err)
+	}
+
+	channel, created, err := m.Ensure(ctx.User, stream)
+	if errors.Is(err, teamspeak.ErrChannelNameInUse) {
+		return ctx.Reject("A channel with your name already exists, please ask an admin to rename it.")
+	}
+	if err != nil {
+		return err
+	}
+
+	if ctx.ChannelID != strconv.Itoa(channel.ChannelID) {
+		if err := m.bot.MoveClient(ctx.InvokerID, channel.ChannelID); err != nil {
+			m.logger.Warn("Error moving %s into channel %d: %v", ctx.InvokerUID, channel.ChannelID, err)
+		}
+	}
+
+	if created {
+		return ctx.Replyf(
+			"Your channel has been created, it gets deleted once it has been empty for %v.",
+			m.emptyTimeout,
+		)
+	}
+
+	return ctx.Reply("Your channel already exists, its description has been updated.")
+}
+
+// Returns the live stream of the Twitch user, nil if not live
+func (m *Manager) stream(ctx context.Context, twitchID string) (*streams.Stream, error) {
+	live, err := m.helix.GetStreams(ctx, []string{twitchID})
+	if err != nil || len(live) == 0 {
+		return nil, err
+	}
+
+	return &streams.Stream{
+		ID:        live[0].ID,
+		UserID:    live[0].UserID,
+		UserLogin: live[0].UserLogin,
+		UserName:  live[0].UserName,
+		Title:     live[0].Title,
+		Game:      live[0].GameName,
+		StartedAt: live[0].StartedAt,
+	}, nil
+}
+
+// Whether the user is a member of the required server group
+func (m *Manager) qualifies(user *database.User) (bool, error) {
+	if m.serverGroup == 0 {
+		return true, nil
+	}
+
+	groups, err := m.bot.ServerGroupsByUID(user.TeamSpeakUID)
+	if err != nil {
+		return false, err
+	}
+
+	return slices.Contains(groups, m.serverGroup), nil
+}
+
+// Puts the user into the configured channel group of the channel
+func (m *Manager) grant(user *database.User, cid int) error {
+	cldbid := user.TeamSpeakDBID
+	if cldbid == 0 {
+		var err error
+		cldbid, err = m.bot.ClientDBIDFromUID(user.TeamSpeakUID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return m.bot.SetClientChannelGroup(cldbid, cid, m.channelGroup)
+}
+
+// Whether the channel exists in TeamSpeak
+func (m *Manager) exists(cid int) (bool, error) {
+	channels, err := m.bot.Channels()
+	if err != nil {
+		return false, err
+	}
+
+	return slices.ContainsFunc(channels, func(c *teamspeak.Channel) bool {
+		return c.ID == cid
+	}), nil
+}
+
+// Names the channel after the Twitch display name of the user,
+// TeamSpeak limits channel names to 40 characters
+func channelName(user *database.User, stream *streams.Stream) string {
+	name := user.TwitchDisplayName
+	if name == "" && stream != nil {
+		name = stream.UserName
+	}
+	if name == "" {
+		name = user.TwitchLogin
+	}
+	if name == "" {
+		name = user.TeamSpeakNickname
+	}
+
+	for utf8.RuneCountInString(name) > maxNameLength {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+
+	return name
+}
+
+// Describes the channel with the stream title and link
+func description(user *database.User, stream *streams.Stream) string {
+	login := user.TwitchLogin
+	if stream != nil {
+		login = stream.UserLogin
+	}
+
+	var link string
+	if login != "" {
+		link = fmt.Sprintf("[URL]https://twitch.tv/%s[/URL]", login)
+	}
+
+	if stream == nil || stream.Title == "" {
+		return link
+	}
+
+	// Titles are chosen on Twitch and must not be able to inject BBCode
+	return fmt.Sprintf("[B]%s[/B]\n%s", teamspeak.EscapeBBCode(stream.Title), link)
+}
+
+// NewManager creates a new channel manager
+func NewManager(cfg Config) (*Manager, error) {
+	if cfg.Bot == nil {
+		return nil, fmt.Errorf("tempchannels: bot is nil")
+	}
+
+	if cfg.DB == nil {
+		return nil, fmt.Errorf("tempchannels: database service is nil")
+	}
+
+	if cfg.Helix == nil {
+		return nil, fmt.Errorf("tempchannels: helix client is nil")
+	}
+
+	if cfg.ParentID <= 0 {
+		return nil, fmt.Errorf("tempchannels: parent channel is not set")
+	}
+
+	if cfg.ChannelGroup <= 0 {
+		return nil, fmt.Errorf("tempchannels: channel group is not set")
+	}
+
+	logger := log.NewLogger(
+		log.WithOwnLogFile("tempchannels.log"),
+		log.WithName("tempchannels"),
+		log.WithConsole(cfg.Console),
+		log.WithDebug(cfg.Debug),
+	)
+
+	m := &Manager{
+		bot:          cfg.Bot,
+		db:           cfg.DB,
+		helix:        cfg.Helix,
+		parentID:     cfg.ParentID,
+		channelGroup: cfg.ChannelGroup,
+		serverGroup:  cfg.ServerGroup,
+		onLive:       cfg.OnLive,
+		emptyTimeout: cfg.EmptyTimeout,
+		logger:       logger,
+		emptySince:   make(map[int]time.Time),
+	}
+
+	m.logger.Info(
+		"Channel manager initialized, parent: %d, server group: %d, on live: %v",
+		m.parentID,
+		m.serverGroup,
+		m.onLive,
+	)
+
+	return m, nil
+}
+
+const (
+	cleanupInterval = time.Minute
+	maxNameLength   = 40
+)
@@ -0,0 +1,39 @@
+package tempchannels
+
+import (
+	"testing"
+
+	"github.com/devusSs/twitchspeak/internal/database"
+	"github.com/devusSs/twitchspeak/internal/streams"
+)
+
+func TestDescription(t *testing.T) {
+	user := &database.User{TwitchLogin: "cool_user"}
+
+	tests := []struct {
+		name   string
+		stream *streams.Stream
+		want   string
+	}{
+		{"offline", nil, "[URL]https://twitch.tv/cool_user[/URL]"},
+		{"without title", &streams.Stream{UserLogin: "cool_user"}, "[URL]https://twitch.tv/cool_user[/URL]"},
+		{
+			"title",
+			&streams.Stream{UserLogin: "cool_user", Title: "Speedrun"},
+			"[B]Speedrun[/B]\n[URL]https://twitch.tv/cool_user[/URL]",
+		},
+		{
+			"bbcode in title",
+			&streams.Stream{UserLogin: "cool_user", Title: "[URL=https://evil.example.com]free[/URL]"},
+			"[B][\u200bURL=https://evil.example.com\u200b]free[\u200b/URL\u200b][/B]\n[URL]https://twitch.tv/cool_user[/URL]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := description(user, tt.stream); got != tt.want {
+				t.Fatalf("description() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package welcome
+
+import (
+	"embed"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/devusSs/twitchspeak/internal/teamspeak"
+)
+
+// Built-in templates, may be overridden by files in the templates directory
+//
+//go:embed templates/*.tmpl
+var defaultTemplates embed.FS
+
+// Names of the templates, language variants are named
+// like "unlinked.de.tmpl" (by language) or "unlinked.at.tmpl" (by country)
+const (
+	templateUnlinked = "unlinked"
+	templateLinked   = "linked"
+	templatePoke     = "poke"
+)
+
+// Data is passed to the templates
+type Data struct {
+	Nickname string
+	// Country code of the client as reported by TeamSpeak, e.g. "DE"
+	Country string
+	// Command prefix of the bot, e.g. "!"
+	Prefix string
+	// Personal login link, only set for unlinked clients
+	LoginURL string
+	// Only set for linked clients
+	TwitchID string
+	// Twitch display name, falls back to the Twitch ID if unknown
+	TwitchName string
+}
+
+// Parses the built-in templates and the ones in dir (if set),
+// templates in dir replace built-in ones with the same name
+func loadTemplates(dir string) (*template.Template, error) {
+	tmpl, err := template.ParseFS(defaultTemplates, "templates/*.tmpl")
+	if err != nil {
+		return nil, fmt.Errorf("parsing built-in templates: %w", err)
+	}
+
+	if dir == "" {
+		return tmpl, nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.tmpl"))
+	if err != nil {
+		return nil, fmt.Errorf("listing templates: %w", err)
+	}
+
+	if len(files) == 0 {
+		return tmpl, nil
+	}
+
+	tmpl, err = tmpl.ParseFiles(files...)
+	if err != nil {
+		return nil, fmt.Errorf("parsing templates: %w", err)
+	}
+
+	return tmpl, nil
+}
+
+// Renders the variant of the template matching the country best
+func render(tmpl *template.Template, name string, country string, data Data) (string, error) {
+	country = strings.ToLower(country)
+
+	// Nicknames are chosen by the clients and must not be able to inject BBCode
+	data.Nickname = teamspeak.EscapeBBCode(data.Nickname)
+	data.TwitchName = teamspeak.EscapeBBCode(data.TwitchName)
+
+	var candidates []string
+	if lang, ok := languages[country]; ok {
+		candidates = append(candidates, name+"."+lang+".tmpl")
+	}
+	if country != "" {
+		candidates = append(candidates, name+"."+country+".tmpl")
+	}
+	candidates = append(candidates, name+".tmpl")
+
+	for _, candidate := range candidates {
+		t := tmpl.Lookup(candidate)
+		if t == nil {
+			continue
+		}
+
+		var sb strings.Builder
+		if err := t.Execute(&sb, data); err != nil {
+			return "", fmt.Errorf("executing template %s: %w", candidate, err)
+		}
+		return strings.TrimSpace(sb.String()), nil
+	}
+
+	return "", fmt.Errorf("template %s not found", name)
+}
+
+// Languages spoken in countries (lower case country codes),
+// countries not listed are matched by their country code only
+var languages = map[string]string{
+	"de": "de",
+	"at": "de",
+	"ch": "de",
+	"li": "de",
+	"fr": "fr",
+	"be": "fr",
+	"lu": "fr",
+	"mc": "fr",
+	"es": "es",
+	"mx": "es",
+	"ar": "es",
+	"co": "es",
+	"cl": "es",
+	"pe": "es",
+	"it": "it",
+	"sm": "it",
+	"pt": "pt",
+	"br": "pt",
+	"nl": "nl",
+	"gb": "en",
+	"us": "en",
+	"ie": "en",
+	"au": "en",
+	"nz": "en",
+	"ca": "en",
+}
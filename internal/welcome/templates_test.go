@@ -0,0 +1,57 @@
+package welcome
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	tmpl, err := loadTemplates("")
+	if err != nil {
+		t.Fatalf("loading templates: %v", err)
+	}
+
+	data := Data{
+		Nickname: "[URL=https://evil.example.com]Cool User[/URL]",
+		Country:  "DE",
+		Prefix:   "!",
+		LoginURL: "https://example.com/login",
+	}
+
+	msg, err := render(tmpl, templateUnlinked, data.Country, data)
+	if err != nil {
+		t.Fatalf("rendering template: %v", err)
+	}
+
+	if strings.Contains(msg, "[URL=https://evil.example.com]") {
+		t.Fatalf("nickname has not been escaped: %q", msg)
+	}
+	if !strings.Contains(msg, "[\u200bURL=https://evil.example.com\u200b]Cool User[\u200b/URL\u200b]") {
+		t.Fatalf("message %q does not contain the escaped nickname", msg)
+	}
+	if !strings.Contains(msg, data.LoginURL) {
+		t.Fatalf("message %q does not contain the login url", msg)
+	}
+}
+
+func TestRenderLanguage(t *testing.T) {
+	tmpl, err := loadTemplates("")
+	if err != nil {
+		t.Fatalf("loading templates: %v", err)
+	}
+
+	data := Data{Nickname: "Cool User", Prefix: "!", LoginURL: "https://example.com/login"}
+
+	german, err := render(tmpl, templateUnlinked, "AT", data)
+	if err != nil {
+		t.Fatalf("rendering german template: %v", err)
+	}
+	english, err := render(tmpl, templateUnlinked, "", data)
+	if err != nil {
+		t.Fatalf("rendering default template: %v", err)
+	}
+
+	if german == english {
+		t.Fatalf("got the default template for a german speaking country: %q", german)
+	}
+}
@@ -0,0 +1,230 @@
+package welcome
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"text/template"
+	"time"
+
+	"github.com/devusSs/twitchspeak/internal/database"
+	"github.com/devusSs/twitchspeak/internal/database/redis"
+	"github.com/devusSs/twitchspeak/internal/helix"
+	"github.com/devusSs/twitchspeak/internal/teamspeak"
+	"github.com/devusSs/twitchspeak/pkg/log"
+)
+
+// Mode is how unlinked clients are notified
+type Mode string
+
+// Supported modes
+const (
+	// Send a private message
+	ModeMessage Mode = "message"
+	// Poke the client and send a private message,
+	// pokes are limited to 100 characters so the link is sent as message
+	ModePoke Mode = "poke"
+)
+
+// Config for the welcomer
+type Config struct {
+	Bot *teamspeak.Bot
+	DB  database.Service
+	// Optional, used to show the Twitch display name of linked users
+	Helix *helix.Client
+	Mode  Mode
+	// Send a welcome back message to linked clients
+	Linked bool
+	// Directory with custom templates, built-in templates are used if empty
+	TemplatesDir string
+	// Minimum duration between messages to the same TeamSpeak identity
+	Throttle time.Duration
+	Console  bool
+	Debug    bool
+}
+
+// Welcomer greets clients entering the TeamSpeak server,
+// nudging unlinked ones to connect their Twitch account
+type Welcomer struct {
+	bot       *teamspeak.Bot
+	db        database.Service
+	helix     *helix.Client
+	mode      Mode
+	linked    bool
+	throttle  time.Duration
+	templates *template.Template
+	logger    *log.Logger
+}
+
+// Subscribe starts greeting clients entering the server
+func (w *Welcomer) Subscribe() *teamspeak.Subscription {
+	return teamspeak.On(w.bot.Events(), w.handleClientEntered)
+}
+
+func (w *Welcomer) handleClientEntered(e *teamspeak.ClientEntered) {
+	if e.Query || e.UID == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := w.welcome(ctx, e); err != nil {
+		w.logger.Error("Error welcoming %s (%s): %v", e.Nickname, e.UID, err)
+	}
+}
+
+// Sends the matching message to the client
+func (w *Welcomer) welcome(ctx context.Context, e *teamspeak.ClientEntered) error {
+	user, err := w.db.GetUserByTeamSpeakUID(e.UID)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		return fmt.Errorf("getting user: %w", err)
+	}
+
+	// Revoked users need to login again
+	if user != nil && user.Revoked() {
+		user = nil
+	}
+
+	if user != nil && !w.linked {
+		return nil
+	}
+
+	ok, err := w.acquire(ctx, e.UID)
+	if err != nil {
+		return fmt.Errorf("checking throttle: %w", err)
+	}
+	if !ok {
+		w.logger.Debug("throttled welcome for %s", e.UID)
+		return nil
+	}
+
+	data := Data{
+		Nickname: e.Nickname,
+		Country:  e.Country,
+		Prefix:   w.bot.Commands().Prefix(),
+	}
+
+	clid := strconv.Itoa(e.ClientID)
+
+	if user != nil {
+		data.TwitchID = user.TwitchID
+		data.TwitchName = w.twitchName(ctx, user)
+
+		msg, err := render(w.templates, templateLinked, e.Country, data)
+		if err != nil {
+			return err
+		}
+
+		return w.bot.SendPrivateMessage(clid, msg)
+	}
+
+	data.LoginURL, err = w.bot.LoginURL(e.UID)
+	if err != nil {
+		return err
+	}
+
+	msg, err := render(w.templates, templateUnlinked, e.Country, data)
+	if err != nil {
+		return err
+	}
+
+	if w.mode == ModePoke {
+		poke, err := render(w.templates, templatePoke, e.Country, data)
+		if err != nil {
+			return err
+		}
+
+		if err := w.bot.Poke(clid, poke); err != nil {
+			return err
+		}
+	}
+
+	if err := w.bot.SendPrivateMessage(clid, msg); err != nil {
+		return err
+	}
+
+	w.logger.Debug("sent welcome to unlinked client %s (%s)", e.Nickname, e.UID)
+
+	return nil
+}
+
+// Returns whether the client may be messaged and starts the throttle
+func (w *Welcomer) acquire(ctx context.Context, uid string) (bool, error) {
+	client := redis.GetClient()
+	if w.throttle <= 0 || client == nil {
+		return true, nil
+	}
+
+	return client.SetNX(ctx, "twitchspeak:welcome:"+uid, 1, w.throttle).Result()
+}
+
+// Returns the stored Twitch display name, resolves it via Helix
+// if unknown and falls back to the Twitch ID
+func (w *Welcomer) twitchName(ctx context.Context, user *database.User) string {
+	if user.TwitchDisplayName != "" {
+		return user.TwitchDisplayName
+	}
+
+	if w.helix == nil {
+		return user.TwitchID
+	}
+
+	users, err := w.helix.GetUsers(ctx, []string{user.TwitchID})
+	if err != nil {
+		w.logger.Warn("Error getting Twitch user %s: %v", user.TwitchID, err)
+		return user.TwitchID
+	}
+	if len(users) == 0 {
+		return user.TwitchID
+	}
+
+	return users[0].DisplayName
+}
+
+// NewWelcomer creates a new welcomer
+func NewWelcomer(cfg Config) (*Welcomer, error) {
+	if cfg.Bot == nil {
+		return nil, fmt.Errorf("welcome: bot is nil")
+	}
+
+	if cfg.DB == nil {
+		return nil, fmt.Errorf("welcome: database service is nil")
+	}
+
+	switch cfg.Mode {
+	case "":
+		cfg.Mode = ModeMessage
+	case ModeMessage, ModePoke:
+	default:
+		return nil, fmt.Errorf("welcome: unknown mode %q", cfg.Mode)
+	}
+
+	templates, err := loadTemplates(cfg.TemplatesDir)
+	if err != nil {
+		return nil, fmt.Errorf("welcome: %w", err)
+	}
+
+	logger := log.NewLogger(
+		log.WithOwnLogFile("welcome.log"),
+		log.WithName("welcome"),
+		log.WithConsole(cfg.Console),
+		log.WithDebug(cfg.Debug),
+	)
+
+	w := &Welcomer{
+		bot:       cfg.Bot,
+		db:        cfg.DB,
+		helix:     cfg.Helix,
+		mode:      cfg.Mode,
+		linked:    cfg.Linked,
+		throttle:  cfg.Throttle,
+		templates: templates,
+		logger:    logger,
+	}
+
+	w.logger.Info("Welcomer initialized, mode: %s, welcome linked: %v", w.mode, w.linked)
+
+	return w, nil
+}